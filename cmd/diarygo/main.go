@@ -1,10 +1,24 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
+	"diarygo/internal/cli"
 	"diarygo/internal/server"
 )
 
 // -------------------- main --------------------
 func main() {
-	server.InitServer()
+	if len(os.Args) > 1 {
+		if err := cli.Run(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := server.InitServer(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
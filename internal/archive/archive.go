@@ -0,0 +1,442 @@
+package archive
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"diarygo/internal/blob"
+	"diarygo/internal/config"
+	"diarygo/internal/db"
+	"diarygo/internal/entity/attachment"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/entity/diary"
+	"diarygo/internal/entity/habit"
+	"diarygo/internal/entity/interest"
+	"diarygo/internal/entity/note"
+	"diarygo/internal/entity/sport"
+)
+
+// SchemaVersion 归档格式版本，表结构变化时递增
+// 2：包含附件表和附件文件
+const SchemaVersion = 2
+
+const (
+	appName      = "diarygo"
+	manifestFile = "manifest.json"
+	configFile   = "config.json"
+	blobDir      = "blobs/" // 附件文件，按 hash 命名
+)
+
+// Manifest 描述归档内容
+type Manifest struct {
+	App            string                 `json:"app"`
+	SchemaVersion  int                    `json:"schema_version"`
+	Created        string                 `json:"created"`
+	Encrypted      bool                   `json:"encrypted"`
+	KeyFingerprint string                 `json:"key_fingerprint,omitempty"`
+	Modules        map[string]ModuleEntry `json:"modules"`
+	Config         string                 `json:"config,omitempty"`
+	Blobs          int                    `json:"blobs"` // blobs/ 中的附件文件数
+}
+
+type ModuleEntry struct {
+	Count int    `json:"count"`
+	JSON  string `json:"json"`
+	CSV   string `json:"csv"`
+}
+
+type ExportOptions struct {
+	Encrypted bool // true 时导出数据库中的加密内容，否则导出明文
+}
+
+type ImportOptions struct {
+	Replace bool // true 时先清空各表再导入，否则按 id 覆盖
+	Config  bool // 是否导入配置
+}
+
+// ImportResult 各模块导入的记录数
+type ImportResult struct {
+	Modules map[string]int `json:"modules"`
+	Config  int            `json:"config"`
+	Blobs   int            `json:"blobs"`
+}
+
+// tableRepo 归档需要的仓库方法，写入在 Import 的事务中按表名进行
+type tableRepo[T any] interface {
+	List() ([]*T, error)
+	ListRaw() ([]*T, error)
+}
+
+type module struct {
+	name  string
+	dump  func(d *db.DB, encrypted bool) (list any, n int, err error)
+	parse func(data []byte) (list any, n int, err error)
+	write func(tx *sql.Tx, list any, replace bool) error
+}
+
+func newModule[T any](name string, newRepo func(d *db.DB) tableRepo[T]) module {
+	return module{
+		name: name,
+		dump: func(d *db.DB, encrypted bool) (any, int, error) {
+			repo := newRepo(d)
+			var list []*T
+			var err error
+			if encrypted {
+				list, err = repo.ListRaw()
+			} else {
+				list, err = repo.List()
+			}
+			if list == nil {
+				list = []*T{}
+			}
+			return list, len(list), err
+		},
+		parse: func(data []byte) (any, int, error) {
+			var list []*T
+			if err := json.Unmarshal(data, &list); err != nil {
+				return nil, 0, err
+			}
+			return list, len(list), nil
+		},
+		write: func(tx *sql.Tx, list any, replace bool) error {
+			if replace {
+				if err := db.DeleteWhereTx(tx, name, ""); err != nil {
+					return err
+				}
+			}
+			return db.UpsertManyTx(tx, name, list.([]*T))
+		},
+	}
+}
+
+var modules = []module{
+	newModule(diary.TABLE, func(d *db.DB) tableRepo[diary.Diary] { return diary.NewRepository(d) }),
+	newModule(bill.TABLE, func(d *db.DB) tableRepo[bill.Bill] { return bill.NewRepository(d) }),
+	newModule(bill.ProfileTable, func(d *db.DB) tableRepo[bill.Profile] { return bill.NewProfileRepository(d) }),
+	newModule(bill.RuleTable, func(d *db.DB) tableRepo[bill.Rule] { return bill.NewRuleRepository(d) }),
+	newModule(bill.RecurringTable, func(d *db.DB) tableRepo[bill.Recurring] { return bill.NewRecurringRepository(d) }),
+	newModule(bill.BudgetTable, func(d *db.DB) tableRepo[bill.Budget] { return bill.NewBudgetRepository(d) }),
+	newModule(bill.AccountTable, func(d *db.DB) tableRepo[bill.Account] { return bill.NewAccountRepository(d) }),
+	newModule(bill.TransferTable, func(d *db.DB) tableRepo[bill.Transfer] { return bill.NewTransferRepository(d) }),
+	newModule(bill.RateTable, func(d *db.DB) tableRepo[bill.Rate] { return bill.NewRateRepository(d) }),
+	newModule(bill.PersonTable, func(d *db.DB) tableRepo[bill.Person] { return bill.NewPersonRepository(d) }),
+	newModule(bill.SplitTable, func(d *db.DB) tableRepo[bill.Split] { return bill.NewSplitRepository(d) }),
+	newModule(bill.ShareTable, func(d *db.DB) tableRepo[bill.Share] { return bill.NewShareRepository(d) }),
+	newModule(interest.TABLE, func(d *db.DB) tableRepo[interest.Interest] { return interest.NewRepository(d) }),
+	newModule(note.TABLE, func(d *db.DB) tableRepo[note.Note] { return note.NewRepository(d) }),
+	newModule(note.SubtaskTable, func(d *db.DB) tableRepo[note.Subtask] { return note.NewSubtaskRepository(d) }),
+	newModule(note.ColumnTable, func(d *db.DB) tableRepo[note.Column] { return note.NewColumnRepository(d) }),
+	newModule(sport.TABLE, func(d *db.DB) tableRepo[sport.Sport] { return sport.NewRepository(d) }),
+	newModule(sport.GoalTable, func(d *db.DB) tableRepo[sport.Goal] { return sport.NewGoalRepository(d) }),
+	newModule(sport.PlanTable, func(d *db.DB) tableRepo[sport.Plan] { return sport.NewPlanRepository(d) }),
+	newModule(sport.WorkoutTable, func(d *db.DB) tableRepo[sport.Workout] { return sport.NewWorkoutRepository(d) }),
+	newModule(habit.TABLE, func(d *db.DB) tableRepo[habit.Habit] { return habit.NewRepository(d) }),
+	newModule(habit.CheckinTable, func(d *db.DB) tableRepo[habit.Checkin] { return habit.NewCheckinRepository(d) }),
+	newModule(attachment.TABLE, func(d *db.DB) tableRepo[attachment.Attachment] { return attachment.NewRepository(d, nil) }),
+}
+
+func findModule(name string) (module, bool) {
+	for _, m := range modules {
+		if m.name == name {
+			return m, true
+		}
+	}
+	return module{}, false
+}
+
+// Export 将所有模块和配置写入 zip
+func Export(w io.Writer, d *db.DB, opts ExportOptions) error {
+	cfg := config.GetRepository()
+	manifest := Manifest{
+		App:           appName,
+		SchemaVersion: SchemaVersion,
+		Created:       time.Now().Format(time.RFC3339),
+		Encrypted:     opts.Encrypted,
+		Modules:       map[string]ModuleEntry{},
+		Config:        configFile,
+	}
+	if opts.Encrypted {
+		// 加密数据只能导入到相同密钥的库，指纹单独加盐派生，不含登录密码的哈希
+		fp, err := db.KeyFingerprint(db.Key)
+		if err != nil {
+			return err
+		}
+		manifest.KeyFingerprint = fp
+	}
+
+	zw := zip.NewWriter(w)
+	for _, m := range modules {
+		list, n, err := m.dump(d, opts.Encrypted)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.name, err)
+		}
+		entry := ModuleEntry{Count: n, JSON: m.name + ".json", CSV: m.name + ".csv"}
+		if err := writeJSON(zw, entry.JSON, list); err != nil {
+			return err
+		}
+		if err := writeCSV(zw, entry.CSV, list); err != nil {
+			return err
+		}
+		manifest.Modules[m.name] = entry
+	}
+	n, err := writeBlobs(zw, d, opts.Encrypted)
+	if err != nil {
+		return err
+	}
+	manifest.Blobs = n
+	if err := writeJSON(zw, configFile, cfg.Editable()); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, manifestFile, manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Import 校验归档并导入所有模块
+func Import(r io.ReaderAt, size int64, d *db.DB, opts ImportOptions) (*ImportResult, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := readJSON(zr, manifestFile, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if err := validateManifest(&manifest); err != nil {
+		return nil, err
+	}
+
+	// 先全部解析校验，再写入数据库
+	parsed := map[string]any{}
+	for name, entry := range manifest.Modules {
+		m, ok := findModule(name)
+		if !ok {
+			return nil, errors.New("unknown module: " + name)
+		}
+		data, err := readFile(zr, entry.JSON)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		list, n, err := m.parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if n != entry.Count {
+			return nil, fmt.Errorf("%s: expected %d records, found %d", name, entry.Count, n)
+		}
+		parsed[name] = list
+	}
+
+	var cfgValues map[string]map[string]string
+	if opts.Config && manifest.Config != "" {
+		if err := readJSON(zr, manifest.Config, &cfgValues); err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+
+	blobs, err := readBlobs(zr, manifest.Blobs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Snapshot("import_all"); err != nil {
+		return nil, err
+	}
+	// 附件文件按内容寻址，先于数据库写入；数据库导入失败时多出的文件不被引用
+	if err := putBlobs(blobs, manifest.Encrypted); err != nil {
+		return nil, err
+	}
+
+	db.GlobalWriteMutex.Lock()
+	defer db.GlobalWriteMutex.Unlock()
+
+	// 所有模块在一个事务中写入，任一模块失败则整体回滚
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{Modules: map[string]int{}, Blobs: len(blobs)}
+	for _, m := range modules {
+		list, ok := parsed[m.name]
+		if !ok {
+			continue
+		}
+		if err := m.write(tx, list, opts.Replace); err != nil {
+			return nil, fmt.Errorf("%s: %w", m.name, err)
+		}
+		result.Modules[m.name] = manifest.Modules[m.name].Count
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	cfg := config.GetRepository()
+	for section, keys := range cfgValues {
+		for key, value := range keys {
+			if cfg.CheckValid(section, key, value) != nil {
+				continue
+			}
+			if err := cfg.Set(section, key, value); err != nil {
+				return result, err
+			}
+			result.Config++
+		}
+	}
+	return result, nil
+}
+
+func validateManifest(m *Manifest) error {
+	if m.App != appName {
+		return errors.New("not a diarygo archive")
+	}
+	if m.SchemaVersion < 1 || m.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("unsupported schema version %d (max %d)", m.SchemaVersion, SchemaVersion)
+	}
+	if m.Encrypted && !db.MatchKeyFingerprint(m.KeyFingerprint, db.Key) {
+		return errors.New("encrypted archive was made with a different password")
+	}
+	return nil
+}
+
+// writeBlobs 写入附件文件
+// 加密归档原样写入存储中的所有文件，不需要密码；明文归档只写入附件引用的文件并解密
+func writeBlobs(zw *zip.Writer, d *db.DB, encrypted bool) (int, error) {
+	store := blob.Get()
+	if store == nil {
+		return 0, nil
+	}
+	hashes, err := referencedBlobs(d, store, encrypted)
+	if err != nil {
+		return 0, err
+	}
+	for _, hash := range hashes {
+		var data []byte
+		if encrypted {
+			data, err = store.ReadRaw(hash)
+		} else {
+			data, err = store.Read(hash)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("blob %s: %w", hash, err)
+		}
+		f, err := zw.Create(blobDir + hash)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := f.Write(data); err != nil {
+			return 0, err
+		}
+	}
+	return len(hashes), nil
+}
+
+func referencedBlobs(d *db.DB, store *blob.Store, encrypted bool) ([]string, error) {
+	if encrypted {
+		return store.List()
+	}
+	list, err := attachment.NewRepository(d, nil).List()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var hashes []string
+	for _, a := range list {
+		for _, hash := range []string{a.Hash, a.Thumb} {
+			if hash != "" && !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes, nil
+}
+
+// readBlobs 读出归档中的附件文件，数量与清单不符时报错
+func readBlobs(zr *zip.Reader, count int) (map[string][]byte, error) {
+	blobs := map[string][]byte{}
+	for _, f := range zr.File {
+		hash, ok := strings.CutPrefix(f.Name, blobDir)
+		if !ok || hash == "" {
+			continue
+		}
+		data, err := readFile(zr, f.Name)
+		if err != nil {
+			return nil, fmt.Errorf("blob %s: %w", hash, err)
+		}
+		blobs[hash] = data
+	}
+	if len(blobs) != count {
+		return nil, fmt.Errorf("blobs: expected %d files, found %d", count, len(blobs))
+	}
+	if len(blobs) > 0 && blob.Get() == nil {
+		return nil, errors.New("archive has attachments but attachment storage is not configured")
+	}
+	return blobs, nil
+}
+
+// putBlobs 保存附件文件，明文归档按当前设置重新加密，写入前都会校验 hash
+// 加密归档中用其它密钥加密的文件在原库中也无法读取，直接跳过
+func putBlobs(blobs map[string][]byte, encrypted bool) error {
+	store := blob.Get()
+	for hash, data := range blobs {
+		if encrypted {
+			err := store.PutRaw(hash, data)
+			if err != nil && !errors.Is(err, blob.ErrWrongKey) {
+				return err
+			}
+			continue
+		}
+		if blob.Hash(data) != hash {
+			return fmt.Errorf("blob %s does not match its content", hash)
+		}
+		if _, err := store.Put(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeCSV(zw *zip.Writer, name string, list any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	return db.WriteCSV(f, list)
+}
+
+func readFile(zr *zip.Reader, name string) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func readJSON(zr *zip.Reader, name string, v any) error {
+	data, err := readFile(zr, name)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
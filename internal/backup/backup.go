@@ -2,6 +2,7 @@ package backup
 
 import (
 	"diarygo/internal/config"
+	"diarygo/internal/db"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,6 +21,50 @@ type Manager struct {
 	Interval time.Duration // 备份间隔，0表示不备份
 	Keep     int           // 保留最近N个备份
 	stop     chan struct{}
+
+	// opMu 串行化备份、快照和恢复，避免同时写同一个文件
+	// 加锁顺序为先 opMu 再 db.GlobalWriteMutex，持有 GlobalWriteMutex 时不能调用 db.Snapshot
+	opMu sync.Mutex
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastFile    string
+	lastError   string
+	lastErrorAt time.Time
+	nextRun     time.Time
+}
+
+// FileInfo 备份文件信息
+type FileInfo struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"mod_time"`
+}
+
+// Status 备份状态
+type Status struct {
+	Enabled     bool       `json:"enabled"`
+	Interval    string     `json:"interval"`
+	Keep        int        `json:"keep"`
+	Dir         string     `json:"dir"`
+	LastSuccess string     `json:"last_success"`
+	LastFile    string     `json:"last_file"`
+	LastError   string     `json:"last_error"`
+	LastErrorAt string     `json:"last_error_at"`
+	NextRun     string     `json:"next_run"`
+	Files       []FileInfo `json:"files"`
+}
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// nameLayout 备份文件名中的时间，精确到毫秒
+const nameLayout = "20060102_150405.000"
+
+var current *Manager
+
+// Get 返回当前备份管理器，未配置时为 nil
+func Get() *Manager {
+	return current
 }
 
 // NewManager 创建备份管理器
@@ -38,11 +84,13 @@ func (m *Manager) Run() {
 		return
 	}
 
+	m.setNextRun(time.Now().Add(m.Interval))
 	ticker := time.NewTicker(m.Interval)
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
+				m.setNextRun(time.Now().Add(m.Interval))
 				_ = m.CheckAndBackup()
 			case <-m.stop:
 				ticker.Stop()
@@ -62,6 +110,8 @@ func (m *Manager) CheckAndBackup() error {
 	if m.Interval <= 0 {
 		return nil
 	}
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
 
 	last, err := m.lastBackupTime()
 	if err != nil {
@@ -77,6 +127,171 @@ func (m *Manager) CheckAndBackup() error {
 	return m.createAndCleanup()
 }
 
+// RunNow 立即创建一次备份，返回备份文件名
+func (m *Manager) RunNow() (string, error) {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	name, err := m.create("")
+	if err != nil {
+		return "", err
+	}
+	return name, m.cleanup()
+}
+
+// Status 返回备份状态
+func (m *Manager) Status() Status {
+	files, _ := m.List()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := Status{
+		Enabled:   m.Interval > 0,
+		Interval:  m.Interval.String(),
+		Keep:      m.Keep,
+		Dir:       m.Dir,
+		LastFile:  m.lastFile,
+		LastError: m.lastError,
+		Files:     files,
+	}
+	if !m.lastSuccess.IsZero() {
+		s.LastSuccess = m.lastSuccess.Format(timeLayout)
+	} else if last, err := m.lastBackupTime(); err == nil {
+		// 重启后从文件名恢复上次备份时间
+		s.LastSuccess = last.Format(timeLayout)
+	}
+	if !m.lastErrorAt.IsZero() {
+		s.LastErrorAt = m.lastErrorAt.Format(timeLayout)
+	}
+	if !m.nextRun.IsZero() {
+		s.NextRun = m.nextRun.Format(timeLayout)
+	}
+	return s
+}
+
+// List 列出备份文件，新的在前
+func (m *Manager) List() ([]FileInfo, error) {
+	files, err := os.ReadDir(m.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []FileInfo{}, nil
+		}
+		return nil, err
+	}
+
+	list := make([]FileInfo, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !isBackupName(f.Name()) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, FileInfo{
+			Name:    f.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime().Format(timeLayout),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name > list[j].Name
+	})
+	return list, nil
+}
+
+func (m *Manager) setNextRun(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextRun = t
+}
+
+func (m *Manager) record(name string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.lastError = err.Error()
+		m.lastErrorAt = time.Now()
+		return
+	}
+	m.lastSuccess = time.Now()
+	m.lastFile = name
+	m.lastError = ""
+	m.lastErrorAt = time.Time{}
+}
+
+// Snapshot 在破坏性操作前创建带原因标签的备份，如 diary_20260129_150405.123_import_bill.db
+func (m *Manager) Snapshot(reason string) error {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	if _, err := m.create(sanitizeReason(reason)); err != nil {
+		return fmt.Errorf("snapshot before %s: %w", reason, err)
+	}
+	return m.cleanup()
+}
+
+// Restore 从备份文件恢复数据，恢复前先对当前数据做快照
+// 快照后的清理不能删掉要恢复的文件，即使它是最旧的一个
+func (m *Manager) Restore(name string) error {
+	if name != filepath.Base(name) || !isBackupName(name) {
+		return errors.New("invalid backup name: " + name)
+	}
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	path := filepath.Join(m.Dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	if _, err := m.create("restore"); err != nil {
+		return fmt.Errorf("snapshot before restore: %w", err)
+	}
+	if err := db.Get().RestoreFrom(path); err != nil {
+		return err
+	}
+	return m.cleanup()
+}
+
+func isBackupName(name string) bool {
+	return strings.HasPrefix(name, "diary_") && strings.HasSuffix(name, ".db")
+}
+
+// parseBackupName 解析备份文件名中的时间和原因标签，定时备份的标签为空
+// 旧版本的文件名只精确到秒，没有毫秒部分
+func parseBackupName(name string) (time.Time, string, bool) {
+	if !isBackupName(name) {
+		return time.Time{}, "", false
+	}
+	s := strings.TrimSuffix(strings.TrimPrefix(name, "diary_"), ".db")
+	layout := nameLayout
+	if len(s) < len(layout) || s[len("20060102_150405")] != '.' {
+		layout = "20060102_150405"
+	}
+	if len(s) < len(layout) {
+		return time.Time{}, "", false
+	}
+	t, err := time.ParseInLocation(layout, s[:len(layout)], time.Local)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return t, strings.TrimPrefix(s[len(layout):], "_"), true
+}
+
+func sanitizeReason(reason string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(reason) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_', c == '-':
+			b.WriteRune(c)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "snapshot"
+	}
+	return b.String()
+}
+
 // lastBackupTime 获取最近一次备份时间
 func (m *Manager) lastBackupTime() (time.Time, error) {
 	files, err := os.ReadDir(m.Dir)
@@ -90,13 +305,9 @@ func (m *Manager) lastBackupTime() (time.Time, error) {
 		if f.IsDir() {
 			continue
 		}
-		name := f.Name() // 假设格式 diary_20260129_150405.db
-		if !strings.HasPrefix(name, "diary_") || !strings.HasSuffix(name, ".db") {
-			continue
-		}
-		tsStr := strings.TrimSuffix(strings.TrimPrefix(name, "diary_"), ".db")
-		t, err := time.Parse("20060102_150405", tsStr)
-		if err != nil {
+		// 格式 diary_20260129_150405.123.db，带标签的快照不影响定时备份
+		t, reason, ok := parseBackupName(f.Name())
+		if !ok || reason != "" {
 			continue
 		}
 		if !found || t.After(latest) {
@@ -112,31 +323,63 @@ func (m *Manager) lastBackupTime() (time.Time, error) {
 
 // createAndCleanup 创建备份并清理旧文件
 func (m *Manager) createAndCleanup() error {
-	now := time.Now()
-	backupFile := fmt.Sprintf("%s/diary_%s.db", m.Dir, now.Format("20060102_150405"))
+	if _, err := m.create(""); err != nil {
+		return err
+	}
+	return m.cleanup()
+}
+
+// create 创建备份文件并记录结果
+func (m *Manager) create(reason string) (string, error) {
+	name, err := m.copyDB(reason)
+	m.record(name, err)
+	return name, err
+}
 
+func (m *Manager) copyDB(reason string) (string, error) {
 	// 保证目录存在
 	if err := os.MkdirAll(m.Dir, 0755); err != nil {
-		return err
+		return "", err
+	}
+
+	// 将 WAL 中的内容写回主库，保证复制的文件完整
+	if err := db.Checkpoint(); err != nil {
+		return "", err
 	}
 
 	src, err := os.Open(m.DBPath)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer src.Close()
 
-	dst, err := os.Create(backupFile)
+	name, dst, err := m.createFile(reason)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer dst.Close()
 
 	if _, err := io.Copy(dst, src); err != nil {
-		return err
+		return "", err
 	}
+	return name, dst.Sync()
+}
 
-	return m.cleanup()
+// createFile 新建备份文件，同一毫秒内已有同名文件时顺延一毫秒
+func (m *Manager) createFile(reason string) (string, *os.File, error) {
+	t := time.Now()
+	for {
+		name := fmt.Sprintf("diary_%s.db", t.Format(nameLayout))
+		if reason != "" {
+			name = fmt.Sprintf("diary_%s_%s.db", t.Format(nameLayout), reason)
+		}
+		f, err := os.OpenFile(filepath.Join(m.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			t = t.Add(time.Millisecond)
+			continue
+		}
+		return name, f, err
+	}
 }
 
 // cleanup 删除多余的旧备份
@@ -146,45 +389,52 @@ func (m *Manager) cleanup() error {
 		return err
 	}
 
-	var backups []os.DirEntry
+	// 定时备份和快照分别保留 Keep 个，避免频繁导入挤掉定时备份
+	var backups, snapshots []string
 	for _, f := range files {
 		if f.IsDir() {
 			continue
 		}
-		name := f.Name()
-		if strings.HasPrefix(name, "diary_") && strings.HasSuffix(name, ".db") {
-			backups = append(backups, f)
+		_, reason, ok := parseBackupName(f.Name())
+		if !ok {
+			continue
+		}
+		if reason == "" {
+			backups = append(backups, f.Name())
+		} else {
+			snapshots = append(snapshots, f.Name())
 		}
 	}
 
-	if len(backups) <= m.Keep {
-		return nil
+	m.removeOldest(backups)
+	m.removeOldest(snapshots)
+	return nil
+}
+
+func (m *Manager) removeOldest(names []string) {
+	if len(names) <= m.Keep {
+		return
 	}
 
 	// 按文件名升序排序（旧的在前）
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i].Name() < backups[j].Name()
-	})
+	sort.Strings(names)
 
-	for i := 0; i < len(backups)-m.Keep; i++ {
-		_ = os.Remove(filepath.Join(m.Dir, backups[i].Name()))
+	for i := 0; i < len(names)-m.Keep; i++ {
+		_ = os.Remove(filepath.Join(m.Dir, names[i]))
 	}
-
-	return nil
 }
 
-func StartBackup(cfg *config.Repository) *Manager {
+// Setup 根据配置创建备份管理器并注册快照钩子，不启动定时备份
+func Setup(cfg *config.Repository) *Manager {
 	dbPath := cfg.Get("global", "db_name")
 	if dbPath == "" {
 		dbPath = "data/diary.db"
 	}
 
+	// interval 为 0 时不做定时备份，但仍可手动备份
 	interval, _ := time.ParseDuration(
 		cfg.Get("backup", "interval"),
 	)
-	if interval <= 0 {
-		return nil
-	}
 	keep := cfg.GetInt("backup", "keep", 7)
 
 	backupDir := cfg.Get("backup", "dir")
@@ -198,6 +448,16 @@ func StartBackup(cfg *config.Repository) *Manager {
 		interval,
 		keep,
 	)
+	current = m
+	db.SetSnapshotHook(m.Snapshot)
+	return m
+}
+
+func StartBackup(cfg *config.Repository) *Manager {
+	m := Setup(cfg)
+	if m == nil {
+		return nil
+	}
 
 	m.CheckAndBackup() // 启动立即检查
 	m.Run()
@@ -0,0 +1,413 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"diarygo/internal/db"
+)
+
+// 加密文件格式：magic + 盐(16) + 校验值(8) + nonce(12) + AES-GCM 密文
+// 密钥和校验值由密码和盐经 PBKDF2 得出，同一存储的文件共用一个盐，盐随文件保存，复制到其它存储后仍能解密
+// 未加密的文件直接保存原始内容
+var magic = []byte("DGB2")
+
+// legacyMagic 旧格式：magic + 密钥指纹(8) + nonce(12) + 密文，密钥为密码的 sha256，改密时转为新格式
+var legacyMagic = []byte("DGB1")
+
+const (
+	saltSize        = 16
+	checkSize       = 8
+	fingerprintSize = 8
+)
+
+// saltFile 存储目录中保存盐的文件，不是 hash 形式的文件名，不会被当作内容
+const saltFile = "salt"
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ErrWrongKey 文件是用其它密钥加密的
+var ErrWrongKey = errors.New("blob is encrypted with another key")
+
+// Store 按内容的 sha256 寻址的文件存储，相同内容只保存一份
+// 文件保存在 Dir/前两位/完整 hash
+type Store struct {
+	Dir     string
+	Encrypt bool // 新写入的文件是否用用户密钥加密，没有密码时不加密
+
+	saltMu sync.Mutex
+	salt   []byte
+}
+
+var current *Store
+
+// Get 返回当前存储，未启动时为 nil
+func Get() *Store {
+	return current
+}
+
+func NewStore(dir string, encrypt bool) *Store {
+	return &Store{Dir: dir, Encrypt: encrypt}
+}
+
+// Setup 创建当前使用的附件存储，并在改密时重新加密已有文件
+func Setup(dir string, encrypt bool) *Store {
+	s := NewStore(dir, encrypt)
+	current = s
+	db.SetRekeyHook(func(oldKey, newKey string) (db.FileRekey, error) {
+		return s.PrepareRekey(oldKey, newKey)
+	})
+	return s
+}
+
+// Hash 内容的地址
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) path(hash string) (string, error) {
+	if !hashPattern.MatchString(hash) {
+		return "", fmt.Errorf("invalid blob hash %q", hash)
+	}
+	return filepath.Join(s.Dir, hash[:2], hash), nil
+}
+
+// Put 保存内容并返回 hash，内容已存在时不重复写入
+func (s *Store) Put(data []byte) (string, error) {
+	hash := Hash(data)
+	path, err := s.path(hash)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	out := data
+	if s.Encrypt && db.Key != "" {
+		if out, err = s.seal(data, db.Key); err != nil {
+			return "", err
+		}
+	}
+	return hash, writeFile(path, out)
+}
+
+// Read 读取并按需解密内容
+func (s *Store) Read(hash string) ([]byte, error) {
+	path, err := s.path(hash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted(data) {
+		return data, nil
+	}
+	return open(data, db.Key)
+}
+
+// ReadRaw 读取磁盘上的原始内容，加密的文件不解密，用于加密归档
+func (s *Store) ReadRaw(hash string) ([]byte, error) {
+	path, err := s.path(hash)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// PutRaw 写入 ReadRaw 读出的内容，按当前密钥解密后校验 hash
+func (s *Store) PutRaw(hash string, data []byte) error {
+	path, err := s.path(hash)
+	if err != nil {
+		return err
+	}
+	plain := data
+	if encrypted(data) {
+		if plain, err = open(data, db.Key); err != nil {
+			return err
+		}
+	}
+	if Hash(plain) != hash {
+		return fmt.Errorf("blob %s does not match its content", hash)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return writeFile(path, data)
+}
+
+// List 返回所有文件的 hash
+func (s *Store) List() ([]string, error) {
+	var list []string
+	err := filepath.WalkDir(s.Dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == s.Dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !e.IsDir() && hashPattern.MatchString(e.Name()) {
+			list = append(list, e.Name())
+		}
+		return nil
+	})
+	return list, err
+}
+
+// Remove 删除文件，文件不存在时忽略
+func (s *Store) Remove(hash string) error {
+	path, err := s.path(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// stagedSuffix 改密时新内容先写到原文件旁边，文件名不是 hash 形式，不会被当作内容
+const stagedSuffix = ".rekey"
+
+// Rekey 改密时准备好的文件，原文件在 Commit 之前保持不变
+type Rekey struct {
+	paths []string
+}
+
+// PrepareRekey 把 oldKey 加密的文件用 newKey 重新加密，写到原文件旁边
+// 已是 newKey 的文件会跳过，失败时丢弃已写出的文件
+func (s *Store) PrepareRekey(oldKey, newKey string) (*Rekey, error) {
+	rk := &Rekey{}
+	err := filepath.WalkDir(s.Dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == s.Dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if e.IsDir() || !hashPattern.MatchString(e.Name()) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !encrypted(data) || sealedWith(data, newKey) {
+			return nil
+		}
+		plain, err := open(data, oldKey)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		out := plain
+		if newKey != "" {
+			if out, err = s.seal(plain, newKey); err != nil {
+				return err
+			}
+		}
+		if err := writeFile(path+stagedSuffix, out); err != nil {
+			return err
+		}
+		rk.paths = append(rk.paths, path)
+		return nil
+	})
+	if err != nil {
+		rk.Abort()
+		return nil, err
+	}
+	return rk, nil
+}
+
+// Commit 用新内容替换原文件，某个文件失败时继续处理其余的，返回第一个错误
+func (rk *Rekey) Commit() error {
+	var first error
+	for _, path := range rk.paths {
+		if err := os.Rename(path+stagedSuffix, path); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Abort 丢弃准备好的文件
+func (rk *Rekey) Abort() {
+	for _, path := range rk.paths {
+		os.Remove(path + stagedSuffix)
+	}
+}
+
+// storeSalt 返回存储的盐，第一次加密时生成并保存
+func (s *Store) storeSalt() ([]byte, error) {
+	s.saltMu.Lock()
+	defer s.saltMu.Unlock()
+	if s.salt != nil {
+		return s.salt, nil
+	}
+	path := filepath.Join(s.Dir, saltFile)
+	salt, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		salt = make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		err = writeFile(path, salt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(salt) != saltSize {
+		return nil, fmt.Errorf("invalid blob salt in %s", path)
+	}
+	s.salt = salt
+	return salt, nil
+}
+
+// sealer 由密码和盐得出的加密器和校验值
+type sealer struct {
+	aead  cipher.AEAD
+	check []byte
+}
+
+// sealers 缓存得出的密钥，PBKDF2 较慢，同一存储的文件共用一个盐
+var sealers sync.Map
+
+func sealerFor(key string, salt []byte) (*sealer, error) {
+	id := string(salt) + "\x00" + key
+	if v, ok := sealers.Load(id); ok {
+		return v.(*sealer), nil
+	}
+	k, err := db.DeriveKey(key, salt, 32+checkSize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k[:32])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sl := &sealer{aead: aead, check: k[32:]}
+	sealers.Store(id, sl)
+	return sl, nil
+}
+
+// encrypted 是否为加密文件，包括旧格式
+func encrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic) || bytes.HasPrefix(data, legacyMagic)
+}
+
+// sealedWith 是否已是用 key 加密的新格式文件
+func sealedWith(data []byte, key string) bool {
+	if key == "" || !bytes.HasPrefix(data, magic) || len(data) < len(magic)+saltSize+checkSize {
+		return false
+	}
+	salt := data[len(magic) : len(magic)+saltSize]
+	sl, err := sealerFor(key, salt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(data[len(magic)+saltSize:len(magic)+saltSize+checkSize], sl.check) == 1
+}
+
+func (s *Store) seal(data []byte, key string) ([]byte, error) {
+	salt, err := s.storeSalt()
+	if err != nil {
+		return nil, err
+	}
+	sl, err := sealerFor(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, sl.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(magic)+saltSize+checkSize+len(nonce)+len(data)+sl.aead.Overhead())
+	out = append(out, magic...)
+	out = append(out, salt...)
+	out = append(out, sl.check...)
+	out = append(out, nonce...)
+	return sl.aead.Seal(out, nonce, data, nil), nil
+}
+
+func open(data []byte, key string) ([]byte, error) {
+	if bytes.HasPrefix(data, legacyMagic) {
+		return openLegacy(data, key)
+	}
+	if !sealedWith(data, key) {
+		return nil, ErrWrongKey
+	}
+	sl, err := sealerFor(key, data[len(magic):len(magic)+saltSize])
+	if err != nil {
+		return nil, err
+	}
+	return openAEAD(sl.aead, data[len(magic)+saltSize+checkSize:])
+}
+
+func openAEAD(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("blob is truncated")
+	}
+	nonce, data := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, data, nil)
+}
+
+// openLegacy 解密旧格式的文件
+func openLegacy(data []byte, key string) ([]byte, error) {
+	if key == "" || len(data) < len(legacyMagic)+fingerprintSize ||
+		!bytes.Equal(data[len(legacyMagic):len(legacyMagic)+fingerprintSize], legacyFingerprint(key)) {
+		return nil, ErrWrongKey
+	}
+	k := sha256.Sum256([]byte("diarygo-blob:" + key))
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return openAEAD(aead, data[len(legacyMagic)+fingerprintSize:])
+}
+
+func legacyFingerprint(key string) []byte {
+	sum := sha256.Sum256([]byte("diarygo-blob-fingerprint:" + key))
+	return sum[:fingerprintSize]
+}
+
+// writeFile 先写临时文件再改名，避免中断时留下不完整的文件
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,263 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"diarygo/internal/archive"
+	"diarygo/internal/backup"
+	"diarygo/internal/blob"
+	"diarygo/internal/config"
+	"diarygo/internal/db"
+	"diarygo/internal/pydiary"
+	"diarygo/internal/utils"
+	"diarygo/internal/vault"
+)
+
+const usage = `usage: diarygo [command] [options]
+
+commands:
+  (none)           start the web server
+  export           export all data into a zip archive
+  import           import a zip archive made by export
+  export-markdown  write the diary as a Markdown vault
+  import-markdown  read a Markdown vault back into the diary
+  import-pydiary   import a database file from pydiary
+`
+
+// Run 执行子命令
+func Run(args []string) error {
+	switch args[0] {
+	case "export":
+		return runExport(args[1:])
+	case "import":
+		return runImport(args[1:])
+	case "export-markdown":
+		return runExportMarkdown(args[1:])
+	case "import-markdown":
+		return runImportMarkdown(args[1:])
+	case "import-pydiary":
+		return runImportPydiary(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	}
+	fmt.Print(usage)
+	return errors.New("unknown command: " + args[0])
+}
+
+// openDB 打开数据库，校验密码并设置加密密钥
+func openDB(password string, checkPassword bool) (*db.DB, error) {
+	cfg := config.GetRepository()
+	if checkPassword {
+		if !cfg.CheckPassword(password) {
+			return nil, errors.New("password incorrect")
+		}
+		db.Key = password
+	}
+	db.Init(cfg.Get("global", "db_name"))
+	backup.Setup(cfg)
+	blob.Setup(cfg.Get("attachment", "dir"), cfg.Get("attachment", "encrypt") == "1")
+	if err := db.RunMigrations(db.Get()); err != nil {
+		return nil, err
+	}
+	if checkPassword {
+		if err := db.Get().EnsureKeyFingerprint(); err != nil {
+			return nil, err
+		}
+	}
+	return db.Get(), nil
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", fmt.Sprintf("diarygo_%s.zip", utils.GetNowYYMMDD()), "output file")
+	password := fs.String("password", "", "login password, required unless -encrypted")
+	encrypted := fs.Bool("encrypted", false, "keep data encrypted with the current password")
+	fs.Parse(args)
+
+	d, err := openDB(*password, !*encrypted)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := archive.Export(f, d, archive.ExportOptions{Encrypted: *encrypted}); err != nil {
+		return err
+	}
+	fmt.Println("exported to", *output)
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	password := fs.String("password", "", "login password")
+	replace := fs.Bool("replace", false, "clear existing records before import")
+	withConfig := fs.Bool("config", false, "also import configuration")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: diarygo import [options] <archive.zip>")
+	}
+
+	d, err := openDB(*password, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	res, err := archive.Import(f, info.Size(), d, archive.ImportOptions{
+		Replace: *replace,
+		Config:  *withConfig,
+	})
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(res.Modules))
+	for name := range res.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-10s %d\n", name, res.Modules[name])
+	}
+	if *withConfig {
+		fmt.Printf("%-10s %d\n", "config", res.Config)
+	}
+	return nil
+}
+
+func runExportMarkdown(args []string) error {
+	fs := flag.NewFlagSet("export-markdown", flag.ExitOnError)
+	password := fs.String("password", "", "login password")
+	layout := fs.String("layout", "", "file layout, e.g. YYYY/MM/YYYY-MM-DD.md")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: diarygo export-markdown [options] <dir>")
+	}
+	dir := fs.Arg(0)
+
+	d, err := openDB(*password, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *layout == "" {
+		*layout = config.GetRepository().Get("markdown", "layout")
+	}
+	n, err := vault.Export(d, *layout, func(name string, data []byte) error {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(p, data, 0644)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("exported %d days to %s\n", n, dir)
+	return nil
+}
+
+func runImportMarkdown(args []string) error {
+	fs := flag.NewFlagSet("import-markdown", flag.ExitOnError)
+	password := fs.String("password", "", "login password")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: diarygo import-markdown [options] <dir>")
+	}
+
+	d, err := openDB(*password, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, skipped, err := vault.Import(d, os.DirFS(fs.Arg(0)))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d days, skipped %d files without a date\n", n, skipped)
+	return nil
+}
+
+func runImportPydiary(args []string) error {
+	fs := flag.NewFlagSet("import-pydiary", flag.ExitOnError)
+	password := fs.String("password", "", "login password")
+	pyPassword := fs.String("pydiary-password", "", "pydiary password, defaults to -password")
+	strategy := fs.String("strategy", string(db.StrategyNaturalKey), "overwrite, skip, append or natural_key")
+	dryRun := fs.Bool("dry-run", false, "only report what would be imported")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: diarygo import-pydiary [options] <pydiary.db>")
+	}
+	st, err := db.ParseImportStrategy(*strategy)
+	if err != nil {
+		return err
+	}
+	if *pyPassword == "" {
+		*pyPassword = *password
+	}
+
+	d, err := openDB(*password, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	results, err := pydiary.Import(fs.Arg(0), d, pydiary.Options{
+		Password: *pyPassword,
+		Strategy: st,
+		DryRun:   *dryRun,
+	})
+	if len(results) > 0 {
+		printPydiaryResults(results)
+	}
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Println("dry run, nothing written")
+	}
+	return nil
+}
+
+func printPydiaryResults(results []pydiary.TableResult) {
+	fmt.Printf("%-10s %6s %8s %10s %9s %8s\n", "table", "new", "changed", "unchanged", "conflict", "skipped")
+	for _, res := range results {
+		if res.Missing {
+			fmt.Printf("%-10s (not found)\n", res.Table)
+			continue
+		}
+		rep := res.Report
+		fmt.Printf("%-10s %6d %8d %10d %9d %8d\n", res.Table, rep.New, rep.Changed, rep.Unchanged, rep.Conflict, rep.Invalid)
+		for _, row := range rep.Rows {
+			if row.Status == db.RowInvalid {
+				fmt.Printf("  skipped row %d: %s\n", row.Row-1, row.Reason)
+			}
+		}
+		if len(res.Ignored) > 0 {
+			fmt.Printf("  ignored columns: %v\n", res.Ignored)
+		}
+	}
+}
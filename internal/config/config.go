@@ -2,9 +2,12 @@ package config
 
 import (
 	"crypto/md5"
+	"database/sql"
 	"diarygo/internal/db"
+	"diarygo/internal/entity/attachment"
 	"diarygo/internal/entity/bill"
 	"diarygo/internal/entity/diary"
+	"diarygo/internal/entity/habit"
 	"diarygo/internal/entity/interest"
 	"diarygo/internal/entity/note"
 	"diarygo/internal/entity/sport"
@@ -61,6 +64,20 @@ var defaultConfig = map[string]map[string]string{
 		"keep":     "7",
 		"dir":      "data/backup",
 	},
+	"markdown": {
+		"layout": "YYYY/MM/YYYY-MM-DD.md",
+	},
+	"recurring": {
+		"interval": "1h",
+	},
+	"bill": {
+		"base_currency": "CNY",
+	},
+	"attachment": {
+		"dir":      "data/attachments",
+		"encrypt":  "1",
+		"max_size": "20", // MB
+	},
 }
 
 var editableConfig = map[string]map[string]ConfigRule{
@@ -101,6 +118,21 @@ var editableConfig = map[string]map[string]ConfigRule{
 		"keep":     {},
 		"dir":      {},
 	},
+	"markdown": {
+		"layout": {MaxLen: 64},
+	},
+	"recurring": {
+		"interval": {},
+	},
+	"attachment": {
+		"encrypt": {
+			AllowedValues: []string{"0", "1"},
+		},
+		"max_size": {},
+	},
+	"bill": {
+		"base_currency": {MaxLen: 3},
+	},
 }
 
 var (
@@ -173,6 +205,18 @@ func (r *Repository) CheckValid(section, key, value string) error {
 	return nil
 }
 
+// Editable 返回所有可编辑配置项的当前值
+func (r *Repository) Editable() map[string]map[string]string {
+	out := make(map[string]map[string]string, len(editableConfig))
+	for section, keys := range editableConfig {
+		out[section] = make(map[string]string, len(keys))
+		for key := range keys {
+			out[section][key] = r.Get(section, key)
+		}
+	}
+	return out
+}
+
 func (r *Repository) Get(section, key string) string {
 	def := defaultConfig[section][key]
 	return r.GetWithDefault(section, key, def)
@@ -182,18 +226,12 @@ func (r *Repository) GetWithDefault(section, key, def string) string {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	sec := r.cfg.Section(section)
-	if sec == nil {
+	// Section/Key 会自动创建空值，旧配置文件缺少新增的配置项时需返回默认值
+	sec, err := r.cfg.GetSection(section)
+	if err != nil || !sec.HasKey(key) {
 		return def
 	}
-
-	keyObj := sec.Key(key)
-	if keyObj == nil {
-		return def
-	}
-
-	val := keyObj.String()
-	return val
+	return sec.Key(key).String()
 }
 
 func (r *Repository) GetBool(section, key string) bool {
@@ -243,63 +281,102 @@ func (r *Repository) CheckPassword(input string) bool {
 }
 
 func (r *Repository) ChangePassword(d *db.DB, oldPwd, newPwd string) error {
+	if !r.CheckPassword(oldPwd) {
+		return errors.New("old password incorrect")
+	}
+	// 快照记下旧密钥的指纹，改密后不能再直接恢复
+	if err := d.EnsureKeyFingerprint(); err != nil {
+		return err
+	}
+	// 快照要在加写锁之前做，与恢复备份的加锁顺序一致
+	if err := db.Snapshot("rekey"); err != nil {
+		return err
+	}
+
 	db.GlobalWriteMutex.Lock()
 	defer db.GlobalWriteMutex.Unlock()
 
-	if !r.CheckPassword(oldPwd) {
-		return errors.New("old password incorrect")
+	// 先用旧密钥读出所有表，再用新密钥写回
+	loaders := []rekeyLoader{
+		rekeyTable(diary.NewRepository(d).BaseRepository),
+		rekeyTable(bill.NewRepository(d).BaseRepository),
+		rekeyTable(bill.NewProfileRepository(d).BaseRepository),
+		rekeyTable(bill.NewRuleRepository(d).BaseRepository),
+		rekeyTable(bill.NewRecurringRepository(d).BaseRepository),
+		rekeyTable(bill.NewBudgetRepository(d).BaseRepository),
+		rekeyTable(bill.NewAccountRepository(d).BaseRepository),
+		rekeyTable(bill.NewTransferRepository(d).BaseRepository),
+		rekeyTable(bill.NewRateRepository(d).BaseRepository),
+		rekeyTable(bill.NewPersonRepository(d).BaseRepository),
+		rekeyTable(bill.NewSplitRepository(d).BaseRepository),
+		rekeyTable(attachment.NewRepository(d, nil).BaseRepository),
+		rekeyTable(interest.NewRepository(d).BaseRepository),
+		rekeyTable(note.NewRepository(d).BaseRepository),
+		rekeyTable(note.NewSubtaskRepository(d).BaseRepository),
+		rekeyTable(note.NewColumnRepository(d).BaseRepository),
+		rekeyTable(sport.NewRepository(d).BaseRepository),
+		rekeyTable(sport.NewGoalRepository(d).BaseRepository),
+		rekeyTable(sport.NewPlanRepository(d).BaseRepository),
+		rekeyTable(sport.NewWorkoutRepository(d).BaseRepository),
+		rekeyTable(habit.NewRepository(d).BaseRepository),
+		rekeyTable(habit.NewCheckinRepository(d).BaseRepository),
+	}
+	writers := make([]func(tx *sql.Tx) error, 0, len(loaders))
+	for _, load := range loaders {
+		w, err := load()
+		if err != nil {
+			return err
+		}
+		writers = append(writers, w)
 	}
 
-	diaryList, err := diary.NewRepository(d).List()
+	// 附件等文件先写出新内容，所有表在一个事务中写回后再替换，失败时都保持旧密钥
+	files, err := db.RekeyFiles(db.Key, newPwd)
 	if err != nil {
 		return err
 	}
-	billList, err := bill.NewRepository(d).List()
-	if err != nil {
+	oldKey := db.Key
+	db.Key = newPwd
+	if err := writeTables(d, writers); err != nil {
+		db.Key = oldKey
+		files.Abort()
 		return err
 	}
-	interestList, err := interest.NewRepository(d).List()
-	if err != nil {
+	if err := files.Commit(); err != nil {
 		return err
 	}
-	noteList, err := note.NewRepository(d).List()
-	if err != nil {
+	if err := r.SetPassword(newPwd); err != nil {
 		return err
 	}
-	sportList, err := sport.NewRepository(d).List()
+	return d.SaveKeyFingerprint()
+}
+
+// writeTables 在一个事务中用当前密钥写回所有表
+func writeTables(d *db.DB, writers []func(tx *sql.Tx) error) error {
+	tx, err := d.Conn.Begin()
 	if err != nil {
 		return err
 	}
-
-	db.Key = newPwd
-
-	if len(diaryList) > 0 {
-		if err := diary.NewRepository(d).UpdateMany(diaryList); err != nil {
-			return err
-		}
-	}
-	if len(billList) > 0 {
-		if err := bill.NewRepository(d).UpdateMany(billList); err != nil {
+	defer tx.Rollback()
+	for _, w := range writers {
+		if err := w(tx); err != nil {
 			return err
 		}
 	}
-	if len(interestList) > 0 {
-		if err := interest.NewRepository(d).UpdateMany(interestList); err != nil {
-			return err
-		}
-	}
-	if len(noteList) > 0 {
-		if err := note.NewRepository(d).UpdateMany(noteList); err != nil {
-			return err
-		}
-	}
-	if len(sportList) > 0 {
-		if err := sport.NewRepository(d).UpdateMany(sportList); err != nil {
-			return err
+	return tx.Commit()
+}
+
+// rekeyLoader 用旧密钥读出一个表，返回在事务中用当前密钥写回的函数
+type rekeyLoader func() (func(tx *sql.Tx) error, error)
+
+func rekeyTable[T any](repo *db.BaseRepository[T]) rekeyLoader {
+	return func() (func(tx *sql.Tx) error, error) {
+		list, err := repo.List()
+		if err != nil {
+			return nil, err
 		}
+		return func(tx *sql.Tx) error {
+			return db.UpdateManyTx(tx, repo.Table, list)
+		}, nil
 	}
-	if err := r.SetPassword(newPwd); err != nil {
-		return err
-	}
-	return nil
 }
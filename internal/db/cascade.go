@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"diarygo/internal/utils"
+)
+
+// DeleteHook 删除记录时在同一事务中清理挂在记录上的数据（如附件）
+// 返回的函数在事务提交后调用（如删除不再引用的文件），可以为 nil
+type DeleteHook func(tx *sql.Tx, table string, ids []any) (func(), error)
+
+var deleteHooks []DeleteHook
+
+// OnDelete 登记删除钩子，在包的 init 中调用
+func OnDelete(fn DeleteHook) {
+	deleteHooks = append(deleteHooks, fn)
+}
+
+// CascadeTx 在事务中调用删除钩子，返回提交后要调用的函数
+func CascadeTx(tx *sql.Tx, table string, ids ...any) ([]func(), error) {
+	var after []func()
+	for _, fn := range deleteHooks {
+		f, err := fn(tx, table, ids)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			after = append(after, f)
+		}
+	}
+	return after, nil
+}
+
+// deleteIDs 在一个事务中删除记录和挂在记录上的数据
+func deleteIDs(d *DB, table string, ids []any) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", table, strings.Join(utils.MakePlaceholders(len(ids)), ", "))
+	if _, err := tx.Exec(q, EncryptArgs(append([]any(nil), ids...))...); err != nil {
+		return err
+	}
+	after, err := CascadeTx(tx, table, ids...)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, f := range after {
+		f()
+	}
+	return nil
+}
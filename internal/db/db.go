@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -73,14 +74,24 @@ func Close() {
 	}
 }
 
+// Checkpoint 将 WAL 写回主库文件，未初始化时忽略
+func Checkpoint() error {
+	if instance == nil {
+		return nil
+	}
+	_, err := instance.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`, nil, false)
+	return err
+}
+
 // ==========================
 // 加密 / 解密函数
 // ==========================
 
-const headEncrypt = "__en__"
+// EncryptPrefix 加密字符串的前缀
+const EncryptPrefix = "__en__"
 
 func encryptString(text string) string {
-	if Key == "" || strings.HasPrefix(text, headEncrypt) {
+	if Key == "" || strings.HasPrefix(text, EncryptPrefix) {
 		return text
 	}
 	runes := []rune(text)
@@ -88,16 +99,21 @@ func encryptString(text string) string {
 	for i := range runes {
 		runes[i] ^= keyRunes[i%len(keyRunes)]
 	}
-	return headEncrypt + string(runes)
+	return EncryptPrefix + string(runes)
 }
 
 func decryptString(text string) string {
-	if Key == "" || !strings.HasPrefix(text, headEncrypt) {
+	return DecryptWith(text, Key)
+}
+
+// DecryptWith 用指定密钥解密，用于读取其它库（如 pydiary）中的数据
+func DecryptWith(text, key string) string {
+	if key == "" || !strings.HasPrefix(text, EncryptPrefix) {
 		return text
 	}
-	text = text[len(headEncrypt):]
+	text = text[len(EncryptPrefix):]
 	runes := []rune(text)
-	keyRunes := []rune(Key)
+	keyRunes := []rune(key)
 	for i := range runes {
 		runes[i] ^= keyRunes[i%len(keyRunes)]
 	}
@@ -146,9 +162,17 @@ func (d *DB) ExecMany(sqlCmd string, argsList [][]any, encrypt bool) error {
 	if err != nil {
 		return err
 	}
+	if err := ExecManyTx(tx, sqlCmd, argsList, encrypt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ExecManyTx 在已有事务中批量执行，由调用方提交或回滚
+func ExecManyTx(tx *sql.Tx, sqlCmd string, argsList [][]any, encrypt bool) error {
 	stmt, err := tx.Prepare(sqlCmd)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
@@ -157,13 +181,11 @@ func (d *DB) ExecMany(sqlCmd string, argsList [][]any, encrypt bool) error {
 		if encrypt {
 			args = EncryptArgs(args)
 		}
-		_, err := stmt.Exec(args...)
-		if err != nil {
-			tx.Rollback()
+		if _, err := stmt.Exec(args...); err != nil {
 			return err
 		}
 	}
-	return tx.Commit()
+	return nil
 }
 
 func normalizeDBType(t string) string {
@@ -174,16 +196,22 @@ func normalizeDBType(t string) string {
 	return strings.TrimSpace(t)
 }
 
+func isDecimalType(t string) bool {
+	switch t {
+	case "DECIMAL", "NUMERIC", "REAL", "FLOAT", "DOUBLE":
+		return true
+	}
+	return false
+}
+
 func NormalizeValue(value any, colType *sql.ColumnType) any {
 	switch t := value.(type) {
 	case int64:
-		switch normalizeDBType(colType.DatabaseTypeName()) {
-		case "DECIMAL", "NUMERIC", "REAL", "FLOAT", "DOUBLE":
+		if isDecimalType(normalizeDBType(colType.DatabaseTypeName())) {
 			return float64(t)
 		}
 	case int:
-		switch normalizeDBType(colType.DatabaseTypeName()) {
-		case "DECIMAL", "NUMERIC", "REAL", "FLOAT", "DOUBLE":
+		if isDecimalType(normalizeDBType(colType.DatabaseTypeName())) {
 			return float64(t)
 		}
 	}
@@ -262,14 +290,26 @@ func UpdateMany[T any](d *DB, table string, list []*T) error {
 	if len(list) == 0 {
 		return errors.New("empty list")
 	}
+	sql, argsList := updateManyArgs(table, list)
+	return d.ExecMany(sql, argsList, true)
+}
+
+// UpdateManyTx 在事务中按 id 批量更新
+func UpdateManyTx[T any](tx *sql.Tx, table string, list []*T) error {
+	if len(list) == 0 {
+		return nil
+	}
+	sql, argsList := updateManyArgs(table, list)
+	return ExecManyTx(tx, sql, argsList, true)
+}
+
+func updateManyArgs[T any](table string, list []*T) (string, [][]any) {
 	cols, argsList := StructCols(list[0], true), StructArgsList(list, true)
 	set := make([]string, 0, len(cols)-1)
 	for _, c := range cols[:len(cols)-1] {
 		set = append(set, c+"=?")
 	}
-
-	sql := fmt.Sprintf("UPDATE %s SET %s WHERE id=?", table, strings.Join(set, ", "))
-	return d.ExecMany(sql, argsList, true)
+	return fmt.Sprintf("UPDATE %s SET %s WHERE id=?", table, strings.Join(set, ", ")), argsList
 }
 
 func StructCols(v any, idLast bool) []string {
@@ -326,10 +366,41 @@ func StructArgsList[T any](list []*T, idLast bool) [][]any {
 	return argsList
 }
 
+// StructTable 将结构体切片转换为表头和字符串行，用于 CSV 等文本格式
+func StructTable(list any) ([]string, [][]string) {
+	val := reflect.ValueOf(list)
+	typ := val.Type().Elem()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	headers := StructCols(reflect.New(typ).Interface(), false)
+
+	rows := make([][]string, 0, val.Len())
+	for i := 0; i < val.Len(); i++ {
+		args := StructArgs(val.Index(i).Interface(), false)
+		row := make([]string, len(args))
+		for j, a := range args {
+			row[j] = FormatValue(a)
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows
+}
+
+// FormatValue 将字段值转为文本，浮点数不使用科学计数法
+func FormatValue(v any) string {
+	switch x := v.(type) {
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32)
+	}
+	return fmt.Sprint(v)
+}
+
+// DeleteByID 删除记录，挂在记录上的数据（如附件）一并删除
 func DeleteByID(d *DB, table string, id any) error {
-	sql := fmt.Sprintf("DELETE FROM %s WHERE id=?", table)
-	_, err := d.Exec(sql, []any{id}, true)
-	return err
+	return deleteIDs(d, table, []any{id})
 }
 
 func DeleteWhere(d *DB, table string, where string, args ...any) error {
@@ -341,6 +412,16 @@ func DeleteWhere(d *DB, table string, where string, args ...any) error {
 	return err
 }
 
+// DeleteWhereTx 在事务中按条件删除
+func DeleteWhereTx(tx *sql.Tx, table string, where string, args ...any) error {
+	sql := fmt.Sprintf("DELETE FROM %s", table)
+	if where != "" {
+		sql += " WHERE " + where
+	}
+	_, err := tx.Exec(sql, EncryptArgs(args)...)
+	return err
+}
+
 func Delete[T any](d *DB, table string, obj *T) error {
 	val := reflect.ValueOf(obj)
 	if val.Kind() == reflect.Ptr {
@@ -364,17 +445,19 @@ func DeleteMany[T any](d *DB, table string, list []*T) error {
 		}
 		ids = append(ids, val.Field(0).Interface())
 	}
+	return deleteIDs(d, table, ids)
+}
 
-	placeholders := make([]string, len(ids))
-	for i := range placeholders {
-		placeholders[i] = "?"
-	}
+func SelectList[T any](d *DB, table string, query string, args ...any) ([]*T, error) {
+	return selectList[T](d, table, query, true, args...)
+}
 
-	where := fmt.Sprintf("id IN (%s)", strings.Join(placeholders, ", "))
-	return DeleteWhere(d, table, where, ids...)
+// SelectListRaw 与 SelectList 相同，但保留加密后的字段
+func SelectListRaw[T any](d *DB, table string, query string, args ...any) ([]*T, error) {
+	return selectList[T](d, table, query, false, args...)
 }
 
-func SelectList[T any](d *DB, table string, query string, args ...any) ([]*T, error) {
+func selectList[T any](d *DB, table string, query string, decrypt bool, args ...any) ([]*T, error) {
 	var zero T
 	cols := StructCols(zero, false)
 
@@ -383,7 +466,7 @@ func SelectList[T any](d *DB, table string, query string, args ...any) ([]*T, er
 		sql += " " + query
 	}
 
-	rows, err := d.Select(sql, args, true)
+	rows, err := d.Select(sql, args, decrypt)
 	if err != nil {
 		return nil, err
 	}
@@ -510,23 +593,45 @@ func Add[T any](d *DB, table string, v *T) (*T, error) {
 	return SelectLast[T](d, table)
 }
 
+// InsertTx 在事务中插入一条记录，返回新 id
+func InsertTx(tx *sql.Tx, table string, v any) (int, error) {
+	cols := StructCols(v, false)[1:]
+	args := EncryptArgs(StructArgs(v, false)[1:])
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table, strings.Join(cols, ", "), strings.Join(utils.MakePlaceholders(len(cols)), ", "))
+	res, err := tx.Exec(q, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
 func AddMany[T any](d *DB, table string, list []*T) error {
 	if len(list) == 0 {
 		return nil
 	}
+	sql, argsList := addManyArgs(table, list)
+	return d.ExecMany(sql, argsList, true)
+}
 
-	cols := StructCols(*list[0], false)[1:]
-
-	placeholders := make([]string, len(cols))
-	for i := range placeholders {
-		placeholders[i] = "?"
+// AddManyTx 在事务中批量插入
+func AddManyTx[T any](tx *sql.Tx, table string, list []*T) error {
+	if len(list) == 0 {
+		return nil
 	}
+	sql, argsList := addManyArgs(table, list)
+	return ExecManyTx(tx, sql, argsList, true)
+}
+
+func addManyArgs[T any](table string, list []*T) (string, [][]any) {
+	cols := StructCols(*list[0], false)[1:]
 
 	sql := fmt.Sprintf(
 		"INSERT INTO %s (%s) VALUES (%s)",
 		table,
 		strings.Join(cols, ", "),
-		strings.Join(placeholders, ", "),
+		strings.Join(utils.MakePlaceholders(len(cols)), ", "),
 	)
 
 	// 统一用 StructArgsList
@@ -534,8 +639,7 @@ func AddMany[T any](d *DB, table string, list []*T) error {
 	for i := range argsList {
 		argsList[i] = argsList[i][1:] // 去掉 id
 	}
-
-	return d.ExecMany(sql, argsList, true)
+	return sql, argsList
 }
 
 func Upsert[T any](d *DB, table string, obj *T) error {
@@ -558,7 +662,20 @@ func UpsertMany[T any](d *DB, table string, list []*T) error {
 	if len(list) == 0 {
 		return nil
 	}
+	sql, argsList := upsertManyArgs(table, list)
+	return d.ExecMany(sql, argsList, true)
+}
+
+// UpsertManyTx 在事务中按 id 批量覆盖
+func UpsertManyTx[T any](tx *sql.Tx, table string, list []*T) error {
+	if len(list) == 0 {
+		return nil
+	}
+	sql, argsList := upsertManyArgs(table, list)
+	return ExecManyTx(tx, sql, argsList, true)
+}
 
+func upsertManyArgs[T any](table string, list []*T) (string, [][]any) {
 	cols := StructCols(list[0], true)      // 假设所有对象字段一致
 	argsList := StructArgsList(list, true) // 批量参数
 
@@ -568,6 +685,5 @@ func UpsertMany[T any](d *DB, table string, list []*T) error {
 		strings.Join(cols, ", "),
 		strings.Join(utils.MakePlaceholders(len(cols)), ", "),
 	)
-
-	return d.ExecMany(sql, argsList, true)
+	return sql, argsList
 }
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// 密钥指纹用于判断备份、快照和归档是否由当前密钥加密
+// 加盐的 PBKDF2，与登录密码的哈希无关，指纹可以随归档带出
+
+const metaTable = "db_meta"
+const sqlCreateMeta = `
+	CREATE TABLE IF NOT EXISTS db_meta (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL DEFAULT ""
+	);`
+
+const metaKeyFingerprint = "key_fingerprint"
+
+const fingerprintIter = 100000
+
+// ErrKeyMismatch 数据由其它密钥加密
+var ErrKeyMismatch = errors.New("data was encrypted with a different password")
+
+// KeyFingerprint 生成 key 的指纹，格式为 盐$哈希
+func KeyFingerprint(key string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	sum, err := DeriveKey(key, salt, 32)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt) + "$" + hex.EncodeToString(sum), nil
+}
+
+// MatchKeyFingerprint 判断指纹是否由 key 生成
+func MatchKeyFingerprint(fp, key string) bool {
+	saltHex, sumHex, ok := strings.Cut(fp, "$")
+	if !ok {
+		return false
+	}
+	salt, err1 := hex.DecodeString(saltHex)
+	want, err2 := hex.DecodeString(sumHex)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	sum, err := DeriveKey(key, salt, len(want))
+	return err == nil && subtle.ConstantTimeCompare(sum, want) == 1
+}
+
+// DeriveKey 用加盐的 PBKDF2 从密码得出 size 字节，用于指纹和附件的加密密钥
+func DeriveKey(key string, salt []byte, size int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, key, salt, fingerprintIter, size)
+}
+
+// storedFingerprint 读取 schema（main 或附加的备份库）中保存的指纹，没有时返回空
+func storedFingerprint(queryRow func(query string, args ...any) *sql.Row, schema string) (string, error) {
+	var n int
+	err := queryRow("SELECT COUNT(*) FROM "+schema+".sqlite_master WHERE type='table' AND name=?", metaTable).Scan(&n)
+	if err != nil || n == 0 {
+		return "", err
+	}
+	var fp string
+	err = queryRow("SELECT value FROM "+schema+"."+metaTable+" WHERE name=?", metaKeyFingerprint).Scan(&fp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return fp, err
+}
+
+// EnsureKeyFingerprint 库中还没有指纹时保存当前密钥的指纹
+func (d *DB) EnsureKeyFingerprint() error {
+	fp, err := storedFingerprint(d.Conn.QueryRow, "main")
+	if err != nil || fp != "" {
+		return err
+	}
+	return d.SaveKeyFingerprint()
+}
+
+// SaveKeyFingerprint 保存当前密钥的指纹，改密后调用
+func (d *DB) SaveKeyFingerprint() error {
+	if Key == "" {
+		return nil
+	}
+	fp, err := KeyFingerprint(Key)
+	if err != nil {
+		return err
+	}
+	if _, err := d.Conn.Exec(sqlCreateMeta); err != nil {
+		return err
+	}
+	_, err = d.Conn.Exec("INSERT OR REPLACE INTO db_meta (name, value) VALUES (?, ?)", metaKeyFingerprint, fp)
+	return err
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// Format 导入导出的文件格式
+type Format string
+
+const (
+	FormatXLSX Format = "xlsx"
+	FormatCSV  Format = "csv"
+	FormatJSON Format = "json"
+)
+
+const utf8BOM = "\ufeff"
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "", FormatXLSX:
+		return FormatXLSX, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", errors.New("unknown format: " + s)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSON:
+		return "application/json"
+	}
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+// DetectFormat 根据上传的 Content-Type 和文件名判断格式，无法判断时返回空
+func DetectFormat(contentType, filename string) Format {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch mt {
+		case "text/csv", "application/csv":
+			return FormatCSV
+		case "application/json", "text/json":
+			return FormatJSON
+		case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+			return FormatXLSX
+		}
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return FormatCSV
+	case ".json":
+		return FormatJSON
+	case ".xlsx":
+		return FormatXLSX
+	}
+	return ""
+}
+
+// sniffFormat 根据文件内容判断格式：zip 为 xlsx，以 [ 开头为 json，否则按 csv
+func sniffFormat(br *bufio.Reader) Format {
+	head, _ := br.Peek(512)
+	if bytes.HasPrefix(head, []byte("PK")) {
+		return FormatXLSX
+	}
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte(utf8BOM)), " \t\r\n")
+	if bytes.HasPrefix(head, []byte("[")) {
+		return FormatJSON
+	}
+	return FormatCSV
+}
+
+// ReadRecords 按格式读取表头和数据行，format 为空时根据内容判断
+func ReadRecords(reader io.Reader, format Format) ([]string, [][]string, error) {
+	br := bufio.NewReader(reader)
+	if format == "" {
+		format = sniffFormat(br)
+	}
+	switch format {
+	case FormatCSV:
+		return readCSV(br)
+	case FormatJSON:
+		return readJSON(br)
+	}
+	return ReadSheet(br)
+}
+
+// readCSV 读取 CSV，去掉 Excel 保存时加入的 BOM
+func readCSV(reader io.Reader) ([]string, [][]string, error) {
+	cr := csv.NewReader(reader)
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil, errors.New("empty csv")
+	}
+	if len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], utf8BOM)
+	}
+	return rows[0], rows[1:], nil
+}
+
+// readJSON 读取对象数组，所有对象的键合并为表头
+func readJSON(reader io.Reader) ([]string, [][]string, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte(utf8BOM))
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var list []map[string]any
+	if err := dec.Decode(&list); err != nil {
+		return nil, nil, err
+	}
+
+	var headers []string
+	index := map[string]int{}
+	for _, obj := range list {
+		for k := range obj {
+			if _, ok := index[k]; !ok {
+				index[k] = len(headers)
+				headers = append(headers, k)
+			}
+		}
+	}
+	if len(headers) == 0 {
+		return nil, nil, errors.New("empty json")
+	}
+
+	rows := make([][]string, 0, len(list))
+	for _, obj := range list {
+		row := make([]string, len(headers))
+		for k, v := range obj {
+			if v != nil {
+				row[index[k]] = FormatValue(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows, nil
+}
+
+// WriteCSV 写入带 BOM 的 CSV，方便 Excel 直接打开
+func WriteCSV(w io.Writer, list any) error {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return err
+	}
+	headers, rows := StructTable(list)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(headers); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// ExportAs 按格式导出全部记录
+func (r *BaseRepository[T]) ExportAs(w io.Writer, format Format) error {
+	if format == FormatXLSX {
+		return r.Export(w)
+	}
+	list, err := r.GetList("")
+	if err != nil {
+		return err
+	}
+	if format == FormatCSV {
+		return WriteCSV(w, list)
+	}
+	// 空表导出为 [] 而不是 null
+	if list == nil {
+		list = []*T{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(list)
+}
@@ -0,0 +1,415 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ImportStrategy 导入时如何处理与已有记录重复的行
+type ImportStrategy string
+
+const (
+	StrategyOverwrite  ImportStrategy = "overwrite"   // 按 id 覆盖已有记录（默认）
+	StrategySkip       ImportStrategy = "skip"        // 已有 id 的记录保持不变
+	StrategyAppend     ImportStrategy = "append"      // 全部作为新记录追加
+	StrategyNaturalKey ImportStrategy = "natural_key" // 按自然键匹配已有记录，如账单的日期+金额+项目
+)
+
+func ParseImportStrategy(s string) (ImportStrategy, error) {
+	switch ImportStrategy(s) {
+	case "":
+		return StrategyOverwrite, nil
+	case StrategyOverwrite, StrategySkip, StrategyAppend, StrategyNaturalKey:
+		return ImportStrategy(s), nil
+	}
+	return "", errors.New("unknown import strategy: " + s)
+}
+
+// RowStatus 导入行的处理结果
+type RowStatus string
+
+const (
+	RowNew       RowStatus = "new"
+	RowChanged   RowStatus = "changed"
+	RowUnchanged RowStatus = "unchanged"
+	RowConflict  RowStatus = "conflict" // 与已有记录不同但按策略不覆盖
+	RowInvalid   RowStatus = "invalid"
+)
+
+type ImportOptions struct {
+	Format      Format // 为空时根据内容判断
+	Strategy    ImportStrategy
+	DryRun      bool // 只生成报告，不写入
+	SkipInvalid bool // 跳过无效行，否则有无效行时整体失败
+}
+
+type ImportRow struct {
+	Row    int       `json:"row"`
+	Status RowStatus `json:"status"`
+	Reason string    `json:"reason,omitempty"`
+	ID     int       `json:"id,omitempty"`     // 匹配到的已有记录
+	Fields []string  `json:"fields,omitempty"` // 与已有记录不同的字段
+	Data   any       `json:"data,omitempty"`
+}
+
+type ImportReport struct {
+	Strategy  ImportStrategy `json:"strategy"`
+	DryRun    bool           `json:"dry_run"`
+	Total     int            `json:"total"`
+	New       int            `json:"new"`
+	Changed   int            `json:"changed"`
+	Unchanged int            `json:"unchanged"`
+	Conflict  int            `json:"conflict"`
+	Invalid   int            `json:"invalid"`
+	Rows      []ImportRow    `json:"rows"`
+}
+
+// Add 记入一行结果，供自行匹配记录的导入使用
+func (rep *ImportReport) Add(row ImportRow) {
+	rep.Total++
+	switch row.Status {
+	case RowNew:
+		rep.New++
+	case RowChanged:
+		rep.Changed++
+	case RowUnchanged:
+		rep.Unchanged++
+	case RowConflict:
+		rep.Conflict++
+	case RowInvalid:
+		rep.Invalid++
+	}
+	rep.Rows = append(rep.Rows, row)
+}
+
+// NaturalKeyer 提供按内容识别记录的键，用于 natural_key 策略
+type NaturalKeyer interface {
+	NaturalKey() string
+}
+
+// KeyedByID 表示 id 本身有含义（如日记以日期为 id），不能以新 id 追加
+type KeyedByID interface {
+	KeyedByID() bool
+}
+
+// Validator 导入时校验记录
+type Validator interface {
+	Validate() error
+}
+
+// Defaulter 为新记录中未填写的字段设置默认值
+type Defaulter interface {
+	SetDefaults()
+}
+
+// ColumnIndex 将表头映射到结构体字段下标，按字段名、json 标签或 alias 标签（改名前的列名）匹配，无法识别的列为 -1
+func ColumnIndex[T any](headers []string) ([]int, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	columns := make([]int, len(headers))
+	matched := 0
+	for i, h := range headers {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, utf8BOM)))
+		columns[i] = -1
+		for j := 0; j < typ.NumField(); j++ {
+			f := typ.Field(j)
+			tag := strings.Split(f.Tag.Get("json"), ",")[0]
+			if h == strings.ToLower(f.Name) || (tag != "" && h == strings.ToLower(tag)) || hasAlias(f, h) {
+				columns[i] = j
+				matched++
+				break
+			}
+		}
+	}
+	if matched == 0 {
+		return nil, errors.New("no recognizable columns in header")
+	}
+	return columns, nil
+}
+
+// PresentFields 按列名生成 ImportItems 的 present 标记，列名的匹配规则与 ColumnIndex 相同
+// 列名写错属于程序错误，直接 panic
+func PresentFields[T any](names ...string) []bool {
+	columns, _ := ColumnIndex[T](names)
+	for i, c := range columns {
+		if c < 0 {
+			panic(fmt.Sprintf("db: unknown field %q", names[i]))
+		}
+	}
+	return presentColumns[T](columns)
+}
+
+func presentColumns[T any](columns []int) []bool {
+	present := make([]bool, reflect.TypeOf((*T)(nil)).Elem().NumField())
+	for _, c := range columns {
+		if c >= 0 {
+			present[c] = true
+		}
+	}
+	return present
+}
+
+func hasAlias(f reflect.StructField, name string) bool {
+	for _, a := range strings.Split(f.Tag.Get("alias"), ",") {
+		if a != "" && strings.ToLower(a) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// StructAliases 返回各字段 alias 标签中的旧列名
+func StructAliases(v any) []string {
+	typ := reflect.TypeOf(v)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	var names []string
+	for i := 0; i < typ.NumField(); i++ {
+		for _, a := range strings.Split(typ.Field(i).Tag.Get("alias"), ",") {
+			if a != "" {
+				names = append(names, strings.ToLower(a))
+			}
+		}
+	}
+	return names
+}
+
+// ReadSheet 读取 xlsx 第一个工作表，返回表头和数据行
+func ReadSheet(reader io.Reader) ([]string, [][]string, error) {
+	f, err := excelize.OpenReader(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, nil, errors.New("empty workbook")
+	}
+	rows, err := f.GetRows(sheets[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil, errors.New("empty sheet")
+	}
+	return rows[0], rows[1:], nil
+}
+
+// ImportWith 读取 xlsx、csv 或 json 并按策略导入
+func (r *BaseRepository[T]) ImportWith(reader io.Reader, opts ImportOptions) (*ImportReport, error) {
+	headers, rows, err := ReadRecords(reader, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	return r.ImportRows(headers, rows, opts)
+}
+
+// ImportRows 按表头解析数据行，生成导入报告，非预览时写入数据库
+func (r *BaseRepository[T]) ImportRows(headers []string, rows [][]string, opts ImportOptions) (*ImportReport, error) {
+	columns, err := ColumnIndex[T](headers)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*T, len(rows))
+	errs := make([]error, len(rows))
+	for i, row := range rows {
+		item := new(T)
+		errs[i] = FillStructFromRecord(item, headers, columns, row)
+		items[i] = item
+	}
+	present := presentColumns[T](columns)
+	// 数据行从第 2 行开始
+	return r.ImportItems(items, errs, present, 2, opts)
+}
+
+// ImportItems 按策略导入已解析的记录
+// errs 中非空的行视为无效；present 标记文件中包含的字段，为 nil 表示全部包含，
+// 缺少的字段对已有记录保持原值，对新记录使用默认值，合并后再校验；first 为第一条记录的行号
+func (r *BaseRepository[T]) ImportItems(items []*T, errs []error, present []bool, first int, opts ImportOptions) (*ImportReport, error) {
+	if opts.Strategy == "" {
+		opts.Strategy = StrategyOverwrite
+	}
+	_, keyedByID := any(new(T)).(KeyedByID)
+	_, hasKey := any(new(T)).(NaturalKeyer)
+	if opts.Strategy == StrategyAppend && keyedByID {
+		return nil, fmt.Errorf("%s does not support append", r.Table)
+	}
+	if opts.Strategy == StrategyNaturalKey && !hasKey && !keyedByID {
+		return nil, fmt.Errorf("%s has no natural key", r.Table)
+	}
+
+	existing, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*T, len(existing))
+	byKey := make(map[string][]*T)
+	for _, e := range existing {
+		byID[recordID(e)] = e
+		if opts.Strategy == StrategyNaturalKey {
+			k := naturalKey(e, keyedByID)
+			byKey[k] = append(byKey[k], e)
+		}
+	}
+
+	report := &ImportReport{Strategy: opts.Strategy, DryRun: opts.DryRun, Rows: []ImportRow{}}
+	var toInsert, toUpsert, newItems []*T
+	for i, item := range items {
+		row := ImportRow{Row: first + i, Data: item}
+		if errs != nil && errs[i] != nil {
+			row.Status = RowInvalid
+			row.Reason = errs[i].Error()
+			report.Add(row)
+			continue
+		}
+		if keyedByID && recordID(item) == 0 {
+			row.Status = RowInvalid
+			row.Reason = "missing id"
+			report.Add(row)
+			continue
+		}
+
+		var match *T
+		switch opts.Strategy {
+		case StrategyAppend:
+			setRecordID(item, 0)
+		case StrategyNaturalKey:
+			k := naturalKey(item, keyedByID)
+			if q := byKey[k]; len(q) > 0 {
+				// 每条已有记录只匹配一次，重复导入同一文件时结果不变
+				match, byKey[k] = q[0], q[1:]
+				setRecordID(item, recordID(match))
+			} else if !keyedByID {
+				setRecordID(item, 0)
+			}
+		default:
+			if id := recordID(item); id != 0 {
+				match = byID[id]
+			}
+		}
+
+		// 新记录先补上默认值再校验，与 Add 一致
+		if match != nil {
+			keepMissing(item, match, present)
+		} else if d, ok := any(item).(Defaulter); ok {
+			d.SetDefaults()
+		}
+		if v, ok := any(item).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				row.Status = RowInvalid
+				row.Reason = err.Error()
+				report.Add(row)
+				continue
+			}
+		}
+
+		if match == nil {
+			row.Status = RowNew
+			newItems = append(newItems, item)
+			if recordID(item) == 0 {
+				toInsert = append(toInsert, item)
+			} else {
+				toUpsert = append(toUpsert, item)
+			}
+			report.Add(row)
+			continue
+		}
+
+		row.ID = recordID(match)
+		row.Fields = diffFields(match, item)
+		switch {
+		case len(row.Fields) == 0:
+			row.Status = RowUnchanged
+		case opts.Strategy == StrategySkip:
+			row.Status = RowConflict
+			row.Reason = "record exists"
+		default:
+			row.Status = RowChanged
+			toUpsert = append(toUpsert, item)
+		}
+		report.Add(row)
+	}
+
+	if r.PrepareNew != nil && len(newItems) > 0 {
+		if err := r.PrepareNew(newItems); err != nil {
+			return report, err
+		}
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+	if report.Invalid > 0 && !opts.SkipInvalid {
+		for _, row := range report.Rows {
+			if row.Status == RowInvalid {
+				return report, fmt.Errorf("row %d: %s", row.Row, row.Reason)
+			}
+		}
+	}
+	if len(toInsert) == 0 && len(toUpsert) == 0 {
+		return report, nil
+	}
+
+	if err := Snapshot("import_" + r.Table); err != nil {
+		return report, err
+	}
+	// 新增和覆盖在同一个事务中写入，失败时不会只导入一部分
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+	if err := AddManyTx(tx, r.Table, toInsert); err != nil {
+		return report, err
+	}
+	if err := UpsertManyTx(tx, r.Table, toUpsert); err != nil {
+		return report, err
+	}
+	return report, tx.Commit()
+}
+
+func recordID(v any) int {
+	return int(reflect.ValueOf(v).Elem().Field(0).Int())
+}
+
+func setRecordID(v any, id int) {
+	reflect.ValueOf(v).Elem().Field(0).SetInt(int64(id))
+}
+
+func naturalKey(v any, keyedByID bool) string {
+	if keyedByID {
+		return fmt.Sprint(recordID(v))
+	}
+	return v.(NaturalKeyer).NaturalKey()
+}
+
+// keepMissing 将文件中没有的字段从已有记录复制过来
+func keepMissing(item, match any, present []bool) {
+	if present == nil {
+		return
+	}
+	vi, vm := reflect.ValueOf(item).Elem(), reflect.ValueOf(match).Elem()
+	for i := 1; i < vi.NumField(); i++ {
+		if !present[i] {
+			vi.Field(i).Set(vm.Field(i))
+		}
+	}
+}
+
+// diffFields 返回除 id 外取值不同的字段
+func diffFields(a, b any) []string {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	var fields []string
+	for i := 1; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			fields = append(fields, strings.ToLower(va.Type().Field(i).Name))
+		}
+	}
+	return fields
+}
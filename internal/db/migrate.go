@@ -0,0 +1,147 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const migrationsTable = "schema_migrations"
+const sqlCreateMigrations = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		id TEXT PRIMARY KEY,
+		applied INTEGER NOT NULL DEFAULT 0
+	);`
+
+// migration 登记的一次性迁移
+type migration struct {
+	id string
+	fn func(tx *sql.Tx) error
+}
+
+var migrations []migration
+
+// RegisterMigration 登记迁移，在包的 init 中调用，启动时由 RunMigrations 按登记顺序执行
+// 迁移可能在建表之前执行，fn 需要兼容表还不存在的情况
+func RegisterMigration(id string, fn func(tx *sql.Tx) error) {
+	migrations = append(migrations, migration{id: id, fn: fn})
+}
+
+// RunMigrations 启动时执行所有未执行过的迁移，任一失败即返回，调用方应停止启动
+// 新库中没有需要保护的数据，迁移前不做快照
+func RunMigrations(d *DB) error {
+	if _, err := d.Exec(sqlCreateMigrations, nil, false); err != nil {
+		return err
+	}
+	fresh, err := isFresh(d)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if err := migrate(d, m.id, m.fn, !fresh); err != nil {
+			return fmt.Errorf("migrate %s: %w", m.id, err)
+		}
+	}
+	return nil
+}
+
+// isFresh 库中除了迁移记录和密钥指纹之外还没有表
+func isFresh(d *DB) (bool, error) {
+	var n int
+	err := d.Conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table'
+		AND name NOT LIKE 'sqlite_%' AND name NOT IN (?, ?)`, migrationsTable, metaTable).Scan(&n)
+	return n == 0, err
+}
+
+// migrate 执行一次性结构迁移，已执行过的 id 直接跳过
+// 先在事务中试执行，确有改动且 snapshot 为 true 时回滚，快照后再正式执行；fn 失败则整体回滚
+func migrate(d *DB, id string, fn func(tx *sql.Tx) error, snapshot bool) error {
+	var n int
+	err := d.Conn.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE id=?", id).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	changed, err := runMigration(d, id, fn, !snapshot)
+	if err != nil || !changed || !snapshot {
+		return err
+	}
+	if err := Snapshot("migrate_" + id); err != nil {
+		return err
+	}
+	_, err = runMigration(d, id, fn, true)
+	return err
+}
+
+// runMigration 在事务中执行 fn 并记下迁移，返回是否改动了表结构或数据
+// commit 为 false 时有改动则回滚，不记下迁移
+func runMigration(d *DB, id string, fn func(tx *sql.Tx) error, commit bool) (bool, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	before, err := schemaState(tx)
+	if err != nil {
+		return false, err
+	}
+	if err := fn(tx); err != nil {
+		return false, err
+	}
+	after, err := schemaState(tx)
+	if err != nil {
+		return false, err
+	}
+	changed := before != after
+	if changed && !commit {
+		return true, nil
+	}
+	_, err = tx.Exec("INSERT INTO schema_migrations (id, applied) VALUES (?, ?)", id, time.Now().Unix())
+	if err != nil {
+		return changed, err
+	}
+	return changed, tx.Commit()
+}
+
+// schemaState 当前的表结构和连接上累计修改的行数，前后不同说明迁移有改动
+func schemaState(tx *sql.Tx) (string, error) {
+	var schema string
+	var changes int64
+	err := tx.QueryRow("SELECT COALESCE(group_concat(sql, ';'), ''), total_changes() FROM sqlite_master").Scan(&schema, &changes)
+	return fmt.Sprintf("%d|%s", changes, schema), err
+}
+
+// HasColumn 判断表中是否存在某列，可在迁移中用于兼容新建的表
+func HasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?", table, column).Scan(&n)
+	return n > 0, err
+}
+
+// AddColumns 为旧库中已存在的表依次补上缺少的列，defs 为列定义，如 `due INTEGER NOT NULL DEFAULT 0`
+// 表还不存在时跳过，建表语句已包含这些列
+func AddColumns(tx *sql.Tx, table string, defs ...string) error {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&n)
+	if err != nil || n == 0 {
+		return err
+	}
+	for _, def := range defs {
+		ok, err := HasColumn(tx, table, strings.Fields(def)[0])
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, def)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package db
+
+// FileRekey 改密时准备好的文件新内容，数据库提交后 Commit 替换原文件，失败时 Abort 丢弃
+type FileRekey interface {
+	Commit() error
+	Abort()
+}
+
+// rekeyHook 改密时用于重新加密数据库以外的文件（如附件），由 blob 包注册
+var rekeyHook func(oldKey, newKey string) (FileRekey, error)
+
+func SetRekeyHook(fn func(oldKey, newKey string) (FileRekey, error)) {
+	rekeyHook = fn
+}
+
+// RekeyFiles 调用改密钩子准备文件的新内容，未注册时什么也不做
+func RekeyFiles(oldKey, newKey string) (FileRekey, error) {
+	if rekeyHook == nil {
+		return noRekey{}, nil
+	}
+	return rekeyHook(oldKey, newKey)
+}
+
+type noRekey struct{}
+
+func (noRekey) Commit() error { return nil }
+func (noRekey) Abort()        {}
@@ -1,11 +1,15 @@
 package db
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
 	"io"
 	"reflect"
 	"strconv"
+	"strings"
+
+	"diarygo/internal/utils"
 
 	"github.com/xuri/excelize/v2"
 )
@@ -15,6 +19,12 @@ type BaseRepository[T any] struct {
 	Table     string
 	SQLCreate string
 	SQLExtra  string
+
+	// PrepareNew 导入时在写入前处理新记录，如账单按规则分类
+	PrepareNew func(list []*T) error
+
+	// Save UpdateByID 校验通过后保存记录，为空时直接更新；保存时还有其它规则的仓库设为自己的 Update
+	Save func(v *T) error
 }
 
 func NewBaseRepository[T any](d *DB, table string, createSQL, extraSQL string) *BaseRepository[T] {
@@ -60,8 +70,27 @@ func (r *BaseRepository[T]) Update(v *T) error {
 	return Update(r.DB, r.Table, v)
 }
 
+// UpdateByID 修改部分字段，与原记录合并并校验后保存，默认值只在新建时补上
 func (r *BaseRepository[T]) UpdateByID(id int, params map[string]any) error {
-	return UpdateByID(r.DB, r.Table, id, params)
+	v, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return fmt.Errorf("%s %d not found", r.Table, id)
+	}
+	if err := utils.ApplyParams(v, params); err != nil {
+		return err
+	}
+	if c, ok := any(v).(Validator); ok {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.Save != nil {
+		return r.Save(v)
+	}
+	return r.Update(v)
 }
 
 func (r *BaseRepository[T]) UpdateMany(list []*T) error {
@@ -73,13 +102,18 @@ func (r *BaseRepository[T]) Upsert(v *T) error {
 }
 
 func (r *BaseRepository[T]) UpsertMany(list []*T) error {
-	return UpdateMany(r.DB, r.Table, list)
+	return UpsertMany(r.DB, r.Table, list)
 }
 
 func (r *BaseRepository[T]) List() ([]*T, error) {
 	return SelectList[T](r.DB, r.Table, "")
 }
 
+// ListRaw 列出所有记录，字符串字段保持加密
+func (r *BaseRepository[T]) ListRaw() ([]*T, error) {
+	return SelectListRaw[T](r.DB, r.Table, "")
+}
+
 func (r *BaseRepository[T]) GetLast() (*T, error) {
 	return SelectLast[T](r.DB, r.Table)
 }
@@ -101,6 +135,9 @@ func (r *BaseRepository[T]) GetBetweenDates(d1, d2 int, order string) ([]*T, err
 }
 
 func (r *BaseRepository[T]) Reset() error {
+	if err := Snapshot("reset_" + r.Table); err != nil {
+		return err
+	}
 	_, err := r.DB.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", r.Table), nil, true)
 	if err != nil {
 		return err
@@ -125,14 +162,12 @@ func (r *BaseRepository[T]) Export(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	if len(list) == 0 {
-		return errors.New("empty list")
-	}
 
 	f := excelize.NewFile()
 	sheet := "Sheet1"
 
-	headers := StructCols(list[0], false)
+	// 空表只写表头，与 CSV 一致
+	headers := StructCols(new(T), false)
 	if err := f.SetSheetRow(sheet, "A1", &headers); err != nil {
 		return err
 	}
@@ -140,6 +175,12 @@ func (r *BaseRepository[T]) Export(w io.Writer) error {
 	for i, item := range list {
 		row := i + 2
 		data := StructArgs(item, false)
+		for j, v := range data {
+			// 金额等自定义数值类型写为数字单元格
+			if n, ok := v.(interface{ Float() float64 }); ok {
+				data[j] = n.Float()
+			}
+		}
 		if err := f.SetSheetRow(sheet, "A"+strconv.Itoa(row), &data); err != nil {
 			return err
 		}
@@ -148,6 +189,7 @@ func (r *BaseRepository[T]) Export(w io.Writer) error {
 	return f.Write(w)
 }
 
+// FillStructFromRow 按字段顺序填充结构体
 func FillStructFromRow(v any, row []string) error {
 	val := reflect.ValueOf(v)
 	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
@@ -156,55 +198,67 @@ func FillStructFromRow(v any, row []string) error {
 	val = val.Elem()
 
 	numField := val.NumField()
-
-	setField := func(field reflect.Value, s string) {
-		if s == "" {
-			return
-		}
-		switch field.Kind() {
-		case reflect.Int, reflect.Int64:
-			i, _ := strconv.ParseInt(s, 10, 64)
-			field.SetInt(i)
-		case reflect.Float64:
-			f, _ := strconv.ParseFloat(s, 64)
-			field.SetFloat(f)
-		case reflect.String:
-			field.SetString(s)
-		}
-	}
 	for i := 0; i < numField && i < len(row); i++ {
-		setField(val.Field(i), row[i])
+		if err := setField(val.Field(i), row[i]); err != nil {
+			return fmt.Errorf("%s: %w", strings.ToLower(val.Type().Field(i).Name), err)
+		}
 	}
 	return nil
 }
 
-func (r *BaseRepository[T]) Import(reader io.Reader) error {
-	f, err := excelize.OpenReader(reader)
-	if err != nil {
-		return err
+// FillStructFromRecord 按表头名称填充结构体，columns 为每列对应的字段下标，-1 表示忽略
+func FillStructFromRecord(v any, headers []string, columns []int, row []string) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return errors.New("v must be pointer to struct")
 	}
-	defer f.Close()
+	val = val.Elem()
 
-	rows, err := f.GetRows("Sheet1")
-	if err != nil {
-		return err
-	}
-	var toUpsert []*T
-	for i, row := range rows {
-		if i == 0 {
+	for i, field := range columns {
+		if field < 0 || i >= len(row) {
 			continue
 		}
-		item := new(T)
-		err := FillStructFromRow(item, row)
-		if err != nil {
-			return err
+		if err := setField(val.Field(field), row[i]); err != nil {
+			return fmt.Errorf("%s: %w", headers[i], err)
 		}
-		toUpsert = append(toUpsert, item)
 	}
-	if len(toUpsert) > 0 {
-		if err := UpsertMany(r.DB, r.Table, toUpsert); err != nil {
-			return err
+	return nil
+}
+
+func setField(field reflect.Value, s string) error {
+	if s == "" {
+		return nil
+	}
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(strings.TrimSpace(s)))
+	}
+	switch field.Kind() {
+	case reflect.Int, reflect.Int64:
+		s = strings.TrimSpace(s)
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			// Excel 可能把整数存成 2.0260101E7 之类的形式
+			f, ferr := strconv.ParseFloat(s, 64)
+			if ferr != nil || f != float64(int64(f)) {
+				return fmt.Errorf("invalid integer %q", s)
+			}
+			i = int64(f)
 		}
+		field.SetInt(i)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		field.SetFloat(f)
+	case reflect.String:
+		field.SetString(s)
 	}
 	return nil
 }
+
+// Import 按 id 覆盖导入，存在无效行时整体失败
+func (r *BaseRepository[T]) Import(reader io.Reader) error {
+	_, err := r.ImportWith(reader, ImportOptions{Strategy: StrategyOverwrite})
+	return err
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// snapshotHook 在破坏性操作（导入、重置、改密、迁移、恢复）前调用，由 backup 包注册
+var snapshotHook func(reason string) error
+
+func SetSnapshotHook(fn func(reason string) error) {
+	snapshotHook = fn
+}
+
+// Snapshot 调用快照钩子，未注册时忽略
+func Snapshot(reason string) error {
+	if snapshotHook == nil {
+		return nil
+	}
+	return snapshotHook(reason)
+}
+
+// renamedColumns 表 -> 新列名 -> 旧列名，恢复旧备份时按旧列名读取
+var renamedColumns = map[string]map[string]string{}
+
+// RenameColumn 登记迁移中改名的列，在包的 init 中调用，运行时不再修改
+func RenameColumn(table, oldName, newName string) {
+	if renamedColumns[table] == nil {
+		renamedColumns[table] = map[string]string{}
+	}
+	renamedColumns[table][newName] = oldName
+}
+
+// RestoreFrom 用备份文件中的数据覆盖当前各表
+// 只复制两边都存在的表和列，备份中没有的表保持不变
+// 备份记录了密钥指纹且与当前密钥不符时拒绝恢复，旧版本的备份没有指纹
+func (d *DB) RestoreFrom(path string) error {
+	GlobalWriteMutex.Lock()
+	defer GlobalWriteMutex.Unlock()
+
+	// ATTACH 不存在的文件会新建空库
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := d.Conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS bk", path); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE bk")
+
+	fp, err := storedFingerprint(func(query string, args ...any) *sql.Row {
+		return conn.QueryRowContext(ctx, query, args...)
+	}, "bk")
+	if err != nil {
+		return err
+	}
+	if fp != "" && !MatchKeyFingerprint(fp, Key) {
+		return ErrKeyMismatch
+	}
+
+	tableNames := func(schema string) (map[string]bool, error) {
+		rows, err := conn.QueryContext(ctx, fmt.Sprintf(
+			"SELECT name FROM %s.sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%%'", schema))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		names := map[string]bool{}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return nil, err
+			}
+			names[name] = true
+		}
+		return names, rows.Err()
+	}
+	columns := func(schema, table string) ([]string, map[string]string, error) {
+		rows, err := conn.QueryContext(ctx, fmt.Sprintf("PRAGMA %s.table_info(%s)", schema, table))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+		var cols []string
+		types := map[string]string{}
+		for rows.Next() {
+			var (
+				cid     int
+				name    string
+				typ     string
+				notNull int
+				def     any
+				pk      int
+			)
+			if err := rows.Scan(&cid, &name, &typ, &notNull, &def, &pk); err != nil {
+				return nil, nil, err
+			}
+			cols = append(cols, name)
+			types[name] = normalizeDBType(typ)
+		}
+		return cols, types, rows.Err()
+	}
+
+	mainTables, err := tableNames("main")
+	if err != nil {
+		return err
+	}
+	bkTables, err := tableNames("bk")
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for table := range bkTables {
+		// 迁移记录和密钥指纹以当前库为准
+		if !mainTables[table] || table == migrationsTable || table == metaTable {
+			continue
+		}
+		mainCols, mainTypes, err := columns("main", table)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		bkCols, bkTypes, err := columns("bk", table)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		inBackup := map[string]bool{}
+		for _, c := range bkCols {
+			inBackup[c] = true
+		}
+		var cols, exprs []string
+		for _, c := range mainCols {
+			src := c
+			if !inBackup[c] {
+				// 旧备份中改名前的列
+				if old := renamedColumns[table][c]; old != "" && inBackup[old] {
+					src = old
+				} else {
+					continue
+				}
+			}
+			cols = append(cols, c)
+			exprs = append(exprs, restoreExpr(src, mainTypes[c], bkTypes[src]))
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM main.%s", table)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if len(cols) == 0 {
+			continue
+		}
+		sql := fmt.Sprintf("INSERT INTO main.%s (%s) SELECT %s FROM bk.%s",
+			table, strings.Join(cols, ", "), strings.Join(exprs, ", "), table)
+		if _, err := tx.ExecContext(ctx, sql); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// restoreExpr 旧备份中的小数金额列已迁移为整数分（见 money.Amount），复制时换算
+func restoreExpr(col, mainType, bkType string) string {
+	if mainType == "INTEGER" && isDecimalType(bkType) {
+		return fmt.Sprintf("CAST(ROUND(%s * 100) AS INTEGER)", col)
+	}
+	return col
+}
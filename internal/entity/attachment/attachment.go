@@ -0,0 +1,323 @@
+package attachment
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"diarygo/internal/blob"
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/entity/diary"
+	"diarygo/internal/entity/interest"
+	"diarygo/internal/entity/note"
+	"diarygo/internal/entity/sport"
+	"diarygo/internal/utils"
+)
+
+// Modules 可以挂附件的模块，模块名即表名
+var Modules = map[string]bool{
+	diary.TABLE:    true,
+	bill.TABLE:     true,
+	note.TABLE:     true,
+	interest.TABLE: true,
+	sport.TABLE:    true,
+}
+
+// blobMu 避免删除文件时另一个请求正在复用同一内容
+var blobMu sync.Mutex
+
+// ThumbSize 缩略图最长边的像素
+const ThumbSize = 256
+
+// Attachment 挂在某条记录上的文件，内容保存在 blob 存储中
+// 日记以日期为 id，Record 为 YYYYMMDD，当天可以还没有日记
+type Attachment struct {
+	ID      int    `json:"id"`
+	Module  string `json:"module"`
+	Record  int    `json:"record"`
+	Name    string `json:"name"`
+	Mime    string `json:"mime"`
+	Size    int    `json:"size"`
+	Hash    string `json:"hash"`
+	Thumb   string `json:"thumb"`   // 缩略图的 hash，不是图片时为空
+	Created int    `json:"created"` // unix 秒
+}
+
+const TABLE = "attachment"
+const SQLCreate = `
+	CREATE TABLE IF NOT EXISTS attachment (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		module CHAR(20) NOT NULL DEFAULT "",
+		record INTEGER NOT NULL DEFAULT 0,
+		name TEXT NOT NULL DEFAULT "",
+		mime CHAR(100) NOT NULL DEFAULT "",
+		size INTEGER NOT NULL DEFAULT 0,
+		hash CHAR(64) NOT NULL DEFAULT "",
+		thumb CHAR(64) NOT NULL DEFAULT "",
+		created INTEGER NOT NULL DEFAULT 0
+	);`
+const SQLIndex = `CREATE INDEX IF NOT EXISTS idx_attachment_record ON attachment (module, record);`
+
+type Repository struct {
+	*db.BaseRepository[Attachment]
+	Store *blob.Store
+}
+
+// NewRepository store 为 nil 时只能读写附件信息（如归档、改密）
+func NewRepository(d *db.DB, store *blob.Store) *Repository {
+	base := db.NewBaseRepository[Attachment](d, TABLE, SQLCreate, SQLIndex)
+	return &Repository{BaseRepository: base, Store: store}
+}
+
+func (r *Repository) store() (*blob.Store, error) {
+	if r.Store == nil {
+		return nil, errors.New("attachment storage is not configured")
+	}
+	return r.Store, nil
+}
+
+// checkRecord 附件只能挂在已存在的记录上，日记只要求日期有效
+func (r *Repository) checkRecord(module string, record int) error {
+	if !Modules[module] {
+		return fmt.Errorf("invalid module %q", module)
+	}
+	if module == diary.TABLE {
+		if !utils.IsValidDateInt(record) {
+			return fmt.Errorf("invalid date %d", record)
+		}
+		return nil
+	}
+	var n int
+	err := r.DB.Conn.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id = ?", module), record).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %d not found", module, record)
+	}
+	return nil
+}
+
+// ListFor 返回某条记录的附件
+func (r *Repository) ListFor(module string, record int) ([]*Attachment, error) {
+	return r.GetList("WHERE module = ? AND record = ? ORDER BY id", module, record)
+}
+
+// Add 保存文件并挂到记录上，图片会同时生成缩略图
+func (r *Repository) Add(module string, record int, name string, data []byte) (*Attachment, error) {
+	store, err := r.store()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkRecord(module, record); err != nil {
+		return nil, err
+	}
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	a, err := newAttachment(store, module, name, data)
+	if err != nil {
+		return nil, err
+	}
+	a.Record = record
+	return r.BaseRepository.Add(a)
+}
+
+// AddWith 保存文件后在一个事务中调用 fn 写入记录，并把文件挂到 fn 返回的每条记录上
+// 失败时记录和附件都不会写入，没有引用的文件一并删除
+func (r *Repository) AddWith(module string, name string, data []byte, fn func(tx *sql.Tx) ([]int, error)) error {
+	store, err := r.store()
+	if err != nil {
+		return err
+	}
+	if !Modules[module] {
+		return fmt.Errorf("invalid module %q", module)
+	}
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	a, err := newAttachment(store, module, name, data)
+	if err != nil {
+		return err
+	}
+	if err := r.addWith(a, fn); err != nil {
+		r.removeUnused(store, []string{a.Hash, a.Thumb})
+		return err
+	}
+	return nil
+}
+
+func (r *Repository) addWith(a *Attachment, fn func(tx *sql.Tx) ([]int, error)) error {
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	records, err := fn(tx)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		a.Record = record
+		if _, err := db.InsertTx(tx, TABLE, a); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// newAttachment 保存文件（图片同时保存缩略图），返回还没有挂到记录上的附件，调用时要持有 blobMu
+func newAttachment(store *blob.Store, module string, name string, data []byte) (*Attachment, error) {
+	name = filepath.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		name = "file"
+	}
+	a := &Attachment{
+		Module:  module,
+		Name:    name,
+		Mime:    http.DetectContentType(data),
+		Size:    len(data),
+		Created: int(time.Now().Unix()),
+	}
+	var err error
+	if a.Hash, err = store.Put(data); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(a.Mime, "image/") {
+		// 无法解码的图片不生成缩略图，仍可下载原文件
+		if thumb, err := Thumbnail(data, ThumbSize); err == nil {
+			if a.Thumb, err = store.Put(thumb); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return a, nil
+}
+
+// get 按 id 读取附件，不存在时返回错误
+func (r *Repository) get(id int) (*Attachment, error) {
+	a, err := r.GetByID(id)
+	if err == nil && a == nil {
+		err = fmt.Errorf("attachment %d not found", id)
+	}
+	return a, err
+}
+
+// Open 返回附件信息和内容，thumb 为 true 时返回缩略图
+func (r *Repository) Open(id int, thumb bool) (*Attachment, []byte, error) {
+	store, err := r.store()
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := r.get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash := a.Hash
+	if thumb {
+		if a.Thumb == "" {
+			return nil, nil, fmt.Errorf("attachment %d has no thumbnail", id)
+		}
+		hash = a.Thumb
+	}
+	data, err := store.Read(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, data, nil
+}
+
+// DeleteByID 删除附件，没有其它附件引用的文件一并删除
+func (r *Repository) DeleteByID(id int) error {
+	store, err := r.store()
+	if err != nil {
+		return err
+	}
+	blobMu.Lock()
+	defer blobMu.Unlock()
+	a, err := r.get(id)
+	if err != nil {
+		return err
+	}
+	if err := r.BaseRepository.DeleteByID(id); err != nil {
+		return err
+	}
+	return r.removeUnused(store, []string{a.Hash, a.Thumb})
+}
+
+// removeUnused 删除没有附件引用的文件，调用时要持有 blobMu
+func (r *Repository) removeUnused(store *blob.Store, hashes []string) error {
+	for _, hash := range hashes {
+		if hash == "" {
+			continue
+		}
+		rest, err := r.GetList("WHERE hash = ? OR thumb = ?", hash, hash)
+		if err != nil {
+			return err
+		}
+		if len(rest) == 0 {
+			if err := store.Remove(hash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 删除记录时在同一事务中删除其附件，提交后再删除不再引用的文件
+func init() {
+	db.OnDelete(deleteFor)
+}
+
+func deleteFor(tx *sql.Tx, table string, ids []any) (func(), error) {
+	if !Modules[table] {
+		return nil, nil
+	}
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", TABLE).Scan(&n)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	where := fmt.Sprintf("WHERE module = ? AND record IN (%s)", strings.Join(utils.MakePlaceholders(len(ids)), ", "))
+	args := db.EncryptArgs(append([]any{table}, ids...))
+	rows, err := tx.Query("SELECT hash, thumb FROM attachment "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash, thumb string
+		if err := rows.Scan(&hash, &thumb); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hashes = append(hashes, db.DecryptWith(hash, db.Key), db.DecryptWith(thumb, db.Key))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	if _, err := tx.Exec("DELETE FROM attachment "+where, args...); err != nil {
+		return nil, err
+	}
+	return func() {
+		store := blob.Get()
+		if store == nil {
+			return
+		}
+		blobMu.Lock()
+		defer blobMu.Unlock()
+		// 记录已经删除，文件删不掉只会多占空间，不影响数据
+		if err := NewRepository(db.Get(), store).removeUnused(store, hashes); err != nil {
+			fmt.Fprintln(os.Stderr, "remove attachment files:", err)
+		}
+	}, nil
+}
@@ -0,0 +1,461 @@
+package bill
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"diarygo/internal/db"
+	"diarygo/internal/money"
+	"diarygo/internal/utils"
+)
+
+// 账户类型
+const (
+	AccountCash   = "cash"
+	AccountBank   = "bank"
+	AccountCredit = "credit"
+	AccountWallet = "wallet"
+	AccountOther  = "other"
+)
+
+// Account 资金账户，如现金、银行卡、信用卡、电子钱包
+// 账单的 Account 为 0 表示未指定账户
+type Account struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	Kind       string       `json:"kind"`
+	Opening    money.Amount `json:"opening"`    // 期初余额，信用卡欠款为负数
+	Since      int          `json:"since"`      // 期初余额对应的日期，之前的账单不计入余额
+	Closed     int          `json:"closed"`     // 1 已停用
+	Reconciled int          `json:"reconciled"` // 最近一次对账的日期
+	Statement  money.Amount `json:"statement"`  // 最近一次对账时的余额
+}
+
+func (a *Account) SetDefaults() {
+	if a.Kind == "" {
+		a.Kind = AccountCash
+	}
+}
+
+func (a *Account) Validate() error {
+	if a.Name == "" {
+		return errors.New("account name is required")
+	}
+	switch a.Kind {
+	case AccountCash, AccountBank, AccountCredit, AccountWallet, AccountOther:
+	default:
+		return fmt.Errorf("invalid account kind %q", a.Kind)
+	}
+	if a.Since != 0 && !utils.IsValidDateInt(a.Since) {
+		return fmt.Errorf("invalid since %d", a.Since)
+	}
+	return nil
+}
+
+const AccountTable = "bill_account"
+const SQLCreateAccount = `
+	CREATE TABLE IF NOT EXISTS bill_account (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name CHAR(40) NOT NULL DEFAULT "",
+		kind CHAR(10) NOT NULL DEFAULT "cash",
+		opening INTEGER NOT NULL DEFAULT 0,
+		since INTEGER NOT NULL DEFAULT 0,
+		closed INTEGER NOT NULL DEFAULT 0,
+		reconciled INTEGER NOT NULL DEFAULT 0,
+		statement INTEGER NOT NULL DEFAULT 0
+	);`
+
+// Transfer 账户之间的转账，不计入收入和支出
+type Transfer struct {
+	ID       int          `json:"id"`
+	Date     int          `json:"date"`
+	Source   int          `json:"source"` // 转出账户
+	Target   int          `json:"target"` // 转入账户
+	Amount   money.Amount `json:"amount"`
+	Item     string       `json:"item"`
+	Currency string       `json:"currency"`
+}
+
+func (t *Transfer) SetDefaults() {
+	if t.Date == 0 {
+		t.Date = utils.GetCurrentDateInt()
+	}
+	t.Currency = NormalizeCurrency(t.Currency)
+}
+
+func (t *Transfer) Validate() error {
+	if !utils.IsValidDateInt(t.Date) {
+		return fmt.Errorf("invalid date %d", t.Date)
+	}
+	if t.Source == 0 || t.Target == 0 {
+		return errors.New("source and target accounts are required")
+	}
+	if t.Source == t.Target {
+		return errors.New("source and target must differ")
+	}
+	if t.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if !ValidCurrency(NormalizeCurrency(t.Currency)) {
+		return fmt.Errorf("invalid currency %q", t.Currency)
+	}
+	return nil
+}
+
+const TransferTable = "bill_transfer"
+const SQLCreateTransfer = `
+	CREATE TABLE IF NOT EXISTS bill_transfer (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		date INTEGER NOT NULL DEFAULT 0,
+		source INTEGER NOT NULL DEFAULT 0,
+		target INTEGER NOT NULL DEFAULT 0,
+		amount INTEGER NOT NULL DEFAULT 0,
+		item TEXT NOT NULL DEFAULT "",
+		currency CHAR(3) NOT NULL DEFAULT ""
+	);`
+
+// migrateAccount 为旧库的账单和周期账单补上账户列
+func migrateAccount(tx *sql.Tx) error {
+	const def = "account INTEGER NOT NULL DEFAULT 0"
+	if err := db.AddColumns(tx, TABLE, def); err != nil {
+		return err
+	}
+	return db.AddColumns(tx, RecurringTable, def)
+}
+
+// BalanceReport 所有账户截至某日的余额，金额为基准货币
+type BalanceReport struct {
+	Date     int               `json:"date"`
+	Currency string            `json:"currency"`
+	Missing  []string          `json:"missing"` // 没有汇率、按 1:1 计算的币种
+	Accounts []*AccountBalance `json:"accounts"`
+}
+
+// AccountBalance 截至某日的账户余额，金额为基准货币
+type AccountBalance struct {
+	*Account
+	Income      money.Amount `json:"income"`
+	Expense     money.Amount `json:"expense"`
+	TransferIn  money.Amount `json:"transfer_in"`
+	TransferOut money.Amount `json:"transfer_out"`
+	Balance     money.Amount `json:"balance"`
+}
+
+// LedgerEntry 账户流水中的一条记录，Amount 为带符号的基准货币金额
+type LedgerEntry struct {
+	Date     int          `json:"date"`
+	Kind     string       `json:"kind"` // bill / transfer
+	ID       int          `json:"id"`
+	Type     string       `json:"type"`
+	Item     string       `json:"item"`
+	Currency string       `json:"currency"`
+	Original money.Amount `json:"original"` // 原币种金额
+	Amount   money.Amount `json:"amount"`
+	Balance  money.Amount `json:"balance"`
+}
+
+// Ledger 账户在日期范围内的流水和逐笔余额
+type Ledger struct {
+	Account  *Account       `json:"account"`
+	Start    int            `json:"start"`
+	End      int            `json:"end"`
+	Opening  money.Amount   `json:"opening"` // start 之前的余额
+	Closing  money.Amount   `json:"closing"`
+	Currency string         `json:"currency"`
+	Missing  []string       `json:"missing"`
+	Entries  []*LedgerEntry `json:"entries"`
+}
+
+// Reconciliation 对账结果，Difference 为对账单余额减去计算余额
+type Reconciliation struct {
+	Account    *Account     `json:"account"`
+	Date       int          `json:"date"`
+	Computed   money.Amount `json:"computed"`
+	Statement  money.Amount `json:"statement"`
+	Difference money.Amount `json:"difference"`
+	Reconciled bool         `json:"reconciled"`
+	Adjustment *Bill        `json:"adjustment"`
+}
+
+type AccountRepository struct {
+	*db.BaseRepository[Account]
+}
+
+func NewAccountRepository(d *db.DB) *AccountRepository {
+	base := db.NewBaseRepository[Account](d, AccountTable, SQLCreateAccount, "")
+	return &AccountRepository{BaseRepository: base}
+}
+
+func (r *AccountRepository) Add(a *Account) (*Account, error) {
+	a.SetDefaults()
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(a)
+}
+
+// get 按 id 读取账户，不存在时返回错误
+func (r *AccountRepository) get(id int) (*Account, error) {
+	a, err := r.GetByID(id)
+	if err == nil && a == nil {
+		err = fmt.Errorf("account %d not found", id)
+	}
+	return a, err
+}
+
+// Update 修改账户信息，对账记录只能通过 Reconcile 修改
+func (r *AccountRepository) Update(a *Account) error {
+	old, err := r.get(a.ID)
+	if err != nil {
+		return err
+	}
+	a.SetDefaults()
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	a.Reconciled, a.Statement = old.Reconciled, old.Statement
+	return r.BaseRepository.Update(a)
+}
+
+// DeleteByID 仍有账单或转账引用的账户不能删除，可改为停用
+func (r *AccountRepository) DeleteByID(id int) error {
+	var n int
+	err := r.DB.Conn.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM bill WHERE account = ?) +
+		       (SELECT COUNT(*) FROM bill_transfer WHERE source = ? OR target = ?)`,
+		id, id, id).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("account is used by %d records, close it instead", n)
+	}
+	return r.BaseRepository.DeleteByID(id)
+}
+
+// Balances 计算所有账户截至 date（含）的余额，只统计期初日期之后的记录
+func (r *AccountRepository) Balances(date int, conv *Converter) (*BalanceReport, error) {
+	accounts, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*AccountBalance, 0, len(accounts))
+	for _, a := range accounts {
+		b, err := r.balance(a, date, conv)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return &BalanceReport{Date: date, Currency: conv.Base, Missing: conv.Missing(), Accounts: list}, nil
+}
+
+// Balance 计算单个账户截至 date（含）的余额
+func (r *AccountRepository) Balance(id, date int, conv *Converter) (*AccountBalance, error) {
+	a, err := r.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return r.balance(a, date, conv)
+}
+
+// balance 金额不加密，先在 SQL 中按币种和日期汇总整数分，再按当天汇率换算
+func (r *AccountRepository) balance(a *Account, date int, conv *Converter) (*AccountBalance, error) {
+	b := &AccountBalance{Account: a}
+	rows, err := r.DB.Select(`
+		SELECT currency, date,
+			COALESCE(SUM(CASE WHEN inout > 0 THEN amount END), 0),
+			COALESCE(SUM(CASE WHEN inout < 0 THEN amount END), 0)
+		FROM bill WHERE account = ? AND date >= ? AND date <= ?
+		GROUP BY currency, date`,
+		[]any{a.ID, a.Since, date}, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		cur, d := rowString(row[0]), rowInt(row[1])
+		b.Income += conv.Convert(rowAmount(row[2]), cur, d)
+		b.Expense += conv.Convert(rowAmount(row[3]), cur, d)
+	}
+	rows, err = r.DB.Select(`
+		SELECT currency, date,
+			COALESCE(SUM(CASE WHEN target = ? THEN amount END), 0),
+			COALESCE(SUM(CASE WHEN source = ? THEN amount END), 0)
+		FROM bill_transfer WHERE (source = ? OR target = ?) AND date >= ? AND date <= ?
+		GROUP BY currency, date`,
+		[]any{a.ID, a.ID, a.ID, a.ID, a.Since, date}, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		cur, d := rowString(row[0]), rowInt(row[1])
+		b.TransferIn += conv.Convert(rowAmount(row[2]), cur, d)
+		b.TransferOut += conv.Convert(rowAmount(row[3]), cur, d)
+	}
+	b.Balance = a.Opening + b.Income - b.Expense + b.TransferIn - b.TransferOut
+	return b, nil
+}
+
+// Ledger 返回账户在 [start, end] 之间的账单和转账，按日期排序并计算逐笔余额
+func (r *AccountRepository) Ledger(id, start, end int, conv *Converter) (*Ledger, error) {
+	a, err := r.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if start < a.Since {
+		start = a.Since
+	}
+	before, err := r.balance(a, start-1, conv)
+	if err != nil {
+		return nil, err
+	}
+
+	bills, err := NewRepository(r.DB).GetList("WHERE account = ? AND date >= ? AND date <= ? ORDER BY date, id", id, start, end)
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := NewTransferRepository(r.DB).GetList("WHERE (source = ? OR target = ?) AND date >= ? AND date <= ? ORDER BY date, id", id, id, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*LedgerEntry, 0, len(bills)+len(transfers))
+	for _, b := range bills {
+		original := b.Amount * money.Amount(sign(b.Inout))
+		entries = append(entries, &LedgerEntry{
+			Date: b.Date, Kind: "bill", ID: b.ID, Type: b.Type, Item: b.Item,
+			Currency: b.Currency, Original: original,
+			Amount: conv.Convert(original, b.Currency, b.Date),
+		})
+	}
+	for _, t := range transfers {
+		original := t.Amount
+		if t.Source == id {
+			original = -original
+		}
+		entries = append(entries, &LedgerEntry{
+			Date: t.Date, Kind: "transfer", ID: t.ID, Item: t.Item,
+			Currency: t.Currency, Original: original,
+			Amount: conv.Convert(original, t.Currency, t.Date),
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date < entries[j].Date })
+
+	balance := before.Balance
+	for _, e := range entries {
+		balance += e.Amount
+		e.Balance = balance
+	}
+	return &Ledger{
+		Account:  a,
+		Start:    start,
+		End:      end,
+		Opening:  before.Balance,
+		Closing:  balance,
+		Currency: conv.Base,
+		Missing:  conv.Missing(),
+		Entries:  entries,
+	}, nil
+}
+
+// Reconcile 用对账单余额核对账户截至 date 的余额
+// 对账单余额为基准货币；一致时记录对账日期，不一致且 adjust 为 true 时补一笔差额账单后记录
+func (r *AccountRepository) Reconcile(id, date int, statement money.Amount, adjust bool, conv *Converter) (*Reconciliation, error) {
+	if !utils.IsValidDateInt(date) {
+		return nil, fmt.Errorf("invalid date %d", date)
+	}
+	b, err := r.Balance(id, date, conv)
+	if err != nil {
+		return nil, err
+	}
+	res := &Reconciliation{
+		Account:    b.Account,
+		Date:       date,
+		Computed:   b.Balance,
+		Statement:  statement,
+		Difference: statement - b.Balance,
+	}
+	if res.Difference != 0 {
+		if !adjust {
+			return res, nil
+		}
+		adj := &Bill{
+			Date:    date,
+			Inout:   sign(int(res.Difference)),
+			Type:    "Adjustment",
+			Amount:  res.Difference.Abs(),
+			Item:    "Reconciliation adjustment",
+			Account: id,
+		}
+		if res.Adjustment, err = NewRepository(r.DB).Add(adj); err != nil {
+			return nil, err
+		}
+	}
+	err = r.UpdateByID(id, map[string]any{"reconciled": date, "statement": res.Statement})
+	if err != nil {
+		return nil, err
+	}
+	res.Account.Reconciled, res.Account.Statement = date, res.Statement
+	res.Reconciled = true
+	return res, nil
+}
+
+func rowString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func rowInt(v any) int {
+	switch n := v.(type) {
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+func rowAmount(v any) money.Amount {
+	switch n := v.(type) {
+	case int64:
+		return money.Amount(n)
+	case float64:
+		return money.Amount(n)
+	}
+	return 0
+}
+
+func sign(inout int) int {
+	if inout > 0 {
+		return 1
+	}
+	return -1
+}
+
+type TransferRepository struct {
+	*db.BaseRepository[Transfer]
+}
+
+func NewTransferRepository(d *db.DB) *TransferRepository {
+	base := db.NewBaseRepository[Transfer](d, TransferTable, SQLCreateTransfer, "")
+	return &TransferRepository{BaseRepository: base}
+}
+
+func (r *TransferRepository) Add(t *Transfer) (*Transfer, error) {
+	t.SetDefaults()
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(t)
+}
+
+func (r *TransferRepository) Update(t *Transfer) error {
+	t.SetDefaults()
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(t)
+}
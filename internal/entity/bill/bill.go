@@ -1,17 +1,48 @@
 package bill
 
 import (
+	"database/sql"
+	"fmt"
+	"strings"
+
 	"diarygo/internal/db"
+	"diarygo/internal/money"
 	"diarygo/internal/utils"
 )
 
 type Bill struct {
-	ID     int     `json:"id"`
-	Date   int     `json:"date"`
-	Inout  int     `json:"inout"`
-	Type   string  `json:"type"`
-	Amount float64 `json:"amount"`
-	Item   string  `json:"item"`
+	ID       int          `json:"id"`
+	Date     int          `json:"date"`
+	Inout    int          `json:"inout"`
+	Type     string       `json:"type"`
+	Amount   money.Amount `json:"amount"`
+	Item     string       `json:"item"`
+	Account  int          `json:"account"`  // 所属账户，0 表示未指定
+	Currency string       `json:"currency"` // 币种代码，空表示基准货币
+}
+
+func (b *Bill) SetDefaults() {
+	if b.Date == 0 {
+		b.Date = utils.GetCurrentDateInt()
+	}
+	if b.Inout == 0 {
+		b.Inout = -1
+	}
+	b.Currency = NormalizeCurrency(b.Currency)
+}
+
+func (b *Bill) NaturalKey() string {
+	return fmt.Sprintf("%d|%s|%s", b.Date, b.Amount, b.Item)
+}
+
+func (b *Bill) Validate() error {
+	if !utils.IsValidDateInt(b.Date) {
+		return fmt.Errorf("invalid date %d", b.Date)
+	}
+	if !ValidCurrency(NormalizeCurrency(b.Currency)) {
+		return fmt.Errorf("invalid currency %q", b.Currency)
+	}
+	return nil
 }
 
 const TABLE = "bill"
@@ -21,8 +52,10 @@ const SQLCreate = `
 		date INTEGER NOT NULL DEFAULT 0,
 		inout INTEGER NOT NULL DEFAULT -1,
 		type CHAR(20) NOT NULL DEFAULT "",
-		amount DECIMAL(10,2) NOT NULL DEFAULT 0.0,
-		item TEXT NOT NULL DEFAULT ""
+		amount INTEGER NOT NULL DEFAULT 0,
+		item TEXT NOT NULL DEFAULT "",
+		account INTEGER NOT NULL DEFAULT 0,
+		currency CHAR(3) NOT NULL DEFAULT ""
 	);`
 
 type Repository struct {
@@ -31,15 +64,161 @@ type Repository struct {
 
 func NewRepository(d *db.DB) *Repository {
 	base := db.NewBaseRepository[Bill](d, TABLE, SQLCreate, "")
+	base.PrepareNew = func(list []*Bill) error {
+		return NewRuleRepository(d).Categorize(list)
+	}
 	return &Repository{BaseRepository: base}
 }
 
 func (r *Repository) Add(b *Bill) (*Bill, error) {
-	if b.Date == 0 {
-		b.Date = utils.GetCurrentDateInt()
+	b.SetDefaults()
+	if err := b.Validate(); err != nil {
+		return nil, err
 	}
-	if b.Inout == 0 {
-		b.Inout = -1
+	if b.Type == "" {
+		if err := NewRuleRepository(r.DB).Categorize([]*Bill{b}); err != nil {
+			return nil, err
+		}
 	}
 	return r.BaseRepository.Add(b)
 }
+
+// UpdateByID 修改部分字段，币种统一为大写代码
+func (r *Repository) UpdateByID(id int, params map[string]any) error {
+	if c, ok := params["currency"].(string); ok {
+		c = NormalizeCurrency(c)
+		if !ValidCurrency(c) {
+			return fmt.Errorf("invalid currency %q", c)
+		}
+		params["currency"] = c
+	}
+	return r.BaseRepository.UpdateByID(id, params)
+}
+
+// ApplyRules 对日期范围内的账单重新应用规则，overwrite 为 false 时只处理未分类的账单
+func (r *Repository) ApplyRules(start, end int, overwrite, dryRun bool) (*ApplyResult, error) {
+	rules, err := NewRuleRepository(r.DB).Load()
+	if err != nil {
+		return nil, err
+	}
+	list, err := r.GetBetweenDates(start, end, "ASC")
+	if err != nil {
+		return nil, err
+	}
+	res := &ApplyResult{Bills: []*Bill{}}
+	for _, b := range list {
+		if b.Type != "" && !overwrite {
+			continue
+		}
+		old := b.Type
+		if rules.Categorize(b) == nil {
+			continue
+		}
+		res.Matched++
+		if b.Type != old {
+			res.Bills = append(res.Bills, b)
+		}
+	}
+	res.Updated = len(res.Bills)
+	if dryRun || res.Updated == 0 {
+		return res, nil
+	}
+	if err := r.UpdateMany(res.Bills); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// 账单模块的迁移，按加入的先后顺序执行
+func init() {
+	db.RegisterMigration("bill_account", migrateAccount)
+	db.RegisterMigration("bill_currency", migrateCurrency)
+	db.RegisterMigration("bill_money", migrateMoney)
+}
+
+// moneyTables 金额列从小数迁移为整数分的表
+var moneyTables = []struct {
+	table, create string
+	columns       []string
+}{
+	{TABLE, SQLCreate, []string{"amount"}},
+	{RecurringTable, SQLCreateRecurring, []string{"amount"}},
+	{TransferTable, SQLCreateTransfer, []string{"amount"}},
+	{BudgetTable, SQLCreateBudget, []string{"amount"}},
+	{AccountTable, SQLCreateAccount, []string{"opening", "statement"}},
+	{RuleTable, SQLCreateRule, []string{"min", "max"}},
+}
+
+// migrateMoney 旧库中的金额为小数，重建表将金额列改为 INTEGER 并换算为分
+// 列类型同时标记了金额的单位，恢复旧备份时据此换算（见 db.RestoreFrom）
+func migrateMoney(tx *sql.Tx) error {
+	for _, t := range moneyTables {
+		if err := rebuildMoneyTable(tx, t.table, t.create, t.columns); err != nil {
+			return fmt.Errorf("%s: %w", t.table, err)
+		}
+	}
+	return nil
+}
+
+func rebuildMoneyTable(tx *sql.Tx, table, create string, amounts []string) error {
+	types, err := columnTypes(tx, table)
+	if err != nil || len(types) == 0 {
+		return err
+	}
+	if strings.EqualFold(types[amounts[0]], "INTEGER") {
+		return nil
+	}
+
+	old := table + "_decimal"
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", table, old)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(create); err != nil {
+		return err
+	}
+	newTypes, err := columnTypes(tx, table)
+	if err != nil {
+		return err
+	}
+	isMoney := map[string]bool{}
+	for _, c := range amounts {
+		isMoney[c] = true
+	}
+	var cols, exprs []string
+	for c := range newTypes {
+		if _, ok := types[c]; !ok {
+			continue
+		}
+		cols = append(cols, c)
+		if isMoney[c] {
+			exprs = append(exprs, fmt.Sprintf("CAST(ROUND(%s * 100) AS INTEGER)", c))
+		} else {
+			exprs = append(exprs, c)
+		}
+	}
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s",
+		table, strings.Join(cols, ", "), strings.Join(exprs, ", "), old))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DROP TABLE " + old)
+	return err
+}
+
+// columnTypes 返回表的列名和声明的类型，表不存在时为空
+func columnTypes(tx *sql.Tx, table string) (map[string]string, error) {
+	rows, err := tx.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	types := map[string]string{}
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		types[name] = typ
+	}
+	return types, rows.Err()
+}
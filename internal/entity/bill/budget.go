@@ -0,0 +1,217 @@
+package bill
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"diarygo/internal/db"
+	"diarygo/internal/money"
+)
+
+// 预算结余的结转方式
+const (
+	RolloverNone    = 0 // 不结转
+	RolloverSurplus = 1 // 只结转未用完的额度
+	RolloverAll     = 2 // 结余和超支都结转
+)
+
+// 预算状态
+const (
+	BudgetOK      = "ok"
+	BudgetWarning = "warning"
+	BudgetOver    = "over"
+)
+
+// Budget 某分类每月的支出上限
+// Month 为 YYYYMM，0 表示默认适用于每个月，指定月份的预算优先
+type Budget struct {
+	ID        int          `json:"id"`
+	Type      string       `json:"type"`
+	Month     int          `json:"month"`
+	Amount    money.Amount `json:"amount"`
+	Rollover  int          `json:"rollover"`
+	Threshold int          `json:"threshold"` // 支出达到额度的百分比时提醒，默认 80
+}
+
+func (b *Budget) SetDefaults() {
+	if b.Threshold <= 0 {
+		b.Threshold = 80
+	}
+}
+
+func (b *Budget) Validate() error {
+	if b.Type == "" {
+		return errors.New("budget type is required")
+	}
+	if b.Month != 0 && (b.Month%100 < 1 || b.Month%100 > 12) {
+		return errors.New("month must be YYYYMM or 0")
+	}
+	if b.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if b.Rollover < RolloverNone || b.Rollover > RolloverAll {
+		return errors.New("invalid rollover")
+	}
+	return nil
+}
+
+// BudgetItem 单个分类的预算执行情况
+type BudgetItem struct {
+	Type      string       `json:"type"`
+	Limit     money.Amount `json:"limit"`
+	Carry     money.Amount `json:"carry"`     // 从之前月份结转的额度
+	Available money.Amount `json:"available"` // Limit + Carry
+	Spent     money.Amount `json:"spent"`
+	Remaining money.Amount `json:"remaining"`
+	Percent   float64      `json:"percent"`
+	Threshold int          `json:"threshold"`
+	Status    string       `json:"status"`
+}
+
+// BudgetStatus 某月所有预算的执行情况
+type BudgetStatus struct {
+	Month    int           `json:"month"`
+	Currency string        `json:"currency"`
+	Missing  []string      `json:"missing"` // 没有汇率、按 1:1 计算的币种
+	Items    []*BudgetItem `json:"items"`
+	Warnings []*BudgetItem `json:"warnings"` // 达到提醒比例或超支的分类
+}
+
+const BudgetTable = "bill_budget"
+const SQLCreateBudget = `
+	CREATE TABLE IF NOT EXISTS bill_budget (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type CHAR(20) NOT NULL DEFAULT "",
+		month INTEGER NOT NULL DEFAULT 0,
+		amount INTEGER NOT NULL DEFAULT 0,
+		rollover INTEGER NOT NULL DEFAULT 0,
+		threshold INTEGER NOT NULL DEFAULT 80
+	);`
+
+type BudgetRepository struct {
+	*db.BaseRepository[Budget]
+}
+
+func NewBudgetRepository(d *db.DB) *BudgetRepository {
+	base := db.NewBaseRepository[Budget](d, BudgetTable, SQLCreateBudget, "")
+	return &BudgetRepository{BaseRepository: base}
+}
+
+func (r *BudgetRepository) Add(b *Budget) (*Budget, error) {
+	b.SetDefaults()
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(b)
+}
+
+func (r *BudgetRepository) Update(b *Budget) error {
+	b.SetDefaults()
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(b)
+}
+
+// Status 计算 month（YYYYMM）各分类的预算执行情况，支出按账单日期的汇率换算为基准货币
+// 结转从当年 1 月开始累计，某月没有预算或不结转时清零
+func (r *BudgetRepository) Status(month int, conv *Converter) (*BudgetStatus, error) {
+	budgets, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	year := month / 100
+	bills, err := NewRepository(r.DB).GetBetweenDates(year*10000+101, month*100+31, "ASC")
+	if err != nil {
+		return nil, err
+	}
+
+	// 按分类和月份汇总支出
+	spent := map[string]map[int]money.Amount{}
+	for _, b := range bills {
+		if b.Inout >= 0 {
+			continue
+		}
+		if spent[b.Type] == nil {
+			spent[b.Type] = map[int]money.Amount{}
+		}
+		spent[b.Type][b.Date/100] += conv.Convert(b.Amount, b.Currency, b.Date)
+	}
+
+	byType := map[string][]*Budget{}
+	for _, b := range budgets {
+		byType[b.Type] = append(byType[b.Type], b)
+	}
+
+	status := &BudgetStatus{Month: month, Currency: conv.Base, Missing: conv.Missing(), Items: []*BudgetItem{}, Warnings: []*BudgetItem{}}
+	for typ, list := range byType {
+		cur := resolveBudget(list, month)
+		if cur == nil {
+			continue
+		}
+		var carry money.Amount
+		for m := year*100 + 1; m < month; m++ {
+			b := resolveBudget(list, m)
+			if b == nil || b.Rollover == RolloverNone {
+				carry = 0
+				continue
+			}
+			left := b.Amount + carry - spent[typ][m]
+			if b.Rollover == RolloverSurplus && left < 0 {
+				left = 0
+			}
+			carry = left
+		}
+		if cur.Rollover == RolloverNone {
+			carry = 0
+		}
+
+		item := &BudgetItem{
+			Type:      typ,
+			Limit:     cur.Amount,
+			Carry:     carry,
+			Available: cur.Amount + carry,
+			Spent:     spent[typ][month],
+			Threshold: cur.Threshold,
+			Status:    BudgetOK,
+		}
+		item.Remaining = item.Available - item.Spent
+		if item.Available > 0 {
+			item.Percent = round2(item.Spent.Float() / item.Available.Float() * 100)
+		} else if item.Spent > 0 {
+			item.Percent = 100
+		}
+		switch {
+		case item.Remaining < 0 || (item.Available <= 0 && item.Spent > 0):
+			item.Status = BudgetOver
+		case item.Percent >= float64(item.Threshold):
+			item.Status = BudgetWarning
+		}
+		status.Items = append(status.Items, item)
+		if item.Status != BudgetOK {
+			status.Warnings = append(status.Warnings, item)
+		}
+	}
+	sort.Slice(status.Items, func(i, j int) bool { return status.Items[i].Type < status.Items[j].Type })
+	sort.Slice(status.Warnings, func(i, j int) bool { return status.Warnings[i].Percent > status.Warnings[j].Percent })
+	return status, nil
+}
+
+// resolveBudget 指定月份的预算优先，否则使用默认预算
+func resolveBudget(list []*Budget, month int) *Budget {
+	var def *Budget
+	for _, b := range list {
+		if b.Month == month {
+			return b
+		}
+		if b.Month == 0 && def == nil {
+			def = b
+		}
+	}
+	return def
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,201 @@
+package bill
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"diarygo/internal/db"
+	"diarygo/internal/money"
+	"diarygo/internal/utils"
+)
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// NormalizeCurrency 币种统一为大写的 ISO 4217 代码
+func NormalizeCurrency(c string) string {
+	return strings.ToUpper(strings.TrimSpace(c))
+}
+
+// ValidCurrency 空字符串表示基准货币
+func ValidCurrency(c string) bool {
+	return c == "" || currencyCode.MatchString(c)
+}
+
+// Rate 汇率：从 Date 起 1 单位 Currency 折合 Rate 基准货币
+type Rate struct {
+	ID       int     `json:"id"`
+	Date     int     `json:"date"`
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+}
+
+func (r *Rate) SetDefaults() {
+	if r.Date == 0 {
+		r.Date = utils.GetCurrentDateInt()
+	}
+	r.Currency = NormalizeCurrency(r.Currency)
+}
+
+func (r *Rate) NaturalKey() string {
+	return fmt.Sprintf("%d|%s", r.Date, NormalizeCurrency(r.Currency))
+}
+
+func (r *Rate) Validate() error {
+	if !utils.IsValidDateInt(r.Date) {
+		return fmt.Errorf("invalid date %d", r.Date)
+	}
+	if !currencyCode.MatchString(NormalizeCurrency(r.Currency)) {
+		return fmt.Errorf("invalid currency %q", r.Currency)
+	}
+	if r.Rate <= 0 {
+		return errors.New("rate must be positive")
+	}
+	return nil
+}
+
+const RateTable = "bill_rate"
+const SQLCreateRate = `
+	CREATE TABLE IF NOT EXISTS bill_rate (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		date INTEGER NOT NULL DEFAULT 0,
+		currency CHAR(3) NOT NULL DEFAULT "",
+		rate DECIMAL(16,6) NOT NULL DEFAULT 1.0
+	);`
+
+// migrateCurrency 为旧库的账单、周期账单和转账补上币种列
+func migrateCurrency(tx *sql.Tx) error {
+	const def = `currency CHAR(3) NOT NULL DEFAULT ""`
+	for _, table := range []string{TABLE, RecurringTable, TransferTable} {
+		if err := db.AddColumns(tx, table, def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type RateRepository struct {
+	*db.BaseRepository[Rate]
+}
+
+func NewRateRepository(d *db.DB) *RateRepository {
+	base := db.NewBaseRepository[Rate](d, RateTable, SQLCreateRate, "")
+	return &RateRepository{BaseRepository: base}
+}
+
+// Add 同一天同一币种只能有一个汇率
+func (r *RateRepository) Add(rate *Rate) (*Rate, error) {
+	rate.SetDefaults()
+	if err := rate.Validate(); err != nil {
+		return nil, err
+	}
+	list, err := r.GetList("WHERE date = ? AND currency = ?", rate.Date, rate.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) > 0 {
+		return nil, fmt.Errorf("rate for %s on %d exists", rate.Currency, rate.Date)
+	}
+	return r.BaseRepository.Add(rate)
+}
+
+func (r *RateRepository) Update(rate *Rate) error {
+	rate.SetDefaults()
+	if err := rate.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(rate)
+}
+
+// ImportWith 汇率文件一般没有 id，覆盖模式按日期+币种匹配已有汇率
+func (r *RateRepository) ImportWith(reader io.Reader, opts db.ImportOptions) (*db.ImportReport, error) {
+	if opts.Strategy == "" || opts.Strategy == db.StrategyOverwrite {
+		opts.Strategy = db.StrategyNaturalKey
+	}
+	return r.BaseRepository.ImportWith(reader, opts)
+}
+
+// Converter 按账单日期的汇率把金额换算为基准货币
+type Converter struct {
+	Base    string
+	rates   map[string][]*Rate // 按日期升序
+	missing map[string]bool
+}
+
+// Converter 读取所有汇率，base 为基准货币
+func (r *RateRepository) Converter(base string) (*Converter, error) {
+	list, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	return NewConverter(base, list), nil
+}
+
+func NewConverter(base string, list []*Rate) *Converter {
+	c := &Converter{
+		Base:    NormalizeCurrency(base),
+		rates:   map[string][]*Rate{},
+		missing: map[string]bool{},
+	}
+	for _, r := range list {
+		cur := NormalizeCurrency(r.Currency)
+		c.rates[cur] = append(c.rates[cur], r)
+	}
+	for _, l := range c.rates {
+		sort.Slice(l, func(i, j int) bool { return l[i].Date < l[j].Date })
+	}
+	return c
+}
+
+// Rate 返回 date 当天适用的汇率：当天或之前最近的一条，早于所有汇率时用最早的一条
+// 没有该币种的汇率时按 1 计算并记录到 Missing
+func (c *Converter) Rate(currency string, date int) float64 {
+	currency = NormalizeCurrency(currency)
+	if currency == "" || currency == c.Base {
+		return 1
+	}
+	list := c.rates[currency]
+	if len(list) == 0 {
+		c.missing[currency] = true
+		return 1
+	}
+	i := sort.Search(len(list), func(i int) bool { return list[i].Date > date })
+	if i == 0 {
+		return list[0].Rate
+	}
+	return list[i-1].Rate
+}
+
+// Convert 换算为基准货币，四舍五入到分
+func (c *Converter) Convert(amount money.Amount, currency string, date int) money.Amount {
+	return amount.Mul(c.Rate(currency, date))
+}
+
+// Missing 返回换算过程中没有汇率的币种
+func (c *Converter) Missing() []string {
+	list := make([]string, 0, len(c.missing))
+	for cur := range c.missing {
+		list = append(list, cur)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Converted 附带基准货币金额的账单
+type Converted struct {
+	*Bill
+	Base money.Amount `json:"base"`
+}
+
+// ConvertBills 为账单附上基准货币金额
+func (c *Converter) ConvertBills(list []*Bill) []*Converted {
+	out := make([]*Converted, len(list))
+	for i, b := range list {
+		out[i] = &Converted{Bill: b, Base: c.Convert(b.Amount, b.Currency, b.Date)}
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package bill
+
+import (
+	"errors"
+
+	"diarygo/internal/db"
+)
+
+// 账单 CSV 中金额的正负含义
+const (
+	SignExpenseNegative = "negative" // 负数为支出（默认，多数借记卡）
+	SignExpensePositive = "positive" // 正数为支出（多数信用卡）
+)
+
+// Profile 银行 CSV 对账单的列映射
+// 列可以写表头名称或从 1 开始的列号，Item 可用逗号连接多列
+type Profile struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Delimiter string `json:"delimiter"` // 为空时为逗号
+	Skip      int    `json:"skip"`      // 表头之前需要跳过的行数
+	Date      string `json:"date"`
+	Format    string `json:"format"` // 日期格式，如 YYYY-MM-DD、MM/DD/YYYY
+	Amount    string `json:"amount"` // 带符号的金额列，与 Debit/Credit 二选一
+	Debit     string `json:"debit"`  // 支出列
+	Credit    string `json:"credit"` // 收入列
+	Item      string `json:"item"`
+	Type      string `json:"type"` // 可选的分类列
+	Sign      string `json:"sign"`
+}
+
+func (p *Profile) SetDefaults() {
+	if p.Delimiter == "" {
+		p.Delimiter = ","
+	}
+	if p.Format == "" {
+		p.Format = "YYYY-MM-DD"
+	}
+	if p.Sign == "" {
+		p.Sign = SignExpenseNegative
+	}
+}
+
+func (p *Profile) Validate() error {
+	if p.Name == "" {
+		return errors.New("profile name is required")
+	}
+	if p.Date == "" {
+		return errors.New("date column is required")
+	}
+	if p.Amount == "" && p.Debit == "" && p.Credit == "" {
+		return errors.New("amount or debit/credit column is required")
+	}
+	if p.Sign != SignExpenseNegative && p.Sign != SignExpensePositive {
+		return errors.New("sign must be negative or positive")
+	}
+	if len([]rune(p.Delimiter)) != 1 {
+		return errors.New("delimiter must be a single character")
+	}
+	return nil
+}
+
+const ProfileTable = "bill_profile"
+const SQLCreateProfile = `
+	CREATE TABLE IF NOT EXISTS bill_profile (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL DEFAULT "",
+		delimiter TEXT NOT NULL DEFAULT ",",
+		skip INTEGER NOT NULL DEFAULT 0,
+		date TEXT NOT NULL DEFAULT "",
+		format TEXT NOT NULL DEFAULT "",
+		amount TEXT NOT NULL DEFAULT "",
+		debit TEXT NOT NULL DEFAULT "",
+		credit TEXT NOT NULL DEFAULT "",
+		item TEXT NOT NULL DEFAULT "",
+		type TEXT NOT NULL DEFAULT "",
+		sign TEXT NOT NULL DEFAULT "negative"
+	);`
+
+type ProfileRepository struct {
+	*db.BaseRepository[Profile]
+}
+
+func NewProfileRepository(d *db.DB) *ProfileRepository {
+	base := db.NewBaseRepository[Profile](d, ProfileTable, SQLCreateProfile, "")
+	return &ProfileRepository{BaseRepository: base}
+}
+
+func (r *ProfileRepository) Add(p *Profile) (*Profile, error) {
+	p.SetDefaults()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(p)
+}
+
+func (r *ProfileRepository) Update(p *Profile) error {
+	p.SetDefaults()
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(p)
+}
@@ -0,0 +1,250 @@
+package bill
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"diarygo/internal/db"
+	"diarygo/internal/money"
+	"diarygo/internal/utils"
+)
+
+// 周期账单的频率，用整数保存，未登录（无法解密）时也能计算日期
+const (
+	FreqWeekly  = 1
+	FreqMonthly = 2
+	FreqYearly  = 3
+)
+
+// Recurring 周期账单模板，如房租、话费、订阅
+type Recurring struct {
+	ID       int          `json:"id"`
+	Inout    int          `json:"inout"`
+	Type     string       `json:"type"`
+	Amount   money.Amount `json:"amount"`
+	Item     string       `json:"item"`
+	Freq     int          `json:"freq"`
+	Interval int          `json:"interval"` // 每 N 周/月/年
+	Day      int          `json:"day"`      // 每月第几天，超过月末时取月末；0 取开始日期的日
+	Since    int          `json:"since"`
+	Until    int          `json:"until"`  // 0 表示不结束
+	Active   int          `json:"active"` // 0 暂停
+	Last     int          `json:"last"`   // 最后一次已生成账单的日期
+	Account  int          `json:"account"`
+	Currency string       `json:"currency"`
+}
+
+func (r *Recurring) SetDefaults() {
+	if r.Inout == 0 {
+		r.Inout = -1
+	}
+	if r.Freq == 0 {
+		r.Freq = FreqMonthly
+	}
+	if r.Interval <= 0 {
+		r.Interval = 1
+	}
+	if r.Since == 0 {
+		r.Since = utils.GetCurrentDateInt()
+	}
+	r.Currency = NormalizeCurrency(r.Currency)
+}
+
+func (r *Recurring) Validate() error {
+	if r.Freq != FreqWeekly && r.Freq != FreqMonthly && r.Freq != FreqYearly {
+		return fmt.Errorf("invalid freq %d", r.Freq)
+	}
+	if !utils.IsValidDateInt(r.Since) {
+		return fmt.Errorf("invalid since %d", r.Since)
+	}
+	if r.Until != 0 && (!utils.IsValidDateInt(r.Until) || r.Until < r.Since) {
+		return fmt.Errorf("invalid until %d", r.Until)
+	}
+	if r.Day < 0 || r.Day > 31 {
+		return errors.New("day must be between 0 and 31")
+	}
+	if r.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if !ValidCurrency(NormalizeCurrency(r.Currency)) {
+		return fmt.Errorf("invalid currency %q", r.Currency)
+	}
+	return nil
+}
+
+// Occurrences 返回 (after, until] 之间的所有日期，until 超过结束日期时截止到结束日期
+func (r *Recurring) Occurrences(after, until int) []int {
+	if r.Until != 0 && until > r.Until {
+		until = r.Until
+	}
+	var dates []int
+	for k := 0; ; k++ {
+		d := r.occurrence(k)
+		if d > until {
+			break
+		}
+		if d > after && d >= r.Since {
+			dates = append(dates, d)
+		}
+	}
+	return dates
+}
+
+// occurrence 第 k 次的日期
+func (r *Recurring) occurrence(k int) int {
+	start := intToDate(r.Since)
+	step := max(r.Interval, 1)
+	switch r.Freq {
+	case FreqWeekly:
+		return utils.Date2Int(start.AddDate(0, 0, 7*step*k))
+	case FreqYearly:
+		return clampDate(start.Year()+step*k, int(start.Month()), start.Day())
+	}
+	day := r.Day
+	if day == 0 {
+		day = start.Day()
+	}
+	months := int(start.Month()) - 1 + step*k
+	return clampDate(start.Year()+months/12, months%12+1, day)
+}
+
+func intToDate(d int) time.Time {
+	return time.Date(d/10000, time.Month(d/100%100), d%100, 0, 0, 0, 0, time.Local)
+}
+
+// clampDate 日期超过月末时取月末，如 1 月 31 日的下个月为 2 月 28/29 日
+func clampDate(y, m, d int) int {
+	last := time.Date(y, time.Month(m)+1, 0, 0, 0, 0, 0, time.Local).Day()
+	return utils.YMD2Int(y, m, min(d, last))
+}
+
+const RecurringTable = "bill_recurring"
+const SQLCreateRecurring = `
+	CREATE TABLE IF NOT EXISTS bill_recurring (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		inout INTEGER NOT NULL DEFAULT -1,
+		type CHAR(20) NOT NULL DEFAULT "",
+		amount INTEGER NOT NULL DEFAULT 0,
+		item TEXT NOT NULL DEFAULT "",
+		freq INTEGER NOT NULL DEFAULT 2,
+		interval INTEGER NOT NULL DEFAULT 1,
+		day INTEGER NOT NULL DEFAULT 0,
+		since INTEGER NOT NULL DEFAULT 0,
+		until INTEGER NOT NULL DEFAULT 0,
+		active INTEGER NOT NULL DEFAULT 1,
+		last INTEGER NOT NULL DEFAULT 0,
+		account INTEGER NOT NULL DEFAULT 0,
+		currency CHAR(3) NOT NULL DEFAULT ""
+	);`
+
+type RecurringRepository struct {
+	*db.BaseRepository[Recurring]
+}
+
+func NewRecurringRepository(d *db.DB) *RecurringRepository {
+	base := db.NewBaseRepository[Recurring](d, RecurringTable, SQLCreateRecurring, "")
+	return &RecurringRepository{BaseRepository: base}
+}
+
+func (r *RecurringRepository) Add(rec *Recurring) (*Recurring, error) {
+	rec.SetDefaults()
+	rec.Active = 1
+	rec.Last = 0
+	if err := rec.Validate(); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(rec)
+}
+
+// Update 修改模板，已生成的进度保持不变，避免重复生成
+func (r *RecurringRepository) Update(rec *Recurring) error {
+	old, err := r.GetByID(rec.ID)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return fmt.Errorf("recurring %d not found", rec.ID)
+	}
+	return r.save(old, rec)
+}
+
+// UpdateByID 修改部分字段，没有给出的字段（包括 active）保持原值
+func (r *RecurringRepository) UpdateByID(id int, params map[string]any) error {
+	old, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return fmt.Errorf("recurring %d not found", id)
+	}
+	rec := *old
+	if err := utils.ApplyParams(&rec, params); err != nil {
+		return err
+	}
+	return r.save(old, &rec)
+}
+
+// save 从暂停恢复时把进度推到昨天，暂停期间错过的账单不再补生成
+func (r *RecurringRepository) save(old, rec *Recurring) error {
+	rec.SetDefaults()
+	if err := rec.Validate(); err != nil {
+		return err
+	}
+	rec.Last = old.Last
+	if old.Active == 0 && rec.Active != 0 {
+		rec.Last = max(rec.Last, utils.Date2Int(time.Now().AddDate(0, 0, -1)))
+	}
+	return r.BaseRepository.Update(rec)
+}
+
+// Materialize 为所有启用的模板生成截至 today 的账单，返回生成数量
+// 每个模板的账单和进度在同一事务中写入，重复执行或停机后补生成都不会重复；
+// 直接复制库中的加密内容，未登录时也可以运行
+func (r *RecurringRepository) Materialize(today int) (int, error) {
+	db.GlobalWriteMutex.Lock()
+	defer db.GlobalWriteMutex.Unlock()
+
+	list, err := db.SelectListRaw[Recurring](r.DB, r.Table, "WHERE active = 1")
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, rec := range list {
+		dates := rec.Occurrences(rec.Last, today)
+		if len(dates) == 0 {
+			continue
+		}
+		n, err := r.materialize(rec, dates)
+		if err != nil {
+			return total, fmt.Errorf("recurring %d: %w", rec.ID, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (r *RecurringRepository) materialize(rec *Recurring, dates []int) (int, error) {
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// 以 last 作为条件，其它进程已生成时不再重复
+	last := dates[len(dates)-1]
+	res, err := tx.Exec(`UPDATE bill_recurring SET last = ? WHERE id = ? AND last = ?`, last, rec.ID, rec.Last)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, nil
+	}
+	for _, d := range dates {
+		args := db.EncryptArgs([]any{d, rec.Inout, rec.Type, rec.Amount, rec.Item, rec.Account, rec.Currency})
+		if _, err := tx.Exec(`INSERT INTO bill (date, inout, type, amount, item, account, currency) VALUES (?, ?, ?, ?, ?, ?, ?)`, args...); err != nil {
+			return 0, err
+		}
+	}
+	return len(dates), tx.Commit()
+}
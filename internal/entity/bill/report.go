@@ -0,0 +1,291 @@
+package bill
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"diarygo/internal/money"
+	"diarygo/internal/utils"
+)
+
+// Totals 收入、支出、净额（收入-支出）和账单笔数
+type Totals struct {
+	Income  money.Amount `json:"income"`
+	Expense money.Amount `json:"expense"`
+	Net     money.Amount `json:"net"`
+	Count   int          `json:"count"`
+}
+
+func (t *Totals) add(income bool, amount money.Amount, count int) {
+	if income {
+		t.Income += amount
+	} else {
+		t.Expense += amount
+	}
+	t.Net = t.Income - t.Expense
+	t.Count += count
+}
+
+// TypeTotal 分类汇总，Share 为该分类支出占总支出的百分比
+type TypeTotal struct {
+	Type string `json:"type"`
+	Totals
+	Share float64 `json:"share"`
+}
+
+// PeriodTotal 按年（YYYY）、月（YYYYMM）或 ISO 周（YYYYWW）汇总，Start 为该周期第一天
+type PeriodTotal struct {
+	Period int `json:"period"`
+	Start  int `json:"start"`
+	Totals
+}
+
+// ItemTotal 按摘要汇总的支出
+type ItemTotal struct {
+	Item   string       `json:"item"`
+	Amount money.Amount `json:"amount"`
+	Count  int          `json:"count"`
+}
+
+// Average 日均、周均、月均和每笔平均金额
+type Average struct {
+	Daily   money.Amount `json:"daily"`
+	Weekly  money.Amount `json:"weekly"`
+	Monthly money.Amount `json:"monthly"`
+	PerBill money.Amount `json:"per_bill"`
+}
+
+// Comparison 与上一个等长周期的对比，变化为百分比，上期为 0 时为空
+type Comparison struct {
+	Start   int      `json:"start"`
+	End     int      `json:"end"`
+	Totals  Totals   `json:"totals"`
+	Income  *float64 `json:"income_change"`
+	Expense *float64 `json:"expense_change"`
+	Net     *float64 `json:"net_change"`
+}
+
+// Report 日期范围内的账单统计，金额均为基准货币
+type Report struct {
+	Start    int      `json:"start"`
+	End      int      `json:"end"`
+	Days     int      `json:"days"`
+	Currency string   `json:"currency"`
+	Missing  []string `json:"missing"`
+
+	Totals   Totals         `json:"totals"`
+	Income   Average        `json:"average_income"`
+	Expense  Average        `json:"average_expense"`
+	ByType   []*TypeTotal   `json:"by_type"`
+	ByYear   []*PeriodTotal `json:"by_year"`
+	ByMonth  []*PeriodTotal `json:"by_month"`
+	ByWeek   []*PeriodTotal `json:"by_week"`
+	TopItems []*ItemTotal   `json:"top_items"`
+	Previous *Comparison    `json:"previous"`
+}
+
+// reportRow SQL 按分类、币种、日期和收支汇总后的一行
+type reportRow struct {
+	Type     string
+	Currency string
+	Date     int
+	Income   bool
+	Amount   money.Amount
+	Count    int
+}
+
+// Report 统计 [start, end] 的账单，top 为支出最多的摘要数量
+// 金额不加密、分类和摘要为确定性加密，可以直接在 SQL 中分组汇总，再按当天汇率换算
+func (r *Repository) Report(start, end, top int, conv *Converter) (*Report, error) {
+	if !utils.IsValidDateInt(start) || !utils.IsValidDateInt(end) || start > end {
+		return nil, fmt.Errorf("invalid date range %d-%d", start, end)
+	}
+	rows, err := r.aggregate(start, end, conv)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := intToDate(start), intToDate(end)
+	days := int(to.Sub(from).Hours()/24+0.5) + 1
+	rep := &Report{
+		Start:    start,
+		End:      end,
+		Days:     days,
+		Currency: conv.Base,
+		ByType:   []*TypeTotal{},
+		TopItems: []*ItemTotal{},
+	}
+
+	years := periods(from, to, utils.PeriodYear)
+	months := periods(from, to, utils.PeriodMonth)
+	weeks := periods(from, to, utils.PeriodWeek)
+
+	byType := map[string]*TypeTotal{}
+	var incomeBills, expenseBills int
+	for _, row := range rows {
+		rep.Totals.add(row.Income, row.Amount, row.Count)
+		if row.Income {
+			incomeBills += row.Count
+		} else {
+			expenseBills += row.Count
+		}
+		t := byType[row.Type]
+		if t == nil {
+			t = &TypeTotal{Type: row.Type}
+			byType[row.Type] = t
+			rep.ByType = append(rep.ByType, t)
+		}
+		t.add(row.Income, row.Amount, row.Count)
+
+		d := intToDate(row.Date)
+		years.get(d.Year()).add(row.Income, row.Amount, row.Count)
+		months.get(d.Year()*100+int(d.Month())).add(row.Income, row.Amount, row.Count)
+		week, _ := utils.ISOWeek(d)
+		weeks.get(week).add(row.Income, row.Amount, row.Count)
+	}
+	for _, t := range rep.ByType {
+		if rep.Totals.Expense > 0 {
+			t.Share = round2(t.Expense.Float() / rep.Totals.Expense.Float() * 100)
+		}
+	}
+	sort.Slice(rep.ByType, func(i, j int) bool {
+		a, b := rep.ByType[i], rep.ByType[j]
+		if a.Expense != b.Expense {
+			return a.Expense > b.Expense
+		}
+		if a.Income != b.Income {
+			return a.Income > b.Income
+		}
+		return a.Type < b.Type
+	})
+	rep.ByYear, rep.ByMonth, rep.ByWeek = years.list, months.list, weeks.list
+
+	rep.Income = average(rep.Totals.Income, incomeBills, days, len(rep.ByMonth))
+	rep.Expense = average(rep.Totals.Expense, expenseBills, days, len(rep.ByMonth))
+
+	if top > 0 {
+		if rep.TopItems, err = r.topItems(start, end, top, conv); err != nil {
+			return nil, err
+		}
+	}
+
+	// 上一个等长周期
+	prevEnd := utils.Date2Int(from.AddDate(0, 0, -1))
+	prevStart := utils.Date2Int(from.AddDate(0, 0, -days))
+	prevRows, err := r.aggregate(prevStart, prevEnd, conv)
+	if err != nil {
+		return nil, err
+	}
+	prev := &Comparison{Start: prevStart, End: prevEnd}
+	for _, row := range prevRows {
+		prev.Totals.add(row.Income, row.Amount, row.Count)
+	}
+	prev.Income = change(rep.Totals.Income, prev.Totals.Income)
+	prev.Expense = change(rep.Totals.Expense, prev.Totals.Expense)
+	prev.Net = change(rep.Totals.Net, prev.Totals.Net)
+	rep.Previous = prev
+
+	rep.Missing = conv.Missing()
+	return rep, nil
+}
+
+// aggregate 按分类、币种、日期和收支汇总，金额换算为基准货币
+func (r *Repository) aggregate(start, end int, conv *Converter) ([]*reportRow, error) {
+	rows, err := r.DB.Select(`
+		SELECT type, currency, date, inout > 0, SUM(amount), COUNT(*)
+		FROM bill WHERE date >= ? AND date <= ?
+		GROUP BY type, currency, date, inout > 0`,
+		[]any{start, end}, true)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*reportRow, 0, len(rows))
+	for _, row := range rows {
+		cur, d := rowString(row[1]), rowInt(row[2])
+		list = append(list, &reportRow{
+			Type:     rowString(row[0]),
+			Currency: cur,
+			Date:     d,
+			Income:   rowInt(row[3]) == 1,
+			Amount:   conv.Convert(rowAmount(row[4]), cur, d),
+			Count:    rowInt(row[5]),
+		})
+	}
+	return list, nil
+}
+
+// topItems 支出金额最多的摘要
+func (r *Repository) topItems(start, end, top int, conv *Converter) ([]*ItemTotal, error) {
+	rows, err := r.DB.Select(`
+		SELECT item, currency, date, SUM(amount), COUNT(*)
+		FROM bill WHERE date >= ? AND date <= ? AND inout < 0
+		GROUP BY item, currency, date`,
+		[]any{start, end}, true)
+	if err != nil {
+		return nil, err
+	}
+	byItem := map[string]*ItemTotal{}
+	list := []*ItemTotal{}
+	for _, row := range rows {
+		item := rowString(row[0])
+		t := byItem[item]
+		if t == nil {
+			t = &ItemTotal{Item: item}
+			byItem[item] = t
+			list = append(list, t)
+		}
+		t.Amount += conv.Convert(rowAmount(row[3]), rowString(row[1]), rowInt(row[2]))
+		t.Count += rowInt(row[4])
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Amount != list[j].Amount {
+			return list[i].Amount > list[j].Amount
+		}
+		return list[i].Item < list[j].Item
+	})
+	if len(list) > top {
+		list = list[:top]
+	}
+	return list, nil
+}
+
+// periodSet 覆盖整个日期范围的周期，没有账单的周期金额为 0
+type periodSet struct {
+	list  []*PeriodTotal
+	index map[int]*PeriodTotal
+}
+
+func (s *periodSet) get(period int) *Totals {
+	return &s.index[period].Totals
+}
+
+func periods(from, to time.Time, unit utils.PeriodUnit) *periodSet {
+	s := &periodSet{list: []*PeriodTotal{}, index: map[int]*PeriodTotal{}}
+	for _, p := range utils.Periods(from, to, unit) {
+		s.index[p.Key] = &PeriodTotal{Period: p.Key, Start: p.Start}
+		s.list = append(s.list, s.index[p.Key])
+	}
+	return s
+}
+
+func average(total money.Amount, bills, days, months int) Average {
+	a := Average{
+		Daily:   total.Mul(1 / float64(days)),
+		Weekly:  total.Mul(7 / float64(days)),
+		Monthly: total.Mul(1 / float64(months)),
+	}
+	if bills > 0 {
+		a.PerBill = total.Mul(1 / float64(bills))
+	}
+	return a
+}
+
+// change 相对上期的变化百分比
+func change(cur, prev money.Amount) *float64 {
+	if prev == 0 {
+		return nil
+	}
+	v := round2((cur - prev).Float() / prev.Abs().Float() * 100)
+	return &v
+}
@@ -0,0 +1,170 @@
+package bill
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"diarygo/internal/db"
+	"diarygo/internal/money"
+)
+
+// Rule 账单自动分类规则，所有条件都满足时将分类设为 Type
+type Rule struct {
+	ID       int          `json:"id"`
+	Pattern  string       `json:"pattern"` // 匹配项目，为空时不限
+	Regex    int          `json:"regex"`   // 1 时 Pattern 为正则表达式，否则为不区分大小写的子串
+	Inout    int          `json:"inout"`   // 0 不限
+	Min      money.Amount `json:"min"`     // 金额下限，0 不限
+	Max      money.Amount `json:"max"`     // 金额上限，0 不限
+	Type     string       `json:"type"`
+	Priority int          `json:"priority"` // 越大越优先
+}
+
+func (r *Rule) Validate() error {
+	if r.Type == "" {
+		return errors.New("rule type is required")
+	}
+	if r.Regex == 1 {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return err
+		}
+	}
+	if r.Max > 0 && r.Min > r.Max {
+		return errors.New("min is greater than max")
+	}
+	return nil
+}
+
+// Match 判断账单是否满足规则
+func (r *Rule) Match(b *Bill) bool {
+	return r.matcher()(b)
+}
+
+func (r *Rule) matcher() func(b *Bill) bool {
+	var matchItem func(s string) bool
+	switch {
+	case r.Pattern == "":
+		matchItem = func(string) bool { return true }
+	case r.Regex == 1:
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return func(*Bill) bool { return false }
+		}
+		matchItem = re.MatchString
+	default:
+		p := strings.ToLower(r.Pattern)
+		matchItem = func(s string) bool { return strings.Contains(strings.ToLower(s), p) }
+	}
+	return func(b *Bill) bool {
+		if r.Inout != 0 && r.Inout != b.Inout {
+			return false
+		}
+		if r.Min > 0 && b.Amount < r.Min {
+			return false
+		}
+		if r.Max > 0 && b.Amount > r.Max {
+			return false
+		}
+		return matchItem(b.Item)
+	}
+}
+
+// Rules 按优先级排好序的规则集
+type Rules struct {
+	rules    []*Rule
+	matchers []func(b *Bill) bool
+}
+
+func NewRules(list []*Rule) *Rules {
+	sorted := append([]*Rule(nil), list...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	rs := &Rules{rules: sorted}
+	for _, r := range sorted {
+		rs.matchers = append(rs.matchers, r.matcher())
+	}
+	return rs
+}
+
+// Categorize 设置第一条匹配规则的分类，返回匹配的规则
+func (rs *Rules) Categorize(b *Bill) *Rule {
+	for i, m := range rs.matchers {
+		if m(b) {
+			b.Type = rs.rules[i].Type
+			return rs.rules[i]
+		}
+	}
+	return nil
+}
+
+// ApplyResult 批量应用规则的结果
+type ApplyResult struct {
+	Matched int     `json:"matched"`
+	Updated int     `json:"updated"`
+	Bills   []*Bill `json:"bills"` // 分类有变化的账单
+}
+
+const RuleTable = "bill_rule"
+const SQLCreateRule = `
+	CREATE TABLE IF NOT EXISTS bill_rule (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		pattern TEXT NOT NULL DEFAULT "",
+		regex INTEGER NOT NULL DEFAULT 0,
+		inout INTEGER NOT NULL DEFAULT 0,
+		min INTEGER NOT NULL DEFAULT 0,
+		max INTEGER NOT NULL DEFAULT 0,
+		type CHAR(20) NOT NULL DEFAULT "",
+		priority INTEGER NOT NULL DEFAULT 0
+	);`
+
+type RuleRepository struct {
+	*db.BaseRepository[Rule]
+}
+
+func NewRuleRepository(d *db.DB) *RuleRepository {
+	base := db.NewBaseRepository[Rule](d, RuleTable, SQLCreateRule, "")
+	return &RuleRepository{BaseRepository: base}
+}
+
+func (r *RuleRepository) Add(rule *Rule) (*Rule, error) {
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(rule)
+}
+
+func (r *RuleRepository) Update(rule *Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(rule)
+}
+
+// Load 读取全部规则
+func (r *RuleRepository) Load() (*Rules, error) {
+	list, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	return NewRules(list), nil
+}
+
+// Categorize 为未分类的账单按规则设置分类
+func (r *RuleRepository) Categorize(list []*Bill) error {
+	rules, err := r.Load()
+	if err != nil {
+		return err
+	}
+	for _, b := range list {
+		if b.Type == "" {
+			rules.Categorize(b)
+		}
+	}
+	return nil
+}
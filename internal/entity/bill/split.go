@@ -0,0 +1,453 @@
+package bill
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"diarygo/internal/db"
+	"diarygo/internal/money"
+	"diarygo/internal/utils"
+)
+
+// Me 分摊中代表自己的参与人 id
+const Me = 0
+
+// Person 分摊账单的参与人，自己固定为 Me，不需要添加
+type Person struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Note string `json:"note"`
+}
+
+func (p *Person) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("person name is required")
+	}
+	return nil
+}
+
+const PersonTable = "bill_person"
+const SQLCreatePerson = `
+	CREATE TABLE IF NOT EXISTS bill_person (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name CHAR(40) NOT NULL DEFAULT "",
+		note TEXT NOT NULL DEFAULT ""
+	);`
+
+// Split 一笔多人分摊的付款，由 Payer 支付，按 Share 分给各参与人
+// Settle 为 1 表示还款：Payer 把钱还给唯一的参与人
+type Split struct {
+	ID       int          `json:"id"`
+	Date     int          `json:"date"`
+	Item     string       `json:"item"`
+	Payer    int          `json:"payer"`
+	Amount   money.Amount `json:"amount"`
+	Currency string       `json:"currency"`
+	Bill     int          `json:"bill"` // 对应的账单，0 表示未关联
+	Settle   int          `json:"settle"`
+}
+
+// Share 参与人应承担的金额，币种与所属的 Split 相同
+type Share struct {
+	ID     int          `json:"id"`
+	Split  int          `json:"split"`
+	Person int          `json:"person"`
+	Amount money.Amount `json:"amount"`
+}
+
+const SplitTable = "bill_split"
+const SQLCreateSplit = `
+	CREATE TABLE IF NOT EXISTS bill_split (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		date INTEGER NOT NULL DEFAULT 0,
+		item TEXT NOT NULL DEFAULT "",
+		payer INTEGER NOT NULL DEFAULT 0,
+		amount INTEGER NOT NULL DEFAULT 0,
+		currency CHAR(3) NOT NULL DEFAULT "",
+		bill INTEGER NOT NULL DEFAULT 0,
+		settle INTEGER NOT NULL DEFAULT 0
+	);`
+
+const ShareTable = "bill_share"
+const SQLCreateShare = `
+	CREATE TABLE IF NOT EXISTS bill_share (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		split INTEGER NOT NULL DEFAULT 0,
+		person INTEGER NOT NULL DEFAULT 0,
+		amount INTEGER NOT NULL DEFAULT 0
+	);`
+const SQLIndexShare = `CREATE INDEX IF NOT EXISTS idx_bill_share_split ON bill_share (split);`
+
+// SplitDetail 分摊及其各参与人的份额，接口中以此整体读写
+type SplitDetail struct {
+	*Split
+	Shares []*Share `json:"shares"`
+}
+
+func (s *SplitDetail) SetDefaults() {
+	if s.Date == 0 {
+		s.Date = utils.GetCurrentDateInt()
+	}
+	s.Currency = NormalizeCurrency(s.Currency)
+	if s.Settle != 0 {
+		s.Settle = 1
+	}
+	// 份额都为 0 时平均分摊，除不尽的分依次分给前面的参与人
+	if len(s.Shares) == 0 || s.Amount <= 0 {
+		return
+	}
+	for _, sh := range s.Shares {
+		if sh.Amount != 0 {
+			return
+		}
+	}
+	n := money.Amount(len(s.Shares))
+	for i, sh := range s.Shares {
+		sh.Amount = s.Amount / n
+		if money.Amount(i) < s.Amount%n {
+			sh.Amount++
+		}
+	}
+}
+
+func (s *SplitDetail) Validate() error {
+	if !utils.IsValidDateInt(s.Date) {
+		return fmt.Errorf("invalid date %d", s.Date)
+	}
+	if s.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if !ValidCurrency(s.Currency) {
+		return fmt.Errorf("invalid currency %q", s.Currency)
+	}
+	if len(s.Shares) == 0 {
+		return errors.New("at least one share is required")
+	}
+	if s.Settle == 1 && (len(s.Shares) != 1 || s.Shares[0].Person == s.Payer) {
+		return errors.New("settlement must be paid to one other person")
+	}
+	seen := map[int]bool{}
+	var total money.Amount
+	for _, sh := range s.Shares {
+		if seen[sh.Person] {
+			return fmt.Errorf("duplicate share for person %d", sh.Person)
+		}
+		seen[sh.Person] = true
+		if sh.Amount < 0 {
+			return errors.New("share amount must not be negative")
+		}
+		total += sh.Amount
+	}
+	if total != s.Amount {
+		return fmt.Errorf("shares add up to %s, expected %s", total, s.Amount)
+	}
+	return nil
+}
+
+// PersonBalance 参与人的分摊情况，Net 为正表示别人欠他，为负表示他欠别人
+type PersonBalance struct {
+	Person int          `json:"person"`
+	Name   string       `json:"name"`
+	Paid   money.Amount `json:"paid"`  // 替大家支付的金额
+	Share  money.Amount `json:"share"` // 自己应承担的金额
+	Net    money.Amount `json:"net"`   // 含还款
+}
+
+// Debt From 欠 To 的净额
+type Debt struct {
+	From     int          `json:"from"`
+	FromName string       `json:"from_name"`
+	To       int          `json:"to"`
+	ToName   string       `json:"to_name"`
+	Amount   money.Amount `json:"amount"`
+}
+
+// SettleReport 分摊结算情况，金额均为基准货币
+type SettleReport struct {
+	Currency string           `json:"currency"`
+	Missing  []string         `json:"missing"`
+	Balances []*PersonBalance `json:"balances"`
+	Debts    []*Debt          `json:"debts"`
+}
+
+type PersonRepository struct {
+	*db.BaseRepository[Person]
+}
+
+func NewPersonRepository(d *db.DB) *PersonRepository {
+	base := db.NewBaseRepository[Person](d, PersonTable, SQLCreatePerson, "")
+	return &PersonRepository{BaseRepository: base}
+}
+
+func (r *PersonRepository) Add(p *Person) (*Person, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(p)
+}
+
+func (r *PersonRepository) Update(p *Person) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(p)
+}
+
+// DeleteByID 参与过分摊的人不能删除
+func (r *PersonRepository) DeleteByID(id int) error {
+	NewSplitRepository(r.DB) // 确保分摊表已创建
+	var n int
+	err := r.DB.Conn.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM bill_split WHERE payer = ?) +
+		       (SELECT COUNT(*) FROM bill_share WHERE person = ?)`,
+		id, id).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("person is used by %d splits", n)
+	}
+	return r.BaseRepository.DeleteByID(id)
+}
+
+// ShareRepository 只用于归档和改密，份额通过 SplitRepository 读写
+type ShareRepository struct {
+	*db.BaseRepository[Share]
+}
+
+func NewShareRepository(d *db.DB) *ShareRepository {
+	base := db.NewBaseRepository[Share](d, ShareTable, SQLCreateShare, SQLIndexShare)
+	return &ShareRepository{BaseRepository: base}
+}
+
+type SplitRepository struct {
+	*db.BaseRepository[Split]
+	shares *ShareRepository
+}
+
+func NewSplitRepository(d *db.DB) *SplitRepository {
+	base := db.NewBaseRepository[Split](d, SplitTable, SQLCreateSplit, "")
+	NewPersonRepository(d)
+	return &SplitRepository{BaseRepository: base, shares: NewShareRepository(d)}
+}
+
+// Details 返回 [start, end] 之间的分摊及份额，按日期倒序
+func (r *SplitRepository) Details(start, end int) ([]*SplitDetail, error) {
+	list, err := r.GetBetweenDates(start, end, "DESC")
+	if err != nil {
+		return nil, err
+	}
+	shares, err := r.shares.GetList("WHERE split IN (SELECT id FROM bill_split WHERE date >= ? AND date <= ?) ORDER BY id", start, end)
+	if err != nil {
+		return nil, err
+	}
+	bySplit := map[int][]*Share{}
+	for _, sh := range shares {
+		bySplit[sh.Split] = append(bySplit[sh.Split], sh)
+	}
+	out := make([]*SplitDetail, len(list))
+	for i, s := range list {
+		out[i] = &SplitDetail{Split: s, Shares: bySplit[s.ID]}
+		if out[i].Shares == nil {
+			out[i].Shares = []*Share{}
+		}
+	}
+	return out, nil
+}
+
+// Add 在同一事务中保存分摊和份额
+func (r *SplitRepository) Add(s *SplitDetail) (*SplitDetail, error) {
+	if s.Split == nil {
+		return nil, errors.New("split is required")
+	}
+	s.ID = 0
+	if err := r.save(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Update 修改分摊，份额整体替换
+func (r *SplitRepository) Update(s *SplitDetail) error {
+	if s.Split == nil {
+		return errors.New("split is required")
+	}
+	old, err := r.GetByID(s.ID)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return fmt.Errorf("split %d not found", s.ID)
+	}
+	return r.save(s)
+}
+
+func (r *SplitRepository) save(s *SplitDetail) error {
+	s.SetDefaults()
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if err := r.checkPeople(s); err != nil {
+		return err
+	}
+
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if s.ID == 0 {
+		id, err := db.InsertTx(tx, SplitTable, s.Split)
+		if err != nil {
+			return err
+		}
+		s.ID = id
+	} else {
+		cols, args := db.StructCols(s.Split, true), db.StructArgs(s.Split, true)
+		set := make([]string, 0, len(cols)-1)
+		for _, c := range cols[:len(cols)-1] {
+			set = append(set, c+"=?")
+		}
+		q := fmt.Sprintf("UPDATE %s SET %s WHERE id=?", SplitTable, strings.Join(set, ", "))
+		if _, err := tx.Exec(q, db.EncryptArgs(args)...); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM bill_share WHERE split = ?", s.ID); err != nil {
+			return err
+		}
+	}
+	for _, sh := range s.Shares {
+		sh.ID, sh.Split = 0, s.ID
+		id, err := db.InsertTx(tx, ShareTable, sh)
+		if err != nil {
+			return err
+		}
+		sh.ID = id
+	}
+	return tx.Commit()
+}
+
+// checkPeople 付款人和参与人必须是自己或已添加的人
+func (r *SplitRepository) checkPeople(s *SplitDetail) error {
+	ids := []int{s.Payer}
+	for _, sh := range s.Shares {
+		ids = append(ids, sh.Person)
+	}
+	for _, id := range ids {
+		if id == Me {
+			continue
+		}
+		var n int
+		if err := r.DB.Conn.QueryRow("SELECT COUNT(*) FROM bill_person WHERE id = ?", id).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("person %d not found", id)
+		}
+	}
+	return nil
+}
+
+// DeleteByID 同时删除份额
+func (r *SplitRepository) DeleteByID(id int) error {
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM bill_share WHERE split = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM bill_split WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Settle 记录 source 还给 target 的一笔钱
+func (r *SplitRepository) Settle(date, source, target int, amount money.Amount, currency string) (*SplitDetail, error) {
+	return r.Add(&SplitDetail{
+		Split:  &Split{Date: date, Item: "Settle up", Payer: source, Amount: amount, Currency: currency, Settle: 1},
+		Shares: []*Share{{Person: target, Amount: amount}},
+	})
+}
+
+// Balances 汇总所有分摊和还款，按分摊日期的汇率换算后计算每人的净额和两两之间的欠款
+func (r *SplitRepository) Balances(conv *Converter) (*SettleReport, error) {
+	people, err := NewPersonRepository(r.DB).List()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Select(`
+		SELECT p.payer, s.person, p.settle, p.currency, p.date, SUM(s.amount)
+		FROM bill_share s JOIN bill_split p ON p.id = s.split
+		GROUP BY p.payer, s.person, p.settle, p.currency, p.date`,
+		nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := map[int]*PersonBalance{Me: {Person: Me, Name: "Me"}}
+	for _, p := range people {
+		balances[p.ID] = &PersonBalance{Person: p.ID, Name: p.Name}
+	}
+	balance := func(id int) *PersonBalance {
+		if balances[id] == nil {
+			balances[id] = &PersonBalance{Person: id}
+		}
+		return balances[id]
+	}
+	type pair struct{ from, to int }
+	owed := map[pair]money.Amount{}
+	for _, row := range rows {
+		payer, person := rowInt(row[0]), rowInt(row[1])
+		amount := conv.Convert(rowAmount(row[5]), rowString(row[3]), rowInt(row[4]))
+		if rowInt(row[2]) == 0 {
+			balance(payer).Paid += amount
+			balance(person).Share += amount
+		}
+		if payer != person {
+			owed[pair{person, payer}] += amount
+			balance(payer).Net += amount
+			balance(person).Net -= amount
+		}
+	}
+
+	rep := &SettleReport{Currency: conv.Base, Missing: conv.Missing(), Balances: []*PersonBalance{}, Debts: []*Debt{}}
+	for _, b := range balances {
+		rep.Balances = append(rep.Balances, b)
+	}
+	sort.Slice(rep.Balances, func(i, j int) bool { return rep.Balances[i].Person < rep.Balances[j].Person })
+
+	done := map[pair]bool{}
+	for p := range owed {
+		a, b := min(p.from, p.to), max(p.from, p.to)
+		if done[pair{a, b}] {
+			continue
+		}
+		done[pair{a, b}] = true
+		net := owed[pair{a, b}] - owed[pair{b, a}]
+		switch {
+		case net > 0:
+			rep.Debts = append(rep.Debts, &Debt{From: a, To: b, Amount: net})
+		case net < 0:
+			rep.Debts = append(rep.Debts, &Debt{From: b, To: a, Amount: -net})
+		}
+	}
+	for _, d := range rep.Debts {
+		d.FromName, d.ToName = balance(d.From).Name, balance(d.To).Name
+	}
+	sort.Slice(rep.Debts, func(i, j int) bool {
+		if rep.Debts[i].Amount != rep.Debts[j].Amount {
+			return rep.Debts[i].Amount > rep.Debts[j].Amount
+		}
+		if rep.Debts[i].From != rep.Debts[j].From {
+			return rep.Debts[i].From < rep.Debts[j].From
+		}
+		return rep.Debts[i].To < rep.Debts[j].To
+	})
+	return rep, nil
+}
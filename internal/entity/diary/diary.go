@@ -1,6 +1,8 @@
 package diary
 
 import (
+	"fmt"
+
 	"diarygo/internal/db"
 	"diarygo/internal/utils"
 )
@@ -16,6 +18,18 @@ func (d *Diary) IsEmpty() bool {
 	return d.Content == "" && d.Weather == "" && d.Location == ""
 }
 
+// KeyedByID 日记以日期为 id
+func (d *Diary) KeyedByID() bool {
+	return true
+}
+
+func (d *Diary) Validate() error {
+	if !utils.IsValidDateInt(d.ID) {
+		return fmt.Errorf("invalid date %d", d.ID)
+	}
+	return nil
+}
+
 const TABLE = "diary"
 const SQLCreate = `
 	CREATE TABLE IF NOT EXISTS diary (
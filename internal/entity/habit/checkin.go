@@ -0,0 +1,121 @@
+package habit
+
+import (
+	"fmt"
+
+	"diarygo/internal/db"
+	"diarygo/internal/utils"
+)
+
+// Checkin 某天完成了一次习惯，每个习惯每天最多一条
+type Checkin struct {
+	ID    int    `json:"id"`
+	Habit int    `json:"habit"`
+	Date  int    `json:"date"`
+	Notes string `json:"notes"`
+}
+
+func (c *Checkin) SetDefaults() {
+	if c.Date == 0 {
+		c.Date = utils.GetCurrentDateInt()
+	}
+}
+
+func (c *Checkin) Validate() error {
+	if c.Habit <= 0 {
+		return fmt.Errorf("habit is required")
+	}
+	if !utils.IsValidDateInt(c.Date) {
+		return fmt.Errorf("invalid date %d", c.Date)
+	}
+	return nil
+}
+
+const CheckinTable = "habit_checkin"
+const SQLCreateCheckin = `
+	CREATE TABLE IF NOT EXISTS habit_checkin (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		habit INTEGER NOT NULL DEFAULT 0,
+		date INTEGER NOT NULL DEFAULT 0,
+		notes TEXT NOT NULL DEFAULT ""
+	);`
+const SQLIndexCheckin = `CREATE UNIQUE INDEX IF NOT EXISTS idx_habit_checkin ON habit_checkin (habit, date);`
+
+type CheckinRepository struct {
+	*db.BaseRepository[Checkin]
+}
+
+func NewCheckinRepository(d *db.DB) *CheckinRepository {
+	base := db.NewBaseRepository[Checkin](d, CheckinTable, SQLCreateCheckin, SQLIndexCheckin)
+	r := &CheckinRepository{BaseRepository: base}
+	base.Save = r.Update
+	return r
+}
+
+// Between 返回 [start, end] 的打卡，habit 为 0 时包括所有习惯
+func (r *CheckinRepository) Between(habit, start, end int) ([]*Checkin, error) {
+	if habit > 0 {
+		return r.GetList("WHERE habit = ? AND date >= ? AND date <= ? ORDER BY date, id", habit, start, end)
+	}
+	return r.GetList("WHERE date >= ? AND date <= ? ORDER BY date, habit", start, end)
+}
+
+// check 习惯要存在，日期不能早于开始日期、不能晚于今天，同一天不能重复打卡
+func (r *CheckinRepository) check(c *Checkin) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	h, err := db.SelectByID[Habit](r.DB, TABLE, c.Habit)
+	if err != nil {
+		return err
+	}
+	if h == nil {
+		return fmt.Errorf("habit %d not found", c.Habit)
+	}
+	if c.Date < h.Start {
+		return fmt.Errorf("date %d is before habit start %d", c.Date, h.Start)
+	}
+	if c.Date > utils.GetCurrentDateInt() {
+		return fmt.Errorf("cannot check in on future date %d", c.Date)
+	}
+	if !h.Due(utils.Int2Date(c.Date)) {
+		return fmt.Errorf("habit %q is not scheduled on %d", h.Name, c.Date)
+	}
+	list, err := r.GetList("WHERE habit = ? AND date = ? AND id != ?", c.Habit, c.Date, c.ID)
+	if err != nil {
+		return err
+	}
+	if len(list) > 0 {
+		return fmt.Errorf("already checked in on %d", c.Date)
+	}
+	return nil
+}
+
+func (r *CheckinRepository) Add(c *Checkin) (*Checkin, error) {
+	c.SetDefaults()
+	if err := r.check(c); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(c)
+}
+
+func (r *CheckinRepository) Update(c *Checkin) error {
+	c.SetDefaults()
+	if err := r.check(c); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(c)
+}
+
+// Toggle 打卡或取消打卡，返回这一天是否已打卡
+func (r *CheckinRepository) Toggle(habit, date int) (bool, error) {
+	list, err := r.GetList("WHERE habit = ? AND date = ?", habit, date)
+	if err != nil {
+		return false, err
+	}
+	if len(list) > 0 {
+		return false, r.DeleteWhere("habit = ? AND date = ?", habit, date)
+	}
+	_, err = r.Add(&Checkin{Habit: habit, Date: date})
+	return err == nil, err
+}
@@ -0,0 +1,153 @@
+package habit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"diarygo/internal/db"
+	"diarygo/internal/utils"
+)
+
+// 打卡周期
+const (
+	ScheduleDaily    = "daily"    // 每天
+	ScheduleWeekdays = "weekdays" // 每周固定的几天，见 Days
+	ScheduleWeekly   = "weekly"   // 每周任意 Target 天
+)
+
+// Habit 习惯或周期性的事务
+type Habit struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Days     string `json:"days"`   // weekdays 时的星期几，1 为周一、7 为周日，逗号分隔
+	Target   int    `json:"target"` // weekly 时每周需要打卡的天数
+	Start    int    `json:"start"`  // 从这天开始统计
+	Notes    string `json:"notes"`
+}
+
+func (h *Habit) SetDefaults() {
+	if h.Schedule == "" {
+		h.Schedule = ScheduleDaily
+	}
+	if h.Start == 0 {
+		h.Start = utils.GetCurrentDateInt()
+	}
+	if h.Schedule == ScheduleWeekly && h.Target == 0 {
+		h.Target = 1
+	}
+}
+
+func (h *Habit) Validate() error {
+	if strings.TrimSpace(h.Name) == "" {
+		return errors.New("habit name is required")
+	}
+	switch h.Schedule {
+	case ScheduleDaily:
+	case ScheduleWeekdays:
+		days, err := parseDays(h.Days)
+		if err != nil {
+			return err
+		}
+		if len(days) == 0 {
+			return errors.New("days are required for weekdays schedule")
+		}
+	case ScheduleWeekly:
+		if h.Target < 1 || h.Target > 7 {
+			return fmt.Errorf("invalid weekly target %d", h.Target)
+		}
+	default:
+		return fmt.Errorf("invalid schedule %q", h.Schedule)
+	}
+	if !utils.IsValidDateInt(h.Start) {
+		return fmt.Errorf("invalid start date %d", h.Start)
+	}
+	return nil
+}
+
+// parseDays 解析 "1,3,5" 形式的星期几
+func parseDays(s string) (map[time.Weekday]bool, error) {
+	days := map[time.Weekday]bool{}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 1 || n > 7 {
+			return nil, fmt.Errorf("invalid weekday %q", f)
+		}
+		days[time.Weekday(n%7)] = true
+	}
+	return days, nil
+}
+
+// Due 这一天是否需要打卡，weekly 每天都可以打卡
+func (h *Habit) Due(t time.Time) bool {
+	if h.Schedule != ScheduleWeekdays {
+		return true
+	}
+	days, _ := parseDays(h.Days)
+	return days[t.Weekday()]
+}
+
+const TABLE = "habit"
+const SQLCreate = `
+	CREATE TABLE IF NOT EXISTS habit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL DEFAULT "",
+		schedule CHAR(20) NOT NULL DEFAULT "",
+		days CHAR(20) NOT NULL DEFAULT "",
+		target INTEGER NOT NULL DEFAULT 0,
+		start INTEGER NOT NULL DEFAULT 0,
+		notes TEXT NOT NULL DEFAULT ""
+	);`
+
+type Repository struct {
+	*db.BaseRepository[Habit]
+}
+
+func NewRepository(d *db.DB) *Repository {
+	base := db.NewBaseRepository[Habit](d, TABLE, SQLCreate, "")
+	NewCheckinRepository(d)
+	return &Repository{BaseRepository: base}
+}
+
+func (r *Repository) Add(h *Habit) (*Habit, error) {
+	h.SetDefaults()
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(h)
+}
+
+func (r *Repository) Update(h *Habit) error {
+	h.SetDefaults()
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(h)
+}
+
+// DeleteByID 删除习惯和其打卡记录
+func (r *Repository) DeleteByID(id int) error {
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM habit_checkin WHERE habit = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM habit WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) List() ([]*Habit, error) {
+	return r.GetList("ORDER BY id")
+}
@@ -0,0 +1,164 @@
+package habit
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"diarygo/internal/utils"
+)
+
+// HabitStats 一个习惯的连续天数和完成率，weekly 习惯按周计算
+type HabitStats struct {
+	Habit     *Habit  `json:"habit"`
+	Unit      string  `json:"unit"` // day 或 week
+	Current   int     `json:"current"`
+	Longest   int     `json:"longest"`
+	Checkins  int     `json:"checkins"`  // 统计范围内的打卡次数
+	Scheduled int     `json:"scheduled"` // 统计范围内需要完成的天数或周数
+	Completed int     `json:"completed"`
+	Rate      float64 `json:"rate"` // 完成率，百分比
+	Today     bool    `json:"today"`
+}
+
+// period 需要完成的一天或一周
+type period struct {
+	start int
+	met   bool
+	open  bool // 还没结束：今天或本周
+}
+
+// periods 习惯在 [from, to] 中需要完成的周期，checked 为打卡日期
+func (h *Habit) periods(from, to time.Time, today int, checked map[int]bool) []period {
+	var list []period
+	if h.Schedule == ScheduleWeekly {
+		for d := utils.Monday(from); !d.After(to); d = d.AddDate(0, 0, 7) {
+			n := 0
+			for i := 0; i < 7; i++ {
+				if checked[utils.Date2Int(d.AddDate(0, 0, i))] {
+					n++
+				}
+			}
+			start := utils.Date2Int(d)
+			list = append(list, period{start: start, met: n >= h.Target, open: utils.Date2Int(d.AddDate(0, 0, 6)) >= today})
+		}
+		return list
+	}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if !h.Due(d) {
+			continue
+		}
+		date := utils.Date2Int(d)
+		list = append(list, period{start: date, met: checked[date], open: date == today})
+	}
+	return list
+}
+
+// Stats 统计每个习惯在 [start, end] 的完成率，连续天数从习惯开始算到今天
+func Stats(habits []*Habit, checkins []*Checkin, start, end, today int) ([]*HabitStats, error) {
+	if !utils.IsValidDateInt(start) || !utils.IsValidDateInt(end) || start > end {
+		return nil, fmt.Errorf("invalid date range %d-%d", start, end)
+	}
+	checked := map[int]map[int]bool{}
+	for _, c := range checkins {
+		if checked[c.Habit] == nil {
+			checked[c.Habit] = map[int]bool{}
+		}
+		checked[c.Habit][c.Date] = true
+	}
+	out := make([]*HabitStats, 0, len(habits))
+	for _, h := range habits {
+		days := checked[h.ID]
+		st := &HabitStats{Habit: h, Unit: "day", Today: days[today]}
+		if h.Schedule == ScheduleWeekly {
+			st.Unit = "week"
+		}
+		for d := range days {
+			if d >= start && d <= end {
+				st.Checkins++
+			}
+		}
+		if h.Start <= today {
+			all := h.periods(utils.Int2Date(h.Start), utils.Int2Date(today), today, days)
+			st.Current, st.Longest = streak(all)
+		}
+
+		from, to := max(start, h.Start), min(end, today)
+		if from <= to {
+			for _, p := range h.periods(utils.Int2Date(from), utils.Int2Date(to), today, days) {
+				// 还没结束的周期完成了才计入
+				if p.open && !p.met {
+					continue
+				}
+				st.Scheduled++
+				if p.met {
+					st.Completed++
+				}
+			}
+		}
+		if st.Scheduled > 0 {
+			st.Rate = math.Round(float64(st.Completed)/float64(st.Scheduled)*10000) / 100
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// streak 当前和最长的连续完成周期数，还没结束的周期未完成时不中断
+func streak(list []period) (current, longest int) {
+	run := 0
+	for i, p := range list {
+		if p.met {
+			run++
+			longest = max(longest, run)
+		} else if !(p.open && i == len(list)-1) {
+			run = 0
+		}
+	}
+	return run, longest
+}
+
+// Day 日历热力图中的一天，Level 为 0-4 的颜色深浅
+type Day struct {
+	Date  int `json:"date"`
+	Count int `json:"count"` // 打卡的习惯数
+	Due   int `json:"due"`   // 这天需要打卡的习惯数
+	Level int `json:"level"`
+}
+
+// Heatmap 返回 [start, end] 每天的打卡情况，habits 为需要统计的习惯
+func Heatmap(habits []*Habit, checkins []*Checkin, start, end int) ([]*Day, error) {
+	if !utils.IsValidDateInt(start) || !utils.IsValidDateInt(end) || start > end {
+		return nil, fmt.Errorf("invalid date range %d-%d", start, end)
+	}
+	ids := map[int]bool{}
+	for _, h := range habits {
+		ids[h.ID] = true
+	}
+	counts := map[int]int{}
+	for _, c := range checkins {
+		if ids[c.Habit] {
+			counts[c.Date]++
+		}
+	}
+	var out []*Day
+	for d, to := utils.Int2Date(start), utils.Int2Date(end); !d.After(to); d = d.AddDate(0, 0, 1) {
+		day := &Day{Date: utils.Date2Int(d), Count: counts[utils.Date2Int(d)]}
+		for _, h := range habits {
+			// weekly 习惯每天都可以打卡，不计入需要打卡的数量
+			if day.Date >= h.Start && h.Schedule != ScheduleWeekly && h.Due(d) {
+				day.Due++
+			}
+		}
+		day.Level = level(day.Count, max(day.Due, day.Count))
+		out = append(out, day)
+	}
+	return out, nil
+}
+
+func level(count, total int) int {
+	if count == 0 || total == 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(count) / float64(total) * 4))
+}
@@ -1,6 +1,8 @@
 package interest
 
 import (
+	"fmt"
+
 	"diarygo/internal/db"
 	"diarygo/internal/utils"
 )
@@ -25,6 +27,31 @@ func (i *Interest) IsEmpty() bool {
 	return i.Name == "" && i.Remark == ""
 }
 
+func (i *Interest) SetDefaults() {
+	if i.Sort == 0 {
+		i.Sort = 7
+	}
+	if i.Added == 0 {
+		i.Added = utils.GetCurrentDateInt()
+	}
+	if i.Date == 0 {
+		i.Date = utils.GetCurrentYYYYMM()
+	}
+	if i.Score_DB == 0 {
+		i.Score_DB = -1
+	}
+	if i.Score_IMDB == 0 {
+		i.Score_IMDB = -1
+	}
+	if i.Score == 0 {
+		i.Score = -1
+	}
+}
+
+func (i *Interest) NaturalKey() string {
+	return fmt.Sprintf("%d|%s", i.Sort, i.Name)
+}
+
 // -------------------- Repository --------------------
 
 const TABLE = "interest"
@@ -63,23 +90,6 @@ func (r *Repository) GetBySort(sort int) ([]*Interest, error) {
 }
 
 func (r *Repository) Add(i *Interest) (*Interest, error) {
-	if i.Sort == 0 {
-		i.Sort = 7
-	}
-	if i.Added == 0 {
-		i.Added = utils.GetCurrentDateInt()
-	}
-	if i.Date == 0 {
-		i.Date = utils.GetCurrentYYYYMM()
-	}
-	if i.Score_DB == 0 {
-		i.Score_DB = -1
-	}
-	if i.Score_IMDB == 0 {
-		i.Score_IMDB = -1
-	}
-	if i.Score == 0 {
-		i.Score = -1
-	}
+	i.SetDefaults()
 	return r.BaseRepository.Add(i)
 }
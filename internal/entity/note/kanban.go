@@ -0,0 +1,263 @@
+package note
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"diarygo/internal/db"
+)
+
+// Column 看板的一列，WIP 为列中未归档任务的上限，0 表示不限
+type Column struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Sort int    `json:"sort"`
+	WIP  int    `json:"wip"`
+}
+
+func (c *Column) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("column name is required")
+	}
+	if c.WIP < 0 {
+		return fmt.Errorf("invalid wip limit %d", c.WIP)
+	}
+	return nil
+}
+
+const ColumnTable = "note_column"
+const SQLCreateColumn = `
+	CREATE TABLE IF NOT EXISTS note_column (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL DEFAULT "",
+		sort INTEGER NOT NULL DEFAULT 0,
+		wip INTEGER NOT NULL DEFAULT 0
+	);`
+
+type ColumnRepository struct {
+	*db.BaseRepository[Column]
+}
+
+func NewColumnRepository(d *db.DB) *ColumnRepository {
+	base := db.NewBaseRepository[Column](d, ColumnTable, SQLCreateColumn, "")
+	return &ColumnRepository{BaseRepository: base}
+}
+
+func (r *ColumnRepository) List() ([]*Column, error) {
+	return r.GetList("ORDER BY sort, id")
+}
+
+// Add 新建列，没有指定顺序时放在最右边
+func (r *ColumnRepository) Add(c *Column) (*Column, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.Sort == 0 {
+		list, err := r.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range list {
+			c.Sort = max(c.Sort, o.Sort)
+		}
+		c.Sort++
+	}
+	return r.BaseRepository.Add(c)
+}
+
+// Update 修改列，调低 WIP 不影响列中已有的任务
+func (r *ColumnRepository) Update(c *Column) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(c)
+}
+
+// DeleteByID 删除列，其中的任务移到未分列的最后
+func (r *ColumnRepository) DeleteByID(id int) error {
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`UPDATE note SET column = 0,
+		ordinal = ordinal + (SELECT COALESCE(MAX(ordinal) + 1, 0) FROM note WHERE column = 0)
+		WHERE column = ?`, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM note_column WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// querier 可以是 *sql.DB 或 *sql.Tx
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// cards 列中未归档任务的 ID，按位置排序，except 不包括在内
+func cards(q querier, column, except int) ([]int, error) {
+	args := append([]any{column, except}, db.EncryptArgs([]any{StatusArchived})...)
+	rows, err := q.Query(`SELECT id FROM note WHERE column = ? AND id != ? AND status != ?
+		ORDER BY ordinal, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// findColumn 任务所在的列，column 为 0（未分列）时返回 nil
+func findColumn(d *db.DB, column int) (*Column, error) {
+	if column == 0 {
+		return nil, nil
+	}
+	c, err := db.SelectByID[Column](d, ColumnTable, column)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, fmt.Errorf("column %d not found", column)
+	}
+	return c, nil
+}
+
+// admit 列中已有 count 个任务时能否再放入一个
+func (c *Column) admit(count int) error {
+	if c != nil && c.WIP > 0 && count >= c.WIP {
+		return fmt.Errorf("column %q is at its WIP limit of %d", c.Name, c.WIP)
+	}
+	return nil
+}
+
+// place 任务放到所在列的最后，已归档的任务不占 WIP
+func (r *Repository) place(n *Note) error {
+	c, err := findColumn(r.DB, n.Column)
+	if err != nil {
+		return err
+	}
+	ids, err := cards(r.DB.Conn, n.Column, n.ID)
+	if err != nil {
+		return err
+	}
+	if n.Status != StatusArchived {
+		if err := c.admit(len(ids)); err != nil {
+			return err
+		}
+	}
+	n.Ordinal = len(ids)
+	return nil
+}
+
+// Move 把任务移到 column 的 ordinal 位置，在一个事务中重排原来的列和新列
+// 已归档的任务不在看板上，不能移动
+func (r *Repository) Move(id, column, ordinal int) (*Note, error) {
+	n, err := r.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, fmt.Errorf("note %d not found", id)
+	}
+	if n.Status == StatusArchived {
+		return nil, fmt.Errorf("note %d is archived", id)
+	}
+	c, err := findColumn(r.DB, column)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids, err := cards(tx, column, id)
+	if err != nil {
+		return nil, err
+	}
+	if column != n.Column {
+		if err := c.admit(len(ids)); err != nil {
+			return nil, err
+		}
+	}
+	ordinal = min(max(ordinal, 0), len(ids))
+	ids = append(ids[:ordinal], append([]int{id}, ids[ordinal:]...)...)
+	if err := renumber(tx, column, ids); err != nil {
+		return nil, err
+	}
+	if column != n.Column {
+		rest, err := cards(tx, n.Column, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := renumber(tx, n.Column, rest); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	n.Column, n.Ordinal = column, ordinal
+	return n, nil
+}
+
+// renumber 按顺序重写列中任务的位置
+func renumber(tx *sql.Tx, column int, ids []int) error {
+	for i, id := range ids {
+		if _, err := tx.Exec("UPDATE note SET column = ?, ordinal = ? WHERE id = ?", column, i, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BoardColumn 看板中的一列和其中未归档的任务，ID 为 0 的列是未分列的任务
+type BoardColumn struct {
+	Column
+	Notes     []*Note `json:"notes"`
+	Count     int     `json:"count"`
+	OverLimit bool    `json:"over_limit"`
+}
+
+// Board 按列分组的看板，列已删除的任务归入未分列
+func (r *Repository) Board(columns []*Column) ([]*BoardColumn, error) {
+	list, err := r.GetList("ORDER BY ordinal, id")
+	if err != nil {
+		return nil, err
+	}
+	board := []*BoardColumn{{Notes: []*Note{}}}
+	index := map[int]*BoardColumn{0: board[0]}
+	for _, c := range columns {
+		bc := &BoardColumn{Column: *c, Notes: []*Note{}}
+		board = append(board, bc)
+		index[c.ID] = bc
+	}
+	for _, n := range list {
+		if n.Status == StatusArchived {
+			continue
+		}
+		bc := index[n.Column]
+		if bc == nil {
+			bc = board[0]
+		}
+		bc.Notes = append(bc.Notes, n)
+	}
+	for _, bc := range board {
+		bc.Count = len(bc.Notes)
+		bc.OverLimit = bc.WIP > 0 && bc.Count > bc.WIP
+	}
+	return board, nil
+}
@@ -1,18 +1,87 @@
 package note
 
 import (
+	"database/sql"
+	"fmt"
+	"time"
+
 	"diarygo/internal/db"
 	"diarygo/internal/utils"
 )
 
+// 任务状态
+const (
+	StatusTodo     = "todo"
+	StatusDoing    = "doing"
+	StatusDone     = "done"
+	StatusArchived = "archived"
+)
+
+func ValidStatus(s string) bool {
+	switch s {
+	case StatusTodo, StatusDoing, StatusDone, StatusArchived:
+		return true
+	}
+	return false
+}
+
+// Note 一条任务，有子任务时 Process 由子任务的完成比例得出
 type Note struct {
-	ID       int    `json:"id"`
-	Begin    int    `json:"begin"`
-	Last     int    `json:"last"`
-	Process  int    `json:"process"`
-	Desire   int    `json:"desire"`
-	Priority int    `json:"priority"`
-	Content  string `json:"content"`
+	ID        int    `json:"id"`
+	Begin     int    `json:"begin"`
+	Last      int    `json:"last"`
+	Process   int    `json:"process"`
+	Desire    int    `json:"desire"`
+	Priority  int    `json:"priority"`
+	Content   string `json:"content"`
+	Due       int    `json:"due"` // 截止日期，0 表示没有
+	Status    string `json:"status"`
+	Completed int    `json:"completed"` // 完成时间（unix 秒），未完成为 0
+	Column    int    `json:"column"`    // 看板的列，0 表示未分列
+	Ordinal   int    `json:"ordinal"`   // 在列中的位置，从 0 开始
+}
+
+func (n *Note) SetDefaults() {
+	if n.Begin == 0 {
+		n.Begin = utils.GetCurrentDateInt()
+	}
+	if n.Last == 0 {
+		n.Last = utils.GetCurrentDateInt()
+	}
+	// 没有状态时与旧记录一样按进度得出
+	legacyStatus([]*Note{n})
+}
+
+func (n *Note) Validate() error {
+	if !ValidStatus(n.Status) {
+		return fmt.Errorf("invalid status %q", n.Status)
+	}
+	if n.Due != 0 && !utils.IsValidDateInt(n.Due) {
+		return fmt.Errorf("invalid due date %d", n.Due)
+	}
+	if n.Process < 0 || n.Process > 100 {
+		return fmt.Errorf("invalid process %d", n.Process)
+	}
+	return nil
+}
+
+// Open 未完成也未归档
+func (n *Note) Open() bool {
+	return n.Status != StatusDone && n.Status != StatusArchived
+}
+
+// complete 进入完成状态时记下完成时间，重新打开时清除；归档保留原来的完成时间
+func (n *Note) complete(now time.Time) {
+	switch {
+	case n.Status == StatusDone && n.Completed == 0:
+		n.Completed = int(now.Unix())
+	case n.Status == StatusTodo || n.Status == StatusDoing:
+		n.Completed = 0
+	}
+}
+
+func (n *Note) NaturalKey() string {
+	return fmt.Sprintf("%d|%s", n.Begin, n.Content)
 }
 
 const TABLE = "note"
@@ -24,28 +93,200 @@ const SQLCreate = `
 		process INTEGER NOT NULL DEFAULT 0,
 		desire INTEGER NOT NULL DEFAULT 0,
 		priority INTEGER NOT NULL DEFAULT 0,
-		content TEXT NOT NULL DEFAULT ""
+		content TEXT NOT NULL DEFAULT "",
+		due INTEGER NOT NULL DEFAULT 0,
+		status CHAR(20) NOT NULL DEFAULT "",
+		completed INTEGER NOT NULL DEFAULT 0,
+		column INTEGER NOT NULL DEFAULT 0,
+		ordinal INTEGER NOT NULL DEFAULT 0
 	);`
 
+// taskColumns 旧库依次补上的列，顺序与结构体一致
+var taskColumns = []string{
+	`due INTEGER NOT NULL DEFAULT 0`,
+	`status CHAR(20) NOT NULL DEFAULT ""`,
+	`completed INTEGER NOT NULL DEFAULT 0`,
+}
+
+var kanbanColumns = []string{
+	`column INTEGER NOT NULL DEFAULT 0`,
+	`ordinal INTEGER NOT NULL DEFAULT 0`,
+}
+
+// 补上任务和看板相关的列，已完成（进度 100）的旧记录标记为 done
+// 迁移时还没有密码，状态以明文写入，读取时原样返回，下次保存时加密
+func init() {
+	db.RegisterMigration("note_task", func(tx *sql.Tx) error {
+		return db.AddColumns(tx, TABLE, taskColumns...)
+	})
+	db.RegisterMigration("note_kanban", func(tx *sql.Tx) error {
+		return db.AddColumns(tx, TABLE, kanbanColumns...)
+	})
+	db.RegisterMigration("note_status", func(tx *sql.Tx) error {
+		ok, err := db.HasColumn(tx, TABLE, "status")
+		if err != nil || !ok {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE note SET status = CASE WHEN process >= 100 THEN ? ELSE ? END
+			WHERE status IN ('', ?)`, StatusDone, StatusTodo, db.EncryptPrefix)
+		return err
+	})
+}
+
 type Repository struct {
 	*db.BaseRepository[Note]
 }
 
 func NewRepository(d *db.DB) *Repository {
 	base := db.NewBaseRepository[Note](d, TABLE, SQLCreate, "")
-	return &Repository{BaseRepository: base}
+	NewSubtaskRepository(d)
+	NewColumnRepository(d)
+	r := &Repository{BaseRepository: base}
+	base.Save = r.Update
+	return r
+}
+
+// legacyStatus 迁移前的记录没有状态，按进度得出
+func legacyStatus(list []*Note) []*Note {
+	for _, n := range list {
+		if n.Status == "" {
+			n.Status = StatusTodo
+			if n.Process >= 100 {
+				n.Status = StatusDone
+			}
+		}
+	}
+	return list
+}
+
+func (r *Repository) GetByID(id int) (*Note, error) {
+	n, err := r.BaseRepository.GetByID(id)
+	if n != nil {
+		legacyStatus([]*Note{n})
+	}
+	return n, err
+}
+
+func (r *Repository) GetList(query string, args ...any) ([]*Note, error) {
+	list, err := r.BaseRepository.GetList(query, args...)
+	return legacyStatus(list), err
 }
 
 func (r *Repository) Add(n *Note) (*Note, error) {
-	if n.Begin == 0 {
-		n.Begin = utils.GetCurrentDateInt()
+	n.SetDefaults()
+	if err := n.Validate(); err != nil {
+		return nil, err
 	}
-	if n.Last == 0 {
-		n.Last = utils.GetCurrentDateInt()
+	n.complete(time.Now())
+	if n.Status == StatusDone {
+		n.Process = 100
+	}
+	if err := r.place(n); err != nil {
+		return nil, err
 	}
 	return r.BaseRepository.Add(n)
 }
 
+// Update 保存任务，有子任务时进度由子任务得出，标记完成且没有子任务时进度为 100
+// 列中的位置只能通过 Move 修改，换列或在同列中取消归档时放到列的最后，受 WIP 限制
+func (r *Repository) Update(n *Note) error {
+	n.SetDefaults()
+	if err := n.Validate(); err != nil {
+		return err
+	}
+	old, err := r.GetByID(n.ID)
+	if err != nil {
+		return err
+	}
+	unarchived := old != nil && old.Status == StatusArchived && n.Status != StatusArchived
+	if old != nil && old.Column == n.Column && !unarchived {
+		n.Ordinal = old.Ordinal
+	} else if err := r.place(n); err != nil {
+		return err
+	}
+	n.complete(time.Now())
+	process, ok, err := progress(r.DB, n.ID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case ok:
+		n.Process = process
+	case n.Status == StatusDone:
+		n.Process = 100
+	}
+	return r.BaseRepository.Update(n)
+}
+
+// DeleteByID 删除任务和其子任务、附件
+func (r *Repository) DeleteByID(id int) error {
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM note_subtask WHERE note = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM note WHERE id = ?", id); err != nil {
+		return err
+	}
+	after, err := db.CascadeTx(tx, TABLE, id)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, f := range after {
+		f()
+	}
+	return nil
+}
+
 func (r *Repository) List() ([]*Note, error) {
 	return r.GetList("ORDER BY last DESC")
 }
+
+// 按截止日期筛选的视图
+const (
+	ViewOverdue  = "overdue"  // 截止日期已过
+	ViewToday    = "today"    // 今天截止
+	ViewUpcoming = "upcoming" // 今天以后截止
+)
+
+// Filter 按视图和状态筛选，视图只包括未完成的任务，按截止日期和优先级排序
+// view 和 status 都为空时返回全部
+func (r *Repository) Filter(view, status string, today int) ([]*Note, error) {
+	if status != "" && !ValidStatus(status) {
+		return nil, fmt.Errorf("invalid status %q", status)
+	}
+	var list []*Note
+	var err error
+	switch view {
+	case "":
+		list, err = r.List()
+	case ViewOverdue:
+		list, err = r.GetList("WHERE due > 0 AND due < ? ORDER BY due, priority DESC", today)
+	case ViewToday:
+		list, err = r.GetList("WHERE due = ? ORDER BY priority DESC", today)
+	case ViewUpcoming:
+		list, err = r.GetList("WHERE due > ? ORDER BY due, priority DESC", today)
+	default:
+		return nil, fmt.Errorf("invalid view %q", view)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*Note, 0, len(list))
+	for _, n := range list {
+		if view != "" && !n.Open() {
+			continue
+		}
+		if status != "" && n.Status != status {
+			continue
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
@@ -0,0 +1,162 @@
+package note
+
+import (
+	"errors"
+	"fmt"
+
+	"diarygo/internal/db"
+)
+
+// Subtask 任务下的一条子任务，Done 为 1 表示已完成
+type Subtask struct {
+	ID      int    `json:"id"`
+	Note    int    `json:"note"`
+	Content string `json:"content"`
+	Done    int    `json:"done"`
+	Sort    int    `json:"sort"`
+}
+
+func (s *Subtask) Validate() error {
+	if s.Note <= 0 {
+		return errors.New("note is required")
+	}
+	if s.Content == "" {
+		return errors.New("content is required")
+	}
+	if s.Done != 0 && s.Done != 1 {
+		return fmt.Errorf("invalid done %d", s.Done)
+	}
+	return nil
+}
+
+const SubtaskTable = "note_subtask"
+const SQLCreateSubtask = `
+	CREATE TABLE IF NOT EXISTS note_subtask (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		note INTEGER NOT NULL DEFAULT 0,
+		content TEXT NOT NULL DEFAULT "",
+		done INTEGER NOT NULL DEFAULT 0,
+		sort INTEGER NOT NULL DEFAULT 0
+	);`
+const SQLIndexSubtask = `CREATE INDEX IF NOT EXISTS idx_note_subtask_note ON note_subtask(note);`
+
+type SubtaskRepository struct {
+	*db.BaseRepository[Subtask]
+}
+
+func NewSubtaskRepository(d *db.DB) *SubtaskRepository {
+	base := db.NewBaseRepository[Subtask](d, SubtaskTable, SQLCreateSubtask, SQLIndexSubtask)
+	r := &SubtaskRepository{BaseRepository: base}
+	base.Save = r.Update
+	return r
+}
+
+// ByNote 一个任务的子任务，按排序号
+func (r *SubtaskRepository) ByNote(note int) ([]*Subtask, error) {
+	return r.GetList("WHERE note = ? ORDER BY sort, id", note)
+}
+
+// progress 按子任务完成比例得出的进度，没有子任务时 ok 为 false
+func progress(d *db.DB, note int) (process int, ok bool, err error) {
+	var total, done int
+	row := d.Conn.QueryRow("SELECT COUNT(*), COALESCE(SUM(done), 0) FROM note_subtask WHERE note = ?", note)
+	if err := row.Scan(&total, &done); err != nil {
+		return 0, false, err
+	}
+	if total == 0 {
+		return 0, false, nil
+	}
+	return done * 100 / total, true, nil
+}
+
+// syncProcess 子任务变化后更新任务的进度，最后一个子任务删除后按状态重置为 100 或 0
+func (r *SubtaskRepository) syncProcess(note int) error {
+	process, ok, err := progress(r.DB, note)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		n, err := db.SelectByID[Note](r.DB, TABLE, note)
+		if err != nil || n == nil {
+			return err
+		}
+		process = 0
+		if legacyStatus([]*Note{n})[0].Status == StatusDone {
+			process = 100
+		}
+	}
+	_, err = r.DB.Conn.Exec("UPDATE note SET process = ? WHERE id = ?", process, note)
+	return err
+}
+
+func (r *SubtaskRepository) check(s *Subtask) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	n, err := db.SelectByID[Note](r.DB, TABLE, s.Note)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return fmt.Errorf("note %d not found", s.Note)
+	}
+	return nil
+}
+
+func (r *SubtaskRepository) Add(s *Subtask) (*Subtask, error) {
+	if err := r.check(s); err != nil {
+		return nil, err
+	}
+	if s.Sort == 0 {
+		list, err := r.ByNote(s.Note)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range list {
+			s.Sort = max(s.Sort, o.Sort)
+		}
+		s.Sort++
+	}
+	s, err := r.BaseRepository.Add(s)
+	if err != nil {
+		return nil, err
+	}
+	return s, r.syncProcess(s.Note)
+}
+
+func (r *SubtaskRepository) Update(s *Subtask) error {
+	old, err := r.GetByID(s.ID)
+	if err != nil {
+		return err
+	}
+	if old == nil {
+		return fmt.Errorf("subtask %d not found", s.ID)
+	}
+	if err := r.check(s); err != nil {
+		return err
+	}
+	if err := r.BaseRepository.Update(s); err != nil {
+		return err
+	}
+	// 子任务移到了别的任务下，两边的进度都要更新
+	if old.Note != s.Note {
+		if err := r.syncProcess(old.Note); err != nil {
+			return err
+		}
+	}
+	return r.syncProcess(s.Note)
+}
+
+func (r *SubtaskRepository) DeleteByID(id int) error {
+	s, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return nil
+	}
+	if err := r.BaseRepository.DeleteByID(id); err != nil {
+		return err
+	}
+	return r.syncProcess(s.Note)
+}
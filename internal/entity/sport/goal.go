@@ -0,0 +1,92 @@
+package sport
+
+import (
+	"errors"
+	"fmt"
+
+	"diarygo/internal/db"
+)
+
+// 目标的统计口径
+const (
+	MetricCount    = "count"    // 次数
+	MetricDuration = "duration" // 秒
+	MetricDistance = "distance" // 米
+	MetricCalories = "calories" // 千卡
+)
+
+// Goal 每周的运动目标，Activity 为空表示所有运动合计
+type Goal struct {
+	ID       int    `json:"id"`
+	Activity string `json:"activity"`
+	Metric   string `json:"metric"`
+	Target   int    `json:"target"`
+}
+
+func (g *Goal) SetDefaults() {
+	if g.Metric == "" {
+		g.Metric = MetricCount
+	}
+}
+
+func (g *Goal) Validate() error {
+	if g.Activity != "" && !ValidActivity(g.Activity) {
+		return fmt.Errorf("invalid activity %q", g.Activity)
+	}
+	switch g.Metric {
+	case MetricCount, MetricDuration, MetricDistance, MetricCalories:
+	default:
+		return fmt.Errorf("invalid metric %q", g.Metric)
+	}
+	if g.Target <= 0 {
+		return errors.New("target must be positive")
+	}
+	return nil
+}
+
+// value 一条记录计入该目标的数值
+func (g *Goal) value(s *Sport) int {
+	switch g.Metric {
+	case MetricDuration:
+		return s.Duration
+	case MetricDistance:
+		return s.Distance
+	case MetricCalories:
+		return s.Calories
+	}
+	return 1
+}
+
+const GoalTable = "sport_goal"
+const SQLCreateGoal = `
+	CREATE TABLE IF NOT EXISTS sport_goal (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		activity CHAR(20) NOT NULL DEFAULT "",
+		metric CHAR(20) NOT NULL DEFAULT "",
+		target INTEGER NOT NULL DEFAULT 0
+	);`
+
+type GoalRepository struct {
+	*db.BaseRepository[Goal]
+}
+
+func NewGoalRepository(d *db.DB) *GoalRepository {
+	base := db.NewBaseRepository[Goal](d, GoalTable, SQLCreateGoal, "")
+	return &GoalRepository{BaseRepository: base}
+}
+
+func (r *GoalRepository) Add(g *Goal) (*Goal, error) {
+	g.SetDefaults()
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(g)
+}
+
+func (r *GoalRepository) Update(g *Goal) error {
+	g.SetDefaults()
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(g)
+}
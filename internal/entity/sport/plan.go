@@ -0,0 +1,449 @@
+package sport
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"diarygo/internal/db"
+	"diarygo/internal/utils"
+)
+
+// Plan 训练计划，由模板生成或手动添加计划中的训练
+type Plan struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Template string `json:"template"` // 生成计划的模板，手动计划为空
+	Start    int    `json:"start"`    // 第一周的第一天
+	Notes    string `json:"notes"`
+}
+
+func (p *Plan) SetDefaults() {
+	if p.Start == 0 {
+		p.Start = utils.GetCurrentDateInt()
+	}
+	if t := FindTemplate(p.Template); t != nil && strings.TrimSpace(p.Name) == "" {
+		p.Name = t.Name
+	}
+}
+
+func (p *Plan) Validate() error {
+	if p.Template != "" && FindTemplate(p.Template) == nil {
+		return fmt.Errorf("unknown plan template %q", p.Template)
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("plan name is required")
+	}
+	if !utils.IsValidDateInt(p.Start) {
+		return fmt.Errorf("invalid start date %d", p.Start)
+	}
+	return nil
+}
+
+// Workout 计划中某天的一次训练，完成后关联实际的运动记录
+type Workout struct {
+	ID       int    `json:"id"`
+	Plan     int    `json:"plan"`
+	Date     int    `json:"date"`
+	Activity string `json:"activity"`
+	Duration int    `json:"duration"` // 秒
+	Distance int    `json:"distance"` // 米
+	Notes    string `json:"notes"`
+	Sport    int    `json:"sport"` // 完成时关联的运动记录，0 表示未完成
+}
+
+func (w *Workout) SetDefaults() {
+	if w.Activity == "" {
+		w.Activity = ActivityRun
+	}
+}
+
+func (w *Workout) Validate() error {
+	if w.Plan <= 0 {
+		return errors.New("plan is required")
+	}
+	if !utils.IsValidDateInt(w.Date) {
+		return fmt.Errorf("invalid date %d", w.Date)
+	}
+	if !ValidActivity(w.Activity) {
+		return fmt.Errorf("invalid activity %q", w.Activity)
+	}
+	if w.Duration < 0 || w.Distance < 0 {
+		return errors.New("duration and distance must not be negative")
+	}
+	return nil
+}
+
+// Template 计划模板，其中训练的 Date 为相对计划开始日期的天数
+type Template struct {
+	Key      string     `json:"key"`
+	Name     string     `json:"name"`
+	Weeks    int        `json:"weeks"`
+	Workouts []*Workout `json:"workouts"`
+}
+
+// Templates 内置的跑步计划：每周两次轻松跑或节奏跑、一次长距离，每 4 周减量一次，最后一周比赛
+var Templates = []*Template{
+	runTemplate("5k", "5K in 8 weeks", 8, 2000, 4000, 3000, 6000, 5000),
+	runTemplate("10k", "10K in 10 weeks", 10, 3000, 6000, 5000, 12000, 10000),
+	runTemplate("half", "Half marathon in 12 weeks", 12, 5000, 8000, 8000, 19000, 21097),
+}
+
+func FindTemplate(key string) *Template {
+	for _, t := range Templates {
+		if t.Key == key {
+			return t
+		}
+	}
+	return nil
+}
+
+// runTemplate 轻松跑和长距离从 start 线性增加到 peak
+func runTemplate(key, name string, weeks, easyStart, easyPeak, longStart, longPeak, race int) *Template {
+	t := &Template{Key: key, Name: name, Weeks: weeks}
+	round := func(m float64) int { return int(math.Round(m/500) * 500) }
+	for w := 0; w < weeks; w++ {
+		week := w * 7
+		if w == weeks-1 {
+			t.Workouts = append(t.Workouts,
+				&Workout{Date: week + 1, Activity: ActivityRun, Distance: round(float64(easyStart)), Notes: "easy"},
+				&Workout{Date: week + 3, Activity: ActivityRun, Distance: round(float64(easyStart) * 0.6), Notes: "easy with strides"},
+				&Workout{Date: week + 6, Activity: ActivityRun, Distance: race, Notes: "race"},
+			)
+			break
+		}
+		progress := float64(w) / float64(max(weeks-2, 1))
+		scale := 1.0
+		if w%4 == 3 {
+			scale = 0.8 // 减量周
+		}
+		easy := (float64(easyStart) + float64(easyPeak-easyStart)*progress) * scale
+		long := (float64(longStart) + float64(longPeak-longStart)*progress) * scale
+		t.Workouts = append(t.Workouts,
+			&Workout{Date: week + 1, Activity: ActivityRun, Distance: round(easy), Notes: "easy"},
+			&Workout{Date: week + 3, Activity: ActivityRun, Distance: round(easy), Notes: "tempo"},
+			&Workout{Date: week + 6, Activity: ActivityRun, Distance: round(long), Notes: "long run"},
+		)
+	}
+	return t
+}
+
+const PlanTable = "sport_plan"
+const SQLCreatePlan = `
+	CREATE TABLE IF NOT EXISTS sport_plan (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL DEFAULT "",
+		template CHAR(20) NOT NULL DEFAULT "",
+		start INTEGER NOT NULL DEFAULT 0,
+		notes TEXT NOT NULL DEFAULT ""
+	);`
+
+const WorkoutTable = "sport_plan_workout"
+const SQLCreateWorkout = `
+	CREATE TABLE IF NOT EXISTS sport_plan_workout (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		plan INTEGER NOT NULL DEFAULT 0,
+		date INTEGER NOT NULL DEFAULT 0,
+		activity CHAR(20) NOT NULL DEFAULT "",
+		duration INTEGER NOT NULL DEFAULT 0,
+		distance INTEGER NOT NULL DEFAULT 0,
+		notes TEXT NOT NULL DEFAULT "",
+		sport INTEGER NOT NULL DEFAULT 0
+	);`
+const SQLIndexWorkout = `CREATE INDEX IF NOT EXISTS idx_sport_plan_workout_plan ON sport_plan_workout (plan, date);`
+
+type PlanRepository struct {
+	*db.BaseRepository[Plan]
+}
+
+func NewPlanRepository(d *db.DB) *PlanRepository {
+	base := db.NewBaseRepository[Plan](d, PlanTable, SQLCreatePlan, "")
+	NewWorkoutRepository(d)
+	return &PlanRepository{BaseRepository: base}
+}
+
+// Add 新建计划，有模板时按开始日期生成计划中的训练
+func (r *PlanRepository) Add(p *Plan) (*Plan, error) {
+	p.SetDefaults()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if p.ID, err = db.InsertTx(tx, PlanTable, p); err != nil {
+		return nil, err
+	}
+	if t := FindTemplate(p.Template); t != nil {
+		start := utils.Int2Date(p.Start)
+		for _, tw := range t.Workouts {
+			w := *tw
+			w.Plan = p.ID
+			w.Date = utils.Date2Int(start.AddDate(0, 0, tw.Date))
+			if _, err := db.InsertTx(tx, WorkoutTable, &w); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p, tx.Commit()
+}
+
+// Update 只修改计划本身，已生成的训练不随开始日期移动
+func (r *PlanRepository) Update(p *Plan) error {
+	p.SetDefaults()
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(p)
+}
+
+// DeleteByID 删除计划和其中的训练，关联的运动记录保留
+func (r *PlanRepository) DeleteByID(id int) error {
+	tx, err := r.DB.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM sport_plan_workout WHERE plan = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sport_plan WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PlanRepository) List() ([]*Plan, error) {
+	return r.GetList("ORDER BY start DESC, id DESC")
+}
+
+type WorkoutRepository struct {
+	*db.BaseRepository[Workout]
+}
+
+func NewWorkoutRepository(d *db.DB) *WorkoutRepository {
+	base := db.NewBaseRepository[Workout](d, WorkoutTable, SQLCreateWorkout, SQLIndexWorkout)
+	return &WorkoutRepository{BaseRepository: base}
+}
+
+// Between 返回 [start, end] 的训练，plan 为 0 时包括所有计划
+func (r *WorkoutRepository) Between(plan, start, end int) ([]*Workout, error) {
+	if plan > 0 {
+		return r.GetList("WHERE plan = ? AND date >= ? AND date <= ? ORDER BY date, id", plan, start, end)
+	}
+	return r.GetList("WHERE date >= ? AND date <= ? ORDER BY date, id", start, end)
+}
+
+func (r *WorkoutRepository) check(w *Workout) error {
+	w.SetDefaults()
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	plan, err := NewPlanRepository(r.DB).GetByID(w.Plan)
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		return fmt.Errorf("plan %d not found", w.Plan)
+	}
+	return r.checkSport(w.ID, w.Sport)
+}
+
+// checkSport 关联的运动记录必须存在，且只能完成一次训练
+func (r *WorkoutRepository) checkSport(id, sportID int) error {
+	if sportID == 0 {
+		return nil
+	}
+	s, err := NewRepository(r.DB).GetByID(sportID)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return fmt.Errorf("sport %d not found", sportID)
+	}
+	used, err := r.GetList("WHERE sport = ? AND id != ?", sportID, id)
+	if err != nil {
+		return err
+	}
+	if len(used) > 0 {
+		return fmt.Errorf("sport %d already completes workout %d", sportID, used[0].ID)
+	}
+	return nil
+}
+
+func (r *WorkoutRepository) Add(w *Workout) (*Workout, error) {
+	if err := r.check(w); err != nil {
+		return nil, err
+	}
+	return r.BaseRepository.Add(w)
+}
+
+func (r *WorkoutRepository) Update(w *Workout) error {
+	if err := r.check(w); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(w)
+}
+
+// Complete 用运动记录完成训练，sportID 为 0 时取消完成
+func (r *WorkoutRepository) Complete(id, sportID int) (*Workout, error) {
+	w, err := r.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return nil, fmt.Errorf("workout %d not found", id)
+	}
+	if err := r.checkSport(id, sportID); err != nil {
+		return nil, err
+	}
+	w.Sport = sportID
+	return w, r.BaseRepository.Update(w)
+}
+
+// Match 把计划中未完成的训练与同一天、同一运动类型的记录关联，返回新关联的数量
+func (r *WorkoutRepository) Match(plan int) (int, error) {
+	workouts, err := r.Between(plan, 0, 99991231)
+	if err != nil {
+		return 0, err
+	}
+	sports, err := NewRepository(r.DB).GetList("ORDER BY date, id")
+	if err != nil {
+		return 0, err
+	}
+	all, err := r.List()
+	if err != nil {
+		return 0, err
+	}
+	used := map[int]bool{}
+	for _, w := range all {
+		used[w.Sport] = true
+	}
+	n := 0
+	for _, w := range workouts {
+		if w.Sport != 0 {
+			continue
+		}
+		for _, s := range sports {
+			if s.Date == w.Date && s.Activity == w.Activity && !used[s.ID] {
+				w.Sport, used[s.ID] = s.ID, true
+				if err := r.BaseRepository.Update(w); err != nil {
+					return n, err
+				}
+				n++
+				break
+			}
+		}
+	}
+	return n, nil
+}
+
+// 计划中训练的状态
+const (
+	WorkoutDone     = "done"
+	WorkoutMissed   = "missed"
+	WorkoutUpcoming = "upcoming" // 今天及以后还未完成的
+)
+
+// WorkoutStatus 训练和实际完成的记录
+type WorkoutStatus struct {
+	*Workout
+	Status string `json:"status"`
+	Actual *Sport `json:"actual"`
+}
+
+// Progress 完成情况，Percent 为已完成占应完成（今天以前或已完成）的百分比
+type Progress struct {
+	Planned  int     `json:"planned"`
+	Due      int     `json:"due"`
+	Done     int     `json:"done"`
+	Missed   int     `json:"missed"`
+	Percent  float64 `json:"percent"`
+	Distance int     `json:"distance"` // 应完成训练的计划距离
+	Actual   int     `json:"actual"`   // 已完成训练的实际距离
+}
+
+func (p *Progress) add(w *WorkoutStatus) {
+	p.Planned++
+	if w.Status == WorkoutUpcoming {
+		return
+	}
+	p.Due++
+	p.Distance += w.Distance
+	if w.Status == WorkoutDone {
+		p.Done++
+		p.Actual += w.Actual.Distance
+	} else {
+		p.Missed++
+	}
+	p.Percent = math.Round(float64(p.Done)/float64(p.Due)*10000) / 100
+}
+
+// WeekProgress 计划第 Week 周（从 1 开始）的完成情况
+type WeekProgress struct {
+	Week  int `json:"week"`
+	Start int `json:"start"`
+	Progress
+}
+
+// Compliance 计划的执行情况
+type Compliance struct {
+	Plan     *Plan            `json:"plan"`
+	Today    int              `json:"today"`
+	Progress                  // 整个计划
+	Weeks    []*WeekProgress  `json:"weeks"`
+	Workouts []*WorkoutStatus `json:"workouts"`
+}
+
+// Compliance 统计计划截至 today 的完成情况，关联的运动记录已删除时视为未完成
+func (r *WorkoutRepository) Compliance(plan, today int) (*Compliance, error) {
+	p, err := NewPlanRepository(r.DB).GetByID(plan)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("plan %d not found", plan)
+	}
+	workouts, err := r.Between(plan, 0, 99991231)
+	if err != nil {
+		return nil, err
+	}
+	sports := NewRepository(r.DB)
+
+	c := &Compliance{Plan: p, Today: today, Weeks: []*WeekProgress{}, Workouts: []*WorkoutStatus{}}
+	start := utils.Int2Date(p.Start)
+	weeks := map[int]*WeekProgress{}
+	for _, w := range workouts {
+		ws := &WorkoutStatus{Workout: w, Status: WorkoutUpcoming}
+		if w.Sport != 0 {
+			if ws.Actual, err = sports.GetByID(w.Sport); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case ws.Actual != nil:
+			ws.Status = WorkoutDone
+		case w.Date < today:
+			ws.Status = WorkoutMissed
+		}
+		c.Workouts = append(c.Workouts, ws)
+		c.Progress.add(ws)
+
+		// 开始日期之前手动添加的训练算作第 1 周
+		days := int(utils.Int2Date(w.Date).Sub(start).Hours()/24 + 0.5)
+		week := max(days/7, 0) + 1
+		wp := weeks[week]
+		if wp == nil {
+			wp = &WeekProgress{Week: week, Start: utils.Date2Int(start.AddDate(0, 0, (week-1)*7))}
+			weeks[week] = wp
+			c.Weeks = append(c.Weeks, wp)
+		}
+		wp.add(ws)
+	}
+	sort.Slice(c.Weeks, func(i, j int) bool { return c.Weeks[i].Week < c.Weeks[j].Week })
+	return c, nil
+}
@@ -1,14 +1,131 @@
 package sport
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
 	"diarygo/internal/db"
 	"diarygo/internal/utils"
 )
 
+// 运动类型
+const (
+	ActivityRun      = "run"
+	ActivityWalk     = "walk"
+	ActivityHike     = "hike"
+	ActivityCycle    = "cycle"
+	ActivitySwim     = "swim"
+	ActivityStrength = "strength"
+	ActivityYoga     = "yoga"
+	ActivityOther    = "other"
+)
+
+var Activities = []string{
+	ActivityRun, ActivityWalk, ActivityHike, ActivityCycle,
+	ActivitySwim, ActivityStrength, ActivityYoga, ActivityOther,
+}
+
+// Sport 一次运动记录，力量训练每个动作一条，记录组数、每组次数和重量
+// 旧版只有自由文本的 content，迁移后保存在 Notes 中
 type Sport struct {
-	ID      int    `json:"id"`
-	Date    int    `json:"date"`
-	Content string `json:"content"`
+	ID        int     `json:"id"`
+	Date      int     `json:"date"`
+	Notes     string  `json:"notes" alias:"content"`
+	Activity  string  `json:"activity"`
+	Duration  int     `json:"duration"`   // 秒
+	Distance  int     `json:"distance"`   // 米
+	Calories  int     `json:"calories"`   // 千卡
+	HeartRate int     `json:"heart_rate"` // 平均心率
+	MaxHeart  int     `json:"max_heart"`  // 最大心率
+	Exercise  string  `json:"exercise"`   // 力量训练的动作
+	Sets      int     `json:"sets"`
+	Reps      int     `json:"reps"`   // 每组次数
+	Weight    float64 `json:"weight"` // 公斤
+	Ascent    int     `json:"ascent"` // 累计爬升，米
+	Start     int     `json:"start"`  // 开始时间（unix 秒），从运动手表导入的记录才有
+}
+
+// Pace 平均配速，每公里秒数，没有距离时为 0
+func (s *Sport) Pace() int {
+	if s.Distance <= 0 || s.Duration <= 0 {
+		return 0
+	}
+	return int(float64(s.Duration)*1000/float64(s.Distance) + 0.5)
+}
+
+// UnmarshalJSON 兼容旧版归档和导出文件中的 content
+func (s *Sport) UnmarshalJSON(data []byte) error {
+	type plain Sport
+	aux := struct {
+		*plain
+		Content *string `json:"content"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Content != nil && s.Notes == "" {
+		s.Notes = *aux.Content
+	}
+	return nil
+}
+
+func (s *Sport) SetDefaults() {
+	if s.Date == 0 {
+		s.Date = utils.GetCurrentDateInt()
+	}
+	if s.Activity == "" {
+		s.Activity = ActivityOther
+	}
+}
+
+// NaturalKey 旧记录迁移后的运动数据均为 0，与重新导入的旧数据仍能匹配
+// 从运动手表导入的记录以开始时间识别
+func (s *Sport) NaturalKey() string {
+	if s.Start != 0 {
+		return fmt.Sprintf("start|%d", s.Start)
+	}
+	return fmt.Sprintf("%d|%s|%d|%d", s.Date, s.Notes, s.Duration, s.Distance)
+}
+
+func ValidActivity(a string) bool {
+	for _, v := range Activities {
+		if a == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Sport) Validate() error {
+	if !utils.IsValidDateInt(s.Date) {
+		return fmt.Errorf("invalid date %d", s.Date)
+	}
+	if !ValidActivity(s.Activity) {
+		return fmt.Errorf("invalid activity %q", s.Activity)
+	}
+	if s.Duration < 0 || s.Distance < 0 || s.Calories < 0 {
+		return errors.New("duration, distance and calories must not be negative")
+	}
+	if s.Duration > 7*24*3600 {
+		return fmt.Errorf("duration %d seconds is too long", s.Duration)
+	}
+	for _, hr := range []int{s.HeartRate, s.MaxHeart} {
+		if hr != 0 && (hr < 30 || hr > 250) {
+			return fmt.Errorf("invalid heart rate %d", hr)
+		}
+	}
+	if s.HeartRate > 0 && s.MaxHeart > 0 && s.MaxHeart < s.HeartRate {
+		return errors.New("max heart rate is lower than average")
+	}
+	if s.Sets < 0 || s.Reps < 0 || s.Weight < 0 || s.Ascent < 0 {
+		return errors.New("sets, reps, weight and ascent must not be negative")
+	}
+	if s.Activity == ActivityStrength && s.Exercise != "" && (s.Sets == 0 || s.Reps == 0) {
+		return fmt.Errorf("exercise %q needs sets and reps", s.Exercise)
+	}
+	return nil
 }
 
 const TABLE = "sport"
@@ -16,25 +133,114 @@ const SQLCreate = `
 	CREATE TABLE IF NOT EXISTS sport (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		date INTEGER NOT NULL DEFAULT 0,
-		content TEXT NOT NULL DEFAULT ""
+		notes TEXT NOT NULL DEFAULT "",
+		activity CHAR(20) NOT NULL DEFAULT "",
+		duration INTEGER NOT NULL DEFAULT 0,
+		distance INTEGER NOT NULL DEFAULT 0,
+		calories INTEGER NOT NULL DEFAULT 0,
+		heartrate INTEGER NOT NULL DEFAULT 0,
+		maxheart INTEGER NOT NULL DEFAULT 0,
+		exercise TEXT NOT NULL DEFAULT "",
+		sets INTEGER NOT NULL DEFAULT 0,
+		reps INTEGER NOT NULL DEFAULT 0,
+		weight REAL NOT NULL DEFAULT 0,
+		ascent INTEGER NOT NULL DEFAULT 0,
+		start INTEGER NOT NULL DEFAULT 0
 	);`
+const SQLIndex = `CREATE INDEX IF NOT EXISTS idx_sport_start ON sport (start);`
+
+// workoutColumns 旧库依次补上的列，顺序与结构体一致
+var workoutColumns = []string{
+	`activity CHAR(20) NOT NULL DEFAULT ""`,
+	`duration INTEGER NOT NULL DEFAULT 0`,
+	`distance INTEGER NOT NULL DEFAULT 0`,
+	`calories INTEGER NOT NULL DEFAULT 0`,
+	`heartrate INTEGER NOT NULL DEFAULT 0`,
+	`maxheart INTEGER NOT NULL DEFAULT 0`,
+	`exercise TEXT NOT NULL DEFAULT ""`,
+	`sets INTEGER NOT NULL DEFAULT 0`,
+	`reps INTEGER NOT NULL DEFAULT 0`,
+	`weight REAL NOT NULL DEFAULT 0`,
+}
+
+// trackColumns 导入运动手表记录时增加的列
+var trackColumns = []string{
+	`ascent INTEGER NOT NULL DEFAULT 0`,
+	`start INTEGER NOT NULL DEFAULT 0`,
+}
+
+// 旧库的 content 改名为 notes，并补上运动数据列
+func init() {
+	db.RenameColumn(TABLE, "content", "notes")
+	db.RegisterMigration("sport_workout", func(tx *sql.Tx) error {
+		hasContent, err := db.HasColumn(tx, TABLE, "content")
+		if err != nil {
+			return err
+		}
+		if hasContent {
+			if _, err := tx.Exec(`ALTER TABLE sport RENAME COLUMN content TO notes`); err != nil {
+				return err
+			}
+		}
+		return db.AddColumns(tx, TABLE, workoutColumns...)
+	})
+	db.RegisterMigration("sport_track", func(tx *sql.Tx) error {
+		if err := db.AddColumns(tx, TABLE, trackColumns...); err != nil {
+			return err
+		}
+		// 新库这时还没有建表，先建表再补索引
+		if _, err := tx.Exec(SQLCreate); err != nil {
+			return err
+		}
+		_, err := tx.Exec(SQLIndex)
+		return err
+	})
+	// 迁移时还没有密码，旧记录的运动类型以明文写入，读取时原样返回
+	db.RegisterMigration("sport_activity", func(tx *sql.Tx) error {
+		ok, err := db.HasColumn(tx, TABLE, "activity")
+		if err != nil || !ok {
+			return err
+		}
+		_, err = tx.Exec("UPDATE sport SET activity = ? WHERE activity IN ('', ?)", ActivityOther, db.EncryptPrefix)
+		return err
+	})
+}
 
 type Repository struct {
 	*db.BaseRepository[Sport]
 }
 
 func NewRepository(d *db.DB) *Repository {
-	base := db.NewBaseRepository[Sport](d, TABLE, SQLCreate, "")
+	// 旧库在迁移前没有 start 列，索引由迁移补建
+	base := db.NewBaseRepository[Sport](d, TABLE, SQLCreate, SQLIndex)
 	return &Repository{BaseRepository: base}
 }
 
 func (r *Repository) Add(n *Sport) (*Sport, error) {
-	if n.Date == 0 {
-		n.Date = utils.GetCurrentDateInt()
+	n.SetDefaults()
+	if err := n.Validate(); err != nil {
+		return nil, err
 	}
 	return r.BaseRepository.Add(n)
 }
 
+func (r *Repository) Update(n *Sport) error {
+	n.SetDefaults()
+	if err := n.Validate(); err != nil {
+		return err
+	}
+	return r.BaseRepository.Update(n)
+}
+
 func (r *Repository) List() ([]*Sport, error) {
 	return r.GetList("ORDER BY date DESC")
 }
+
+// FindStart 返回开始时间在 start 前后 window 秒内的记录，用于识别重复导入的运动
+func (r *Repository) FindStart(start, window int) (*Sport, error) {
+	list, err := r.GetList("WHERE start != 0 AND start >= ? AND start <= ? ORDER BY ABS(start - ?) LIMIT 1", start-window, start+window, start)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return list[0], nil
+}
@@ -0,0 +1,287 @@
+package sport
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"diarygo/internal/utils"
+)
+
+// Totals 次数和运动量合计
+type Totals struct {
+	Count    int `json:"count"`
+	Duration int `json:"duration"`
+	Distance int `json:"distance"`
+	Calories int `json:"calories"`
+	Ascent   int `json:"ascent"`
+}
+
+func (t *Totals) add(s *Sport) {
+	t.Count++
+	t.Duration += s.Duration
+	t.Distance += s.Distance
+	t.Calories += s.Calories
+	t.Ascent += s.Ascent
+}
+
+// ActivityTotal 按运动类型汇总
+type ActivityTotal struct {
+	Activity string `json:"activity"`
+	Totals
+}
+
+// PeriodTotal 按 ISO 周（YYYYWW）或月（YYYYMM）汇总，Start 为该周期第一天
+type PeriodTotal struct {
+	Period int `json:"period"`
+	Start  int `json:"start"`
+	Totals
+	ByActivity []*ActivityTotal `json:"by_activity"`
+}
+
+func (p *PeriodTotal) add(s *Sport) {
+	p.Totals.add(s)
+	p.ByActivity = addActivity(p.ByActivity, s)
+}
+
+// Streak 连续有运动的天数，今天还没运动时从昨天算起
+type Streak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+	Start   int `json:"start"` // 最长连续的起止日期
+	End     int `json:"end"`
+	Last    int `json:"last"` // 最近一次运动的日期
+}
+
+// Record 个人最好成绩，Value 的单位见 Unit
+type Record struct {
+	Name     string  `json:"name"`
+	Activity string  `json:"activity"`
+	Exercise string  `json:"exercise,omitempty"`
+	Value    float64 `json:"value"`
+	Unit     string  `json:"unit"`
+	Sport    int     `json:"sport"` // 创造记录的运动记录
+	Date     int     `json:"date"`
+}
+
+// GoalProgress 本周目标的完成情况
+type GoalProgress struct {
+	Goal
+	Actual  int     `json:"actual"`
+	Percent float64 `json:"percent"`
+	Done    bool    `json:"done"`
+}
+
+// Stats 运动统计，汇总只含 [Start, End]，连续天数和个人记录按全部记录计算
+type Stats struct {
+	Start      int              `json:"start"`
+	End        int              `json:"end"`
+	Totals     Totals           `json:"totals"`
+	ByActivity []*ActivityTotal `json:"by_activity"`
+	ByWeek     []*PeriodTotal   `json:"by_week"`
+	ByMonth    []*PeriodTotal   `json:"by_month"`
+	Streak     Streak           `json:"streak"`
+	Records    []*Record        `json:"records"`
+	Week       int              `json:"week"` // 目标所在的 ISO 周
+	Goals      []*GoalProgress  `json:"goals"`
+}
+
+// 估算成绩的跑步距离，米
+var raceDistances = []struct {
+	name     string
+	distance int
+}{
+	{"fastest 5k", 5000},
+	{"fastest 10k", 10000},
+	{"fastest half marathon", 21097},
+	{"fastest marathon", 42195},
+}
+
+// Stats 统计 [start, end] 的运动，today 用于计算连续天数和本周目标
+func (r *Repository) Stats(start, end, today int, goals []*Goal) (*Stats, error) {
+	if !utils.IsValidDateInt(start) || !utils.IsValidDateInt(end) || start > end {
+		return nil, fmt.Errorf("invalid date range %d-%d", start, end)
+	}
+	all, err := r.GetList("ORDER BY date, id")
+	if err != nil {
+		return nil, err
+	}
+
+	st := &Stats{Start: start, End: end, ByActivity: []*ActivityTotal{}, Records: records(all), Goals: []*GoalProgress{}}
+	from, to := utils.Int2Date(start), utils.Int2Date(end)
+	weeks := periods(from, to, utils.PeriodWeek)
+	months := periods(from, to, utils.PeriodMonth)
+	for _, s := range all {
+		if s.Date < start || s.Date > end {
+			continue
+		}
+		st.Totals.add(s)
+		st.ByActivity = addActivity(st.ByActivity, s)
+		d := utils.Int2Date(s.Date)
+		week, _ := utils.ISOWeek(d)
+		weeks[week].add(s)
+		months[d.Year()*100+int(d.Month())].add(s)
+	}
+	sort.Slice(st.ByActivity, func(i, j int) bool {
+		a, b := st.ByActivity[i], st.ByActivity[j]
+		if a.Duration != b.Duration {
+			return a.Duration > b.Duration
+		}
+		return a.Activity < b.Activity
+	})
+	st.ByWeek, st.ByMonth = sortedPeriods(weeks), sortedPeriods(months)
+	st.Streak = streak(all, today)
+
+	// 本周目标
+	week, monday := utils.ISOWeek(utils.Int2Date(today))
+	st.Week = week
+	weekStart, weekEnd := utils.Date2Int(monday), utils.Date2Int(monday.AddDate(0, 0, 6))
+	for _, g := range goals {
+		p := &GoalProgress{Goal: *g}
+		for _, s := range all {
+			if s.Date >= weekStart && s.Date <= weekEnd && (g.Activity == "" || g.Activity == s.Activity) {
+				p.Actual += g.value(s)
+			}
+		}
+		p.Percent = math.Round(float64(p.Actual)/float64(g.Target)*10000) / 100
+		p.Done = p.Actual >= g.Target
+		st.Goals = append(st.Goals, p)
+	}
+	return st, nil
+}
+
+func addActivity(list []*ActivityTotal, s *Sport) []*ActivityTotal {
+	for _, t := range list {
+		if t.Activity == s.Activity {
+			t.add(s)
+			return list
+		}
+	}
+	t := &ActivityTotal{Activity: s.Activity}
+	t.add(s)
+	return append(list, t)
+}
+
+// periods 覆盖整个日期范围的周期，没有运动的周期为 0
+func periods(from, to time.Time, unit utils.PeriodUnit) map[int]*PeriodTotal {
+	m := map[int]*PeriodTotal{}
+	for _, p := range utils.Periods(from, to, unit) {
+		m[p.Key] = &PeriodTotal{Period: p.Key, Start: p.Start, ByActivity: []*ActivityTotal{}}
+	}
+	return m
+}
+
+func sortedPeriods(m map[int]*PeriodTotal) []*PeriodTotal {
+	list := make([]*PeriodTotal, 0, len(m))
+	for _, p := range m {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Start < list[j].Start })
+	return list
+}
+
+// streak 计算连续运动天数，list 按日期升序
+func streak(list []*Sport, today int) Streak {
+	var st Streak
+	var runStart, prev int
+	run := 0
+	for _, s := range list {
+		if s.Date == prev || s.Date > today {
+			continue
+		}
+		if prev != 0 && utils.Date2Int(utils.Int2Date(prev).AddDate(0, 0, 1)) == s.Date {
+			run++
+		} else {
+			run, runStart = 1, s.Date
+		}
+		if run > st.Longest {
+			st.Longest, st.Start, st.End = run, runStart, s.Date
+		}
+		prev = s.Date
+	}
+	st.Last = prev
+	yesterday := utils.Date2Int(utils.Int2Date(today).AddDate(0, 0, -1))
+	if prev == today || prev == yesterday {
+		st.Current = run
+	}
+	return st
+}
+
+// records 个人最好成绩：跑步按配速估算各距离的用时，最远的跑步和骑行，每个力量动作的最大重量
+func records(list []*Sport) []*Record {
+	best := map[string]*Record{}
+	var names []string
+	keep := func(r *Record, better bool) {
+		old := best[r.Name]
+		if old == nil {
+			names = append(names, r.Name)
+		}
+		if old == nil || better {
+			best[r.Name] = r
+		}
+	}
+	for _, s := range list {
+		switch s.Activity {
+		case ActivityRun:
+			for _, race := range raceDistances {
+				if s.Distance < race.distance || s.Duration == 0 {
+					continue
+				}
+				sec := math.Round(float64(s.Duration) * float64(race.distance) / float64(s.Distance))
+				old := best[race.name]
+				keep(&Record{Name: race.name, Activity: s.Activity, Value: sec, Unit: "s", Sport: s.ID, Date: s.Date},
+					old != nil && sec < old.Value)
+			}
+			if s.Distance > 0 {
+				old := best["longest run"]
+				keep(&Record{Name: "longest run", Activity: s.Activity, Value: float64(s.Distance), Unit: "m", Sport: s.ID, Date: s.Date},
+					old != nil && float64(s.Distance) > old.Value)
+			}
+		case ActivityCycle:
+			if s.Distance > 0 {
+				old := best["longest ride"]
+				keep(&Record{Name: "longest ride", Activity: s.Activity, Value: float64(s.Distance), Unit: "m", Sport: s.ID, Date: s.Date},
+					old != nil && float64(s.Distance) > old.Value)
+			}
+		case ActivityStrength:
+			exercise := strings.TrimSpace(s.Exercise)
+			if exercise == "" || s.Weight <= 0 {
+				continue
+			}
+			name := "heaviest " + strings.ToLower(exercise)
+			old := best[name]
+			keep(&Record{Name: name, Activity: s.Activity, Exercise: exercise, Value: s.Weight, Unit: "kg", Sport: s.ID, Date: s.Date},
+				old != nil && s.Weight > old.Value)
+		}
+	}
+	out := make([]*Record, 0, len(names))
+	for _, n := range names {
+		out = append(out, best[n])
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := recordOrder(out[i]), recordOrder(out[j])
+		if a != b {
+			return a < b
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// recordOrder 跑步按距离、然后是最远的跑步和骑行，力量动作在最后
+func recordOrder(r *Record) int {
+	for i, race := range raceDistances {
+		if r.Name == race.name {
+			return i
+		}
+	}
+	switch r.Name {
+	case "longest run":
+		return len(raceDistances)
+	case "longest ride":
+		return len(raceDistances) + 1
+	}
+	return len(raceDistances) + 2
+}
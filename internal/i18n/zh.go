@@ -90,4 +90,56 @@ var Zh = map[string]string{
 	"password updated":                 "密码已更新",
 	"same new and old password":        "新旧密码相同",
 	"search...":                        "搜索...",
+	"backup":                           "备份",
+	"last backup":                      "上次备份",
+	"next backup":                      "下次备份",
+	"last error":                       "上次错误",
+	"backup now":                       "立即备份",
+	"backup created":                   "备份已创建",
+	"file":                             "文件",
+	"size":                             "大小",
+	"time":                             "时间",
+	"restore":                          "恢复",
+	"restore data from this backup?":   "从此备份恢复数据？",
+	"backup restored":                  "备份已恢复",
+	"export all":                       "导出全部",
+	"import all":                       "导入全部",
+	"import data from this archive?":   "从此归档导入全部数据？",
+	"import finished":                  "导入完成",
+	"budget":                           "预算",
+	"over budget":                      "超出预算",
+	"account":                          "账户",
+	"currency":                         "币种",
+	"activity":                         "运动",
+	"duration(min)":                    "时长(分钟)",
+	"distance(m)":                      "距离(米)",
+	"calories":                         "热量",
+	"heart rate":                       "心率",
+	"max heart":                        "最大心率",
+	"exercise":                         "动作",
+	"sets":                             "组数",
+	"reps":                             "次数",
+	"weight(kg)":                       "重量(公斤)",
+	"notes":                            "备注",
+	"run":                              "跑步",
+	"walk":                             "步行",
+	"hike":                             "徒步",
+	"cycle":                            "骑行",
+	"swim":                             "游泳",
+	"strength":                         "力量",
+	"yoga":                             "瑜伽",
+	"other":                            "其它",
+	"import activity":                  "导入运动记录",
+	"pace(/km)":                        "配速(/公里)",
+	"ascent(m)":                        "爬升(米)",
+	"imported":                         "已导入",
+	"skipped":                          "已跳过",
+	"overdue":                          "已逾期",
+	"due today":                        "今天截止",
+	"upcoming":                         "即将截止",
+	"archived":                         "已归档",
+	"due":                              "截止日期",
+	"status":                           "状态",
+	"todo":                             "待办",
+	"doing":                            "进行中",
 }
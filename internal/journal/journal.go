@@ -0,0 +1,268 @@
+package journal
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Day One 记录的时区
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/diary"
+	"diarygo/internal/utils"
+)
+
+// Source 日记来源
+type Source string
+
+const (
+	SourceDayOne Source = "dayone" // Day One 导出的 JSON 或 zip
+	SourceText   Source = "text"   // 纯文本或 Markdown，按日期标题分段
+)
+
+func ParseSource(s string) (Source, error) {
+	switch Source(strings.ToLower(s)) {
+	case SourceDayOne:
+		return SourceDayOne, nil
+	case "", SourceText, "markdown":
+		return SourceText, nil
+	}
+	return "", errors.New("unknown journal source: " + s)
+}
+
+// Entry 一条日记，同一天可能有多条
+type Entry struct {
+	Date     int
+	Time     time.Time
+	Text     string
+	Weather  string
+	Location string
+}
+
+// Parse 按来源解析文件，zip 中的每个文件分别解析
+func Parse(src Source, name string, data []byte) ([]Entry, error) {
+	if bytes.HasPrefix(data, []byte("PK")) {
+		return parseZip(src, data)
+	}
+	if src == SourceDayOne {
+		return ParseDayOne(data)
+	}
+	return ParseText(name, data)
+}
+
+func parseZip(src Source, data []byte) ([]Entry, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, f := range zr.File {
+		ext := strings.ToLower(path.Ext(f.Name))
+		if f.FileInfo().IsDir() || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+		// Day One 的 zip 中还有照片等附件，只读取 JSON
+		if src == SourceDayOne && ext != ".json" {
+			continue
+		}
+		if src == SourceText && ext != ".txt" && ext != ".md" {
+			continue
+		}
+		b, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var list []Entry
+		if src == SourceDayOne {
+			list, err = ParseDayOne(b)
+		} else {
+			list, err = ParseText(f.Name, b)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		entries = append(entries, list...)
+	}
+	return entries, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+type dayOneExport struct {
+	Entries []struct {
+		CreationDate string `json:"creationDate"`
+		TimeZone     string `json:"timeZone"`
+		Text         string `json:"text"`
+		Location     *struct {
+			PlaceName          string `json:"placeName"`
+			LocalityName       string `json:"localityName"`
+			AdministrativeArea string `json:"administrativeArea"`
+			Country            string `json:"country"`
+		} `json:"location"`
+		Weather *struct {
+			ConditionsDescription string   `json:"conditionsDescription"`
+			TemperatureCelsius    *float64 `json:"temperatureCelsius"`
+		} `json:"weather"`
+	} `json:"entries"`
+}
+
+// ParseDayOne 解析 Day One 导出的 JSON，日期按记录所在时区计算
+func ParseDayOne(data []byte) ([]Entry, error) {
+	var export dayOneExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(export.Entries))
+	for i, e := range export.Entries {
+		t, err := time.Parse(time.RFC3339, e.CreationDate)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: invalid creationDate %q", i+1, e.CreationDate)
+		}
+		if loc, err := time.LoadLocation(e.TimeZone); e.TimeZone != "" && err == nil {
+			t = t.In(loc)
+		} else {
+			t = t.Local()
+		}
+		entry := Entry{
+			Date: utils.YMD2Int(t.Year(), int(t.Month()), t.Day()),
+			Time: t,
+			Text: strings.TrimSpace(e.Text),
+		}
+		if l := e.Location; l != nil {
+			entry.Location = firstNonEmpty(l.PlaceName, l.LocalityName, l.AdministrativeArea, l.Country)
+		}
+		if w := e.Weather; w != nil {
+			entry.Weather = w.ConditionsDescription
+			if w.TemperatureCelsius != nil {
+				temp := strconv.FormatFloat(*w.TemperatureCelsius, 'f', 0, 64) + "°C"
+				entry.Weather = strings.TrimSpace(entry.Weather + " " + temp)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// dateLine 匹配单独一行的日期标题，如 "# 2024-01-02"、"2024/1/2 周二"、"2024年1月2日"
+var dateLine = regexp.MustCompile(`^#{0,6}\s*(\d{4})[-/.年](\d{1,2})[-/.月](\d{1,2})(?:日|\b)(.*)$`)
+
+// ParseText 按日期标题行分段，没有日期标题时整个文件作为文件名中日期的一条
+func ParseText(name string, data []byte) ([]Entry, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var entries []Entry
+	var cur *Entry
+	var body []string
+	flush := func() {
+		if cur != nil {
+			cur.Text = strings.TrimSpace(strings.Join(body, "\n"))
+			entries = append(entries, *cur)
+		}
+		body = nil
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if date, ok := headingDate(line); ok {
+			flush()
+			cur = &Entry{Date: date}
+			continue
+		}
+		body = append(body, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if cur == nil {
+		date, ok := headingDate(path.Base(name))
+		if !ok {
+			return nil, fmt.Errorf("%s: no date heading found", name)
+		}
+		cur = &Entry{Date: date}
+	}
+	flush()
+	return entries, nil
+}
+
+func headingDate(line string) (int, bool) {
+	m := dateLine.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return 0, false
+	}
+	// 日期后面只允许跟星期、时间等简短内容，避免把正文中的日期当作标题
+	if len([]rune(strings.TrimSpace(m[4]))) > 20 {
+		return 0, false
+	}
+	y, _ := strconv.Atoi(m[1])
+	mo, _ := strconv.Atoi(m[2])
+	d, _ := strconv.Atoi(m[3])
+	date := utils.YMD2Int(y, mo, d)
+	return date, utils.IsValidDateInt(date)
+}
+
+// Merge 同一天的多条按时间顺序合并为一篇日记，天气和地点取第一条非空的值
+func Merge(entries []Entry) []*diary.Diary {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date != entries[j].Date {
+			return entries[i].Date < entries[j].Date
+		}
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	var list []*diary.Diary
+	for _, e := range entries {
+		if n := len(list); n > 0 && list[n-1].ID == e.Date {
+			d := list[n-1]
+			if e.Text != "" {
+				if d.Content != "" {
+					d.Content += "\n\n"
+				}
+				d.Content += e.Text
+			}
+			d.Weather = firstNonEmpty(d.Weather, e.Weather)
+			d.Location = firstNonEmpty(d.Location, e.Location)
+			continue
+		}
+		list = append(list, &diary.Diary{ID: e.Date, Content: e.Text, Weather: e.Weather, Location: e.Location})
+	}
+	return list
+}
+
+// Import 合并后按导入策略写入日记，DryRun 时只返回预览报告
+// 来源中没有天气或地点时保留已有日记的值
+func Import(d *db.DB, src Source, entries []Entry, opts db.ImportOptions) (*db.ImportReport, error) {
+	list := Merge(entries)
+	fields := []string{"id", "content"}
+	if src == SourceDayOne {
+		fields = append(fields, "weather", "location")
+	}
+	present := db.PresentFields[diary.Diary](fields...)
+	return diary.NewRepository(d).ImportItems(list, nil, present, 1, opts)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount 金额，以分为单位的整数，避免浮点数累加产生误差
+// JSON 和文本中写作两位小数，如 12.50
+type Amount int64
+
+// FromFloat 将浮点数四舍五入到分，超出 int64 范围时返回错误
+func FromFloat(f float64) (Amount, error) {
+	c := math.Round(f * 100)
+	// float64(math.MaxInt64) 实际为 2^63，已经越界
+	if math.IsNaN(c) || c >= math.MaxInt64 || c < math.MinInt64 {
+		return 0, fmt.Errorf("amount %g out of range", f)
+	}
+	return Amount(c), nil
+}
+
+// Parse 精确解析十进制金额，如 "12.5"、"-0.07"、"1e3"
+// 超过两位的小数四舍五入到分
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("empty amount")
+	}
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	intPart, frac, hasDot := strings.Cut(s, ".")
+	if (intPart == "" && frac == "") || !digits(intPart) || !digits(frac) {
+		// Excel 等可能写成科学计数法
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		a, err := FromFloat(f)
+		if err != nil {
+			return 0, err
+		}
+		if neg {
+			a = -a
+		}
+		return a, nil
+	}
+	if !hasDot {
+		frac = ""
+	}
+	// 第三位小数决定是否进位
+	round := len(frac) > 2 && frac[2] >= '5'
+	frac = (frac + "00")[:2]
+	if intPart == "" {
+		intPart = "0"
+	}
+	n, err := strconv.ParseInt(intPart+frac, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("amount %q out of range", s)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if round {
+		if n == math.MaxInt64 {
+			return 0, fmt.Errorf("amount %q out of range", s)
+		}
+		n++
+	}
+	if neg {
+		n = -n
+	}
+	return Amount(n), nil
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Float 转为浮点数，只用于展示或计算比例
+func (a Amount) Float() float64 {
+	return float64(a) / 100
+}
+
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Mul 乘以比例（如汇率），结果四舍五入到分
+func (a Amount) Mul(f float64) Amount {
+	return Amount(math.Round(float64(a) * f))
+}
+
+func (a Amount) String() string {
+	sign := ""
+	n := uint64(a)
+	if a < 0 {
+		sign = "-"
+		n = -n // 取绝对值，math.MinInt64 也不会溢出
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, n/100, n%100)
+}
+
+// MarshalJSON 输出 JSON 数字，如 12.50
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON 接受数字或字符串，按文本精确解析
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	if s == "" {
+		*a = 0
+		return nil
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalText(data []byte) error {
+	v, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Value 数据库中保存为整数分
+func (a Amount) Value() (driver.Value, error) {
+	return int64(a), nil
+}
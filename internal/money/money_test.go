@@ -0,0 +1,116 @@
+package money
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{"0", 0},
+		{"12", 1200},
+		{"12.5", 1250},
+		{"12.50", 1250},
+		{" 12.05 ", 1205},
+		{".5", 50},
+		{"5.", 500},
+		{"+3.10", 310},
+		{"-0.07", -7},
+		{"0.004", 0},
+		{"0.005", 1},
+		{"1.999", 200},
+		{"-1.005", -101},
+		{"1e3", 100000},
+		{"1.5E2", 15000},
+		{"-2.5e-1", -25},
+		{"92233720368547758.07", math.MaxInt64},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"", " ", "-", "abc", "1.2.3", "1,000", "NaN", "Inf", "-Inf",
+		"1e30", "-1e30", "1e17",
+		"92233720368547758.08",
+		"92233720368547758.075",
+		"99999999999999999999",
+	} {
+		if got, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %d, want error", in, got)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Amount
+	}{
+		{0, 0},
+		{12.5, 1250},
+		{-0.07, -7},
+		{1.005, 100}, // 1.005 的二进制表示略小于 1.005
+		{2.675, 268},
+	}
+	for _, tt := range tests {
+		got, err := FromFloat(tt.in)
+		if err != nil {
+			t.Errorf("FromFloat(%g) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FromFloat(%g) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []float64{1e30, -1e30, math.Inf(1), math.Inf(-1), math.NaN(), 1e17} {
+		if got, err := FromFloat(in); err == nil {
+			t.Errorf("FromFloat(%g) = %d, want error", in, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1250, "12.50"},
+		{-1205, "-12.05"},
+		{math.MaxInt64, "92233720368547758.07"},
+		{math.MinInt64, "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, a := range []Amount{0, 1, -1, 99, 100, -100, 123456789, -987654321, math.MaxInt64, math.MinInt64 + 1} {
+		got, err := Parse(a.String())
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", a.String(), err)
+			continue
+		}
+		if got != a {
+			t.Errorf("Parse(%q) = %d, want %d", a.String(), got, a)
+		}
+	}
+}
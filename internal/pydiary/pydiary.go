@@ -0,0 +1,253 @@
+package pydiary
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/entity/diary"
+	"diarygo/internal/entity/interest"
+	"diarygo/internal/entity/note"
+	"diarygo/internal/entity/sport"
+	"diarygo/internal/utils"
+)
+
+// Options pydiary 导入选项
+type Options struct {
+	Password string // pydiary 的密码，用于解密 __en__ 开头的内容
+	Strategy db.ImportStrategy
+	DryRun   bool
+}
+
+// TableResult 单个表的导入结果
+type TableResult struct {
+	Table   string           `json:"table"`
+	Missing bool             `json:"missing,omitempty"` // pydiary 中没有这个表
+	Ignored []string         `json:"ignored,omitempty"` // 无法识别的列
+	Report  *db.ImportReport `json:"report,omitempty"`
+}
+
+// rowImporter 由各模块仓库实现
+type rowImporter interface {
+	ImportRows(headers []string, rows [][]string, opts db.ImportOptions) (*db.ImportReport, error)
+}
+
+type table struct {
+	name    string
+	date    string // 保存日期（yyyymmdd）的列，用于确认文件格式
+	columns func() []string
+	repo    func(d *db.DB) rowImporter
+}
+
+func newTable[T any](name, date string, repo func(d *db.DB) rowImporter) table {
+	return table{
+		name:    name,
+		date:    date,
+		columns: func() []string { return append(db.StructCols(new(T), false), db.StructAliases(new(T))...) },
+		repo:    repo,
+	}
+}
+
+// pydiary 与 diarygo 使用相同的表名和列名
+var tables = []table{
+	newTable[diary.Diary](diary.TABLE, "id", func(d *db.DB) rowImporter { return diary.NewRepository(d) }),
+	newTable[bill.Bill](bill.TABLE, "date", func(d *db.DB) rowImporter { return bill.NewRepository(d) }),
+	newTable[interest.Interest](interest.TABLE, "added", func(d *db.DB) rowImporter { return interest.NewRepository(d) }),
+	newTable[note.Note](note.TABLE, "begin", func(d *db.DB) rowImporter { return note.NewRepository(d) }),
+	newTable[sport.Sport](sport.TABLE, "date", func(d *db.DB) rowImporter { return sport.NewRepository(d) }),
+}
+
+// ErrWrongPassword 加密内容无法用给定的密码解密
+var ErrWrongPassword = errors.New("wrong pydiary password")
+
+// tableData 读出并解密的一张表，headers 为 nil 表示表不存在
+type tableData struct {
+	headers []string
+	rows    [][]string
+}
+
+// Import 以只读方式打开 pydiary 数据库，逐表导入到 d
+// 默认按自然键合并，重复导入不会产生重复记录；无效行跳过并记录在报告中
+func Import(path string, d *db.DB, opts Options) ([]TableResult, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	src, err := db.Open("file:" + (&url.URL{Path: path}).EscapedPath() + "?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if err := src.Conn.Ping(); err != nil {
+		return nil, fmt.Errorf("open pydiary database: %w", err)
+	}
+
+	if opts.Strategy == "" {
+		opts.Strategy = db.StrategyNaturalKey
+	}
+	importOpts := db.ImportOptions{
+		Strategy:    opts.Strategy,
+		DryRun:      opts.DryRun,
+		SkipInvalid: true,
+	}
+
+	// 先读出并校验所有表，格式或密码不对时不导入任何数据
+	data := make([]tableData, len(tables))
+	found := false
+	for i, t := range tables {
+		headers, rows, err := readTable(src.Conn, t.name, opts.Password)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.name, err)
+		}
+		if headers == nil {
+			continue
+		}
+		if err := checkTable(t, headers, rows); err != nil {
+			return nil, err
+		}
+		data[i] = tableData{headers: headers, rows: rows}
+		found = true
+	}
+	if !found {
+		return nil, errors.New("not a pydiary database: no known tables")
+	}
+
+	results := make([]TableResult, 0, len(tables))
+	for i, t := range tables {
+		res := TableResult{Table: t.name}
+		headers, rows := data[i].headers, data[i].rows
+		if headers == nil {
+			res.Missing = true
+			results = append(results, res)
+			continue
+		}
+		res.Ignored = unknownColumns(headers, t.columns())
+		res.Report, err = t.repo(d).ImportRows(headers, rows, importOpts)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", t.name, err)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// checkTable 确认表有 id 列，且首行的日期列是有效日期
+func checkTable(t table, headers []string, rows [][]string) error {
+	id, date := -1, -1
+	for i, h := range headers {
+		h = strings.ToLower(h)
+		if h == "id" {
+			id = i
+		}
+		if h == t.date {
+			date = i
+		}
+	}
+	if id < 0 || date < 0 {
+		return fmt.Errorf("not a pydiary database: %s has no id or %s column", t.name, t.date)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if v, err := strconv.Atoi(rows[0][date]); err != nil || !utils.IsValidDateInt(v) {
+		return fmt.Errorf("not a pydiary database: %s.%s %q is not a date", t.name, t.date, rows[0][date])
+	}
+	return nil
+}
+
+// readTable 读取整张表，字符串按 pydiary 密码解密，表不存在时返回 nil
+// 加密内容（__en__ 开头）解密后不是正常文本时返回 ErrWrongPassword
+func readTable(conn *sql.DB, name, password string) ([]string, [][]string, error) {
+	var n int
+	err := conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n)
+	if err != nil || n == 0 {
+		return nil, nil, err
+	}
+
+	rs, err := conn.Query(`SELECT * FROM "` + name + `" ORDER BY rowid`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rs.Close()
+
+	headers, err := rs.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	rows := [][]string{}
+	for rs.Next() {
+		values := make([]any, len(headers))
+		ptrs := make([]any, len(headers))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rs.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+		row := make([]string, len(headers))
+		for i, v := range values {
+			switch val := v.(type) {
+			case nil:
+			case []byte:
+				row[i], err = decrypt(string(val), password)
+			case string:
+				row[i], err = decrypt(val, password)
+			default:
+				row[i] = db.FormatValue(val)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		rows = append(rows, row)
+	}
+	return headers, rows, rs.Err()
+}
+
+// decrypt 按 pydiary 的 XOR 格式解密，密码错误时解出的内容通常含有控制字符或无效字符
+func decrypt(s, password string) (string, error) {
+	if !strings.HasPrefix(s, db.EncryptPrefix) {
+		return s, nil
+	}
+	if password == "" {
+		return "", errors.New("pydiary database is encrypted, password required")
+	}
+	plain := db.DecryptWith(s, password)
+	if !plainText(plain) {
+		return "", ErrWrongPassword
+	}
+	return plain, nil
+}
+
+func plainText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if r == utf8.RuneError || !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func unknownColumns(headers, known []string) []string {
+	set := make(map[string]bool, len(known))
+	for _, c := range known {
+		set[c] = true
+	}
+	var out []string
+	for _, h := range headers {
+		if !set[h] {
+			out = append(out, h)
+		}
+	}
+	return out
+}
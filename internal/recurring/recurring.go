@@ -0,0 +1,113 @@
+package recurring
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"diarygo/internal/config"
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/utils"
+)
+
+// Manager 定时把到期的周期账单生成到账单表
+type Manager struct {
+	Interval time.Duration // 检查间隔
+	stop     chan struct{}
+
+	mu        sync.Mutex
+	lastRun   time.Time
+	lastCount int
+	lastError string
+}
+
+// Status 最近一次运行的结果
+type Status struct {
+	Interval  string `json:"interval"`
+	LastRun   string `json:"last_run"`
+	LastCount int    `json:"last_count"`
+	LastError string `json:"last_error"`
+}
+
+var current *Manager
+
+// Get 返回当前管理器，未启动时为 nil
+func Get() *Manager {
+	return current
+}
+
+// NewManager 创建周期账单管理器
+func NewManager(interval time.Duration) *Manager {
+	return &Manager{
+		Interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Run 启动定时检查
+func (m *Manager) Run() {
+	if m.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(m.Interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				_, _ = m.RunNow()
+			case <-m.stop:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止定时检查
+func (m *Manager) Stop() {
+	close(m.stop)
+}
+
+// RunNow 立即生成截至今天的账单，返回生成数量
+func (m *Manager) RunNow() (int, error) {
+	n, err := bill.NewRecurringRepository(db.Get()).Materialize(utils.GetCurrentDateInt())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastRun = time.Now()
+	m.lastCount = n
+	m.lastError = ""
+	if err != nil {
+		m.lastError = err.Error()
+		fmt.Println("[recurring]", err)
+	}
+	return n, err
+}
+
+// Status 返回最近一次运行的结果
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Status{
+		Interval:  m.Interval.String(),
+		LastCount: m.lastCount,
+		LastError: m.lastError,
+	}
+	if !m.lastRun.IsZero() {
+		s.LastRun = m.lastRun.Format("2006-01-02 15:04:05")
+	}
+	return s
+}
+
+// Start 启动时先补生成停机期间到期的账单，再定时检查
+func Start(cfg *config.Repository) *Manager {
+	interval, _ := time.ParseDuration(cfg.Get("recurring", "interval"))
+	m := NewManager(interval)
+	current = m
+
+	m.RunNow()
+	m.Run()
+	return m
+}
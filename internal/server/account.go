@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/money"
+	"diarygo/internal/utils"
+)
+
+func RegisterBillAccountResource(DB *db.DB) Resource[bill.Account] {
+	repo := bill.NewAccountRepository(DB)
+	return Resource[bill.Account]{
+		Name: bill.AccountTable,
+		Repo: repo,
+	}
+}
+
+func RegisterBillTransferResource(DB *db.DB) Resource[bill.Transfer] {
+	repo := bill.NewTransferRepository(DB)
+	return Resource[bill.Transfer]{
+		Name: bill.TransferTable,
+		Repo: repo,
+
+		List: func(r *http.Request) (any, error) {
+			start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+			end, _ := strconv.Atoi(r.URL.Query().Get("end"))
+			if end == 0 {
+				end = 99991231
+			}
+			return repo.GetBetweenDates(start, end, "DESC")
+		},
+	}
+}
+
+// billAccountBalanceAPI 返回所有账户截至 date（默认今天）的余额，金额为基准货币
+func billAccountBalanceAPI(w http.ResponseWriter, r *http.Request) {
+	date, _ := strconv.Atoi(r.URL.Query().Get("date"))
+	if date == 0 {
+		date = utils.GetCurrentDateInt()
+	}
+	conv, err := billConverter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	list, err := bill.NewAccountRepository(db.Get()).Balances(date, conv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, list)
+}
+
+// billAccountLedgerAPI 返回账户在日期范围内的流水和逐笔余额
+func billAccountLedgerAPI(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id, _ := strconv.Atoi(q.Get("id"))
+	start, _ := strconv.Atoi(q.Get("start"))
+	end, _ := strconv.Atoi(q.Get("end"))
+	if end == 0 {
+		end = utils.GetCurrentDateInt()
+	}
+	conv, err := billConverter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ledger, err := bill.NewAccountRepository(db.Get()).Ledger(id, start, end, conv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, ledger)
+}
+
+// billAccountReconcileAPI 用对账单余额核对账户余额，adjust 为 true 时自动补差额账单
+func billAccountReconcileAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ID      int          `json:"id"`
+		Date    int          `json:"date"`
+		Balance money.Amount `json:"balance"`
+		Adjust  bool         `json:"adjust"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Date == 0 {
+		req.Date = utils.GetCurrentDateInt()
+	}
+	conv, err := billConverter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res, err := bill.NewAccountRepository(db.Get()).Reconcile(req.ID, req.Date, req.Balance, req.Adjust, conv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, res)
+}
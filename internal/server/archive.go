@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"diarygo/internal/archive"
+	"diarygo/internal/config"
+	"diarygo/internal/db"
+	"diarygo/internal/i18n"
+	"diarygo/internal/utils"
+)
+
+func exportAllAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	opts := archive.ExportOptions{Encrypted: r.URL.Query().Get("mode") == "encrypted"}
+
+	respFileHead(w, fmt.Sprintf("diarygo_%s.zip", utils.GetNowYYMMDD()), "application/zip")
+	if err := archive.Export(w, db.Get(), opts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func importAllAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	opts := archive.ImportOptions{
+		Replace: r.FormValue("mode") == "replace",
+		Config:  r.FormValue("config") == "1",
+	}
+	res, err := archive.Import(file, header.Size, db.Get(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if res.Config > 0 {
+		i18n.Init(config.GetRepository().Get("global", "language"))
+	}
+	jsonRes(w, res)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"diarygo/internal/blob"
+	"diarygo/internal/config"
+	"diarygo/internal/db"
+	"diarygo/internal/entity/attachment"
+)
+
+func attachmentRepo() *attachment.Repository {
+	return attachment.NewRepository(db.Get(), blob.Get())
+}
+
+// readUpload 读取 multipart 的 file 字段，大小受附件的 max_size 限制，失败时已写入错误
+func readUpload(w http.ResponseWriter, r *http.Request) (string, []byte, bool) {
+	limit := int64(config.GetRepository().GetInt("attachment", "max_size", 20)) << 20
+	// 留出 multipart 头部的余量，文件本身的大小在读取时再检查
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			return "", nil, false
+		}
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return "", nil, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", nil, false
+	}
+	if int64(len(data)) > limit {
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return "", nil, false
+	}
+	return header.Filename, data, true
+}
+
+// attachmentUploadAPI 上传文件（multipart 的 file 字段）挂到 module 的 record 上
+func attachmentUploadAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name, data, ok := readUpload(w, r)
+	if !ok {
+		return
+	}
+	record, _ := strconv.Atoi(r.FormValue("record"))
+	a, err := attachmentRepo().Add(r.FormValue("module"), record, name, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, a)
+}
+
+// attachmentListAPI 返回某条记录的附件
+func attachmentListAPI(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	record, _ := strconv.Atoi(q.Get("record"))
+	list, err := attachmentRepo().ListFor(q.Get("module"), record)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, list)
+}
+
+// attachmentDownloadAPI 下载附件，thumb=1 时返回缩略图
+// 只有图片和 PDF 在浏览器中直接打开，其它文件一律下载，避免上传的网页在本站执行
+func attachmentDownloadAPI(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id, _ := strconv.Atoi(q.Get("id"))
+	thumb := q.Get("thumb") == "1"
+	a, data, err := attachmentRepo().Open(id, thumb)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	typ := a.Mime
+	if thumb {
+		typ = "image/jpeg"
+	}
+	disposition := "attachment"
+	if (strings.HasPrefix(typ, "image/") && typ != "image/svg+xml") || typ == "application/pdf" {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", typ)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	http.ServeContent(w, r, "", time.Unix(int64(a.Created), 0), bytes.NewReader(data))
+}
+
+// attachmentDeleteAPI 删除附件，不再被引用的文件一并删除
+func attachmentDeleteAPI(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	if err := attachmentRepo().DeleteByID(id); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonOK(w)
+}
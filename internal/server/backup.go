@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+
+	"diarygo/internal/backup"
+)
+
+func backupManager(w http.ResponseWriter) *backup.Manager {
+	m := backup.Get()
+	if m == nil {
+		http.Error(w, "backup not configured", http.StatusNotImplemented)
+	}
+	return m
+}
+
+func backupRunAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m := backupManager(w)
+	if m == nil {
+		return
+	}
+	name, err := m.RunNow()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, map[string]any{"ok": true, "file": name})
+}
+
+func backupStatusAPI(w http.ResponseWriter, r *http.Request) {
+	m := backupManager(w)
+	if m == nil {
+		return
+	}
+	jsonRes(w, m.Status())
+}
+
+func backupListAPI(w http.ResponseWriter, r *http.Request) {
+	m := backupManager(w)
+	if m == nil {
+		return
+	}
+	files, err := m.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, files)
+}
+
+func backupRestoreAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	m := backupManager(w)
+	if m == nil {
+		return
+	}
+	if err := m.Restore(req.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonOK(w)
+}
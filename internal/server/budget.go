@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/utils"
+)
+
+func RegisterBillBudgetResource(DB *db.DB) Resource[bill.Budget] {
+	repo := bill.NewBudgetRepository(DB)
+	return Resource[bill.Budget]{
+		Name: bill.BudgetTable,
+		Repo: repo,
+	}
+}
+
+// billBudgetStatusAPI 返回某月（YYYYMM，默认本月）各分类预算的执行情况
+func billBudgetStatusAPI(w http.ResponseWriter, r *http.Request) {
+	month, _ := strconv.Atoi(r.URL.Query().Get("month"))
+	if month == 0 {
+		month = utils.GetCurrentYYYYMM()
+	}
+	if month%100 < 1 || month%100 > 12 {
+		http.Error(w, "invalid month", http.StatusBadRequest)
+		return
+	}
+	conv, err := billConverter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	status, err := bill.NewBudgetRepository(db.Get()).Status(month, conv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, status)
+}
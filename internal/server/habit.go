@@ -0,0 +1,141 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/habit"
+	"diarygo/internal/utils"
+)
+
+func RegisterHabitResource(DB *db.DB) Resource[habit.Habit] {
+	repo := habit.NewRepository(DB)
+	return Resource[habit.Habit]{
+		Name: habit.TABLE,
+		Repo: repo,
+	}
+}
+
+// RegisterHabitCheckinResource 打卡记录，可按 habit 和日期范围筛选
+func RegisterHabitCheckinResource(DB *db.DB) Resource[habit.Checkin] {
+	repo := habit.NewCheckinRepository(DB)
+	return Resource[habit.Checkin]{
+		Name: habit.CheckinTable,
+		Repo: repo,
+
+		List: func(r *http.Request) (any, error) {
+			q := r.URL.Query()
+			id, _ := strconv.Atoi(q.Get("habit"))
+			start, _ := strconv.Atoi(q.Get("start"))
+			end, _ := strconv.Atoi(q.Get("end"))
+			if end == 0 {
+				end = 99991231
+			}
+			return repo.Between(id, start, end)
+		},
+	}
+}
+
+// habitRange 读取 start 和 end，默认为截至今天的 days 天
+func habitRange(r *http.Request, days int) (start, end int, ok bool) {
+	q := r.URL.Query()
+	start, _ = strconv.Atoi(q.Get("start"))
+	end, _ = strconv.Atoi(q.Get("end"))
+	if end == 0 {
+		end = utils.GetCurrentDateInt()
+	}
+	if start == 0 && utils.IsValidDateInt(end) {
+		start = utils.Date2Int(utils.Int2Date(end).AddDate(0, 0, 1-days))
+	}
+	return start, end, utils.IsValidDateInt(start) && utils.IsValidDateInt(end) && start <= end
+}
+
+// habitList 全部习惯，habit 参数不为 0 时只返回该习惯
+func habitList(r *http.Request) ([]*habit.Habit, error) {
+	repo := habit.NewRepository(db.Get())
+	id, _ := strconv.Atoi(r.URL.Query().Get("habit"))
+	if id == 0 {
+		return repo.List()
+	}
+	h, err := repo.GetByID(id)
+	if err != nil || h == nil {
+		return nil, err
+	}
+	return []*habit.Habit{h}, nil
+}
+
+// habitCheckinAPI 打卡或取消打卡，date 默认今天
+func habitCheckinAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Habit int `json:"habit"`
+		Date  int `json:"date"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Date == 0 {
+		req.Date = utils.GetCurrentDateInt()
+	}
+	done, err := habit.NewCheckinRepository(db.Get()).Toggle(req.Habit, req.Date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, map[string]any{"habit": req.Habit, "date": req.Date, "done": done})
+}
+
+// habitStatsAPI 返回每个习惯的连续天数和 [start, end]（默认最近 30 天）的完成率
+func habitStatsAPI(w http.ResponseWriter, r *http.Request) {
+	start, end, ok := habitRange(r, 30)
+	if !ok {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+	habits, err := habitList(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	checkins, err := habit.NewCheckinRepository(db.Get()).Between(0, 0, 99991231)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats, err := habit.Stats(habits, checkins, start, end, utils.GetCurrentDateInt())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, stats)
+}
+
+// habitHeatmapAPI 返回 [start, end]（默认最近一年）每天的打卡情况，habit 为 0 时合计所有习惯
+func habitHeatmapAPI(w http.ResponseWriter, r *http.Request) {
+	start, end, ok := habitRange(r, 365)
+	if !ok {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+	habits, err := habitList(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	checkins, err := habit.NewCheckinRepository(db.Get()).Between(0, start, end)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	days, err := habit.Heatmap(habits, checkins, start, end)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, days)
+}
@@ -5,12 +5,15 @@ import (
 	"net/http"
 
 	"diarygo/internal/backup"
+	"diarygo/internal/blob"
 	"diarygo/internal/config"
 	"diarygo/internal/db"
 	"diarygo/internal/i18n"
+	"diarygo/internal/recurring"
 )
 
-func InitServer() {
+// InitServer 启动服务，迁移失败或端口被占用时返回错误
+func InitServer() error {
 	cfg := config.GetRepository()
 	db.Init(cfg.Get("global", "db_name"))
 	defer db.Close()
@@ -22,10 +25,21 @@ func InitServer() {
 		defer m.Stop()
 	}
 
+	// 迁移只在启动时执行一次，失败时不启动，避免在旧结构上读写
+	if err := db.RunMigrations(db.Get()); err != nil {
+		return err
+	}
+
+	blob.Setup(cfg.Get("attachment", "dir"), cfg.Get("attachment", "encrypt") == "1")
+
 	initSessionKey()
 	registerRoutes()
 
+	// 路由注册时已建表，之后再补生成周期账单
+	r := recurring.Start(cfg)
+	defer r.Stop()
+
 	port := cfg.Get("global", "port")
 	fmt.Printf("Server started at http://localhost:%s\n", port)
-	http.ListenAndServe(":"+port, nil)
+	return http.ListenAndServe(":"+port, nil)
 }
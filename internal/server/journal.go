@@ -0,0 +1,52 @@
+package server
+
+import (
+	"io"
+	"net/http"
+
+	"diarygo/internal/db"
+	"diarygo/internal/journal"
+)
+
+// diaryJournalImportAPI 导入 Day One 或纯文本日记，preview 为 true 时只返回预览报告
+func diaryJournalImportAPI(preview bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "missing file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		src, err := journal.ParseSource(r.FormValue("source"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts, err := importOptions(r, header, preview)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries, err := journal.Parse(src, header.Filename, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report, err := journal.Import(db.Get(), src, entries, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jsonRes(w, report)
+	}
+}
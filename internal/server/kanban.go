@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/note"
+)
+
+func RegisterNoteColumnResource(DB *db.DB) Resource[note.Column] {
+	repo := note.NewColumnRepository(DB)
+	return Resource[note.Column]{
+		Name: note.ColumnTable,
+		Repo: repo,
+	}
+}
+
+// noteBoardAPI 返回看板，第一列是未分列的任务
+func noteBoardAPI(w http.ResponseWriter, r *http.Request) {
+	columns, err := note.NewColumnRepository(db.Get()).List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	board, err := note.NewRepository(db.Get()).Board(columns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, board)
+}
+
+// noteMoveAPI 把任务移到某列的某个位置，column 为 0 表示移出看板的列
+func noteMoveAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ID      int `json:"id"`
+		Column  int `json:"column"`
+		Ordinal int `json:"ordinal"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	n, err := note.NewRepository(db.Get()).Move(req.ID, req.Column, req.Ordinal)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, n)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/sport"
+	"diarygo/internal/utils"
+)
+
+func RegisterSportPlanResource(DB *db.DB) Resource[sport.Plan] {
+	repo := sport.NewPlanRepository(DB)
+	return Resource[sport.Plan]{
+		Name: sport.PlanTable,
+		Repo: repo,
+	}
+}
+
+// RegisterSportWorkoutResource 计划中的训练，可按 plan 和日期范围筛选
+func RegisterSportWorkoutResource(DB *db.DB) Resource[sport.Workout] {
+	repo := sport.NewWorkoutRepository(DB)
+	return Resource[sport.Workout]{
+		Name: sport.WorkoutTable,
+		Repo: repo,
+
+		List: func(r *http.Request) (any, error) {
+			q := r.URL.Query()
+			plan, _ := strconv.Atoi(q.Get("plan"))
+			start, _ := strconv.Atoi(q.Get("start"))
+			end, _ := strconv.Atoi(q.Get("end"))
+			if end == 0 {
+				end = 99991231
+			}
+			return repo.Between(plan, start, end)
+		},
+	}
+}
+
+// sportPlanTemplatesAPI 返回内置的计划模板
+func sportPlanTemplatesAPI(w http.ResponseWriter, r *http.Request) {
+	jsonRes(w, sport.Templates)
+}
+
+// sportWorkoutCompleteAPI 用运动记录完成计划中的训练，sport 为 0 时取消完成
+func sportWorkoutCompleteAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ID    int `json:"id"`
+		Sport int `json:"sport"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	workout, err := sport.NewWorkoutRepository(db.Get()).Complete(req.ID, req.Sport)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, workout)
+}
+
+// sportPlanMatchAPI 按日期和运动类型自动关联计划中未完成的训练
+func sportPlanMatchAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	plan, _ := strconv.Atoi(r.URL.Query().Get("plan"))
+	n, err := sport.NewWorkoutRepository(db.Get()).Match(plan)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, map[string]int{"matched": n})
+}
+
+// sportPlanComplianceAPI 返回计划截至今天的完成情况
+func sportPlanComplianceAPI(w http.ResponseWriter, r *http.Request) {
+	plan, _ := strconv.Atoi(r.URL.Query().Get("plan"))
+	report, err := sport.NewWorkoutRepository(db.Get()).Compliance(plan, utils.GetCurrentDateInt())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, report)
+}
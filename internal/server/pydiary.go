@@ -0,0 +1,65 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"os"
+
+	"diarygo/internal/db"
+	"diarygo/internal/pydiary"
+)
+
+// pydiaryImportAPI 上传 pydiary 数据库文件并导入，password 为空时使用当前登录密码
+func pydiaryImportAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	strategy := r.FormValue("strategy")
+	if strategy == "" {
+		strategy = string(db.StrategyNaturalKey)
+	}
+	st, err := db.ParseImportStrategy(strategy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	password := r.FormValue("password")
+	if password == "" {
+		password = db.Key
+	}
+
+	// sqlite 只能从文件打开，先写入临时文件
+	tmp, err := os.CreateTemp("", "pydiary_*.db")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, file)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	results, err := pydiary.Import(tmp.Name(), db.Get(), pydiary.Options{
+		Password: password,
+		Strategy: st,
+		DryRun:   r.FormValue("dry_run") == "1",
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, map[string]any{"ok": true, "tables": results})
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"diarygo/internal/config"
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+)
+
+func RegisterBillRateResource(DB *db.DB) Resource[bill.Rate] {
+	repo := bill.NewRateRepository(DB)
+	return Resource[bill.Rate]{
+		Name: bill.RateTable,
+		Repo: repo,
+	}
+}
+
+// billConverter 按配置的基准货币创建汇率换算器
+func billConverter() (*bill.Converter, error) {
+	base := config.GetRepository().Get("bill", "base_currency")
+	return bill.NewRateRepository(db.Get()).Converter(base)
+}
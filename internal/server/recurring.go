@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/recurring"
+)
+
+func RegisterBillRecurringResource(DB *db.DB) Resource[bill.Recurring] {
+	repo := bill.NewRecurringRepository(DB)
+	return Resource[bill.Recurring]{
+		Name: bill.RecurringTable,
+		Repo: repo,
+	}
+}
+
+func recurringManager(w http.ResponseWriter) *recurring.Manager {
+	m := recurring.Get()
+	if m == nil {
+		http.Error(w, "recurring bills not started", http.StatusNotImplemented)
+	}
+	return m
+}
+
+// billRecurringRunAPI 立即生成到期的周期账单
+func billRecurringRunAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m := recurringManager(w)
+	if m == nil {
+		return
+	}
+	n, err := m.RunNow()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, map[string]any{"ok": true, "count": n})
+}
+
+func billRecurringStatusAPI(w http.ResponseWriter, r *http.Request) {
+	m := recurringManager(w)
+	if m == nil {
+		return
+	}
+	jsonRes(w, m.Status())
+}
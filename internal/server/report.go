@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/utils"
+)
+
+// billReportAPI 返回 [start, end]（默认今年 1 月 1 日到今天）的账单统计，top 为支出最多的摘要数量
+func billReportAPI(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, _ := strconv.Atoi(q.Get("start"))
+	end, _ := strconv.Atoi(q.Get("end"))
+	if end == 0 {
+		end = utils.GetCurrentDateInt()
+	}
+	if start == 0 {
+		start = end/10000*10000 + 101
+	}
+	top := 10
+	if s := q.Get("top"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > 100 {
+			http.Error(w, "invalid top", http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+	if !utils.IsValidDateInt(start) || !utils.IsValidDateInt(end) || start > end {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+	conv, err := billConverter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report, err := bill.NewRepository(db.Get()).Report(start, end, top, conv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, report)
+}
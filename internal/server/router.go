@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
@@ -34,10 +35,26 @@ func registerRoutes() {
 	configTpl = initTemplate("config.html", "web/templates/config.html", true)
 	loginTpl = initTemplate("login.html", "web/templates/login.html", false)
 	billRes := RegisterBillResource(DB)
+	billProfileRes := RegisterBillProfileResource(DB)
+	billRuleRes := RegisterBillRuleResource(DB)
+	billRecurringRes := RegisterBillRecurringResource(DB)
+	billBudgetRes := RegisterBillBudgetResource(DB)
+	billAccountRes := RegisterBillAccountResource(DB)
+	billTransferRes := RegisterBillTransferResource(DB)
+	billRateRes := RegisterBillRateResource(DB)
+	billPersonRes := RegisterBillPersonResource(DB)
+	billSplitRes := RegisterBillSplitResource(DB)
 	diaryRes := RegisterDiaryResource(DB)
 	interestRes := RegisterInterestResource(DB)
 	noteRes := RegisterNoteResource(DB)
+	noteSubtaskRes := RegisterNoteSubtaskResource(DB)
+	noteColumnRes := RegisterNoteColumnResource(DB)
 	sportRes := RegisterSportResource(DB)
+	sportGoalRes := RegisterSportGoalResource(DB)
+	sportPlanRes := RegisterSportPlanResource(DB)
+	sportWorkoutRes := RegisterSportWorkoutResource(DB)
+	habitRes := RegisterHabitResource(DB)
+	habitCheckinRes := RegisterHabitCheckinResource(DB)
 
 	// -------------------- Web Page --------------------
 	http.HandleFunc("/", loginPage)
@@ -56,10 +73,29 @@ func registerRoutes() {
 	http.HandleFunc("/api/config/batch", requireLogin(configBatchAPI))
 	http.HandleFunc("/api/config/change_password", requireLogin(configChangePasswordAPI))
 
+	http.HandleFunc("/api/backup/run", requireLogin(backupRunAPI))
+	http.HandleFunc("/api/backup/status", requireLogin(backupStatusAPI))
+	http.HandleFunc("/api/backup/list", requireLogin(backupListAPI))
+	http.HandleFunc("/api/backup/restore", requireLogin(backupRestoreAPI))
+
+	http.HandleFunc("/api/export/all", requireLogin(exportAllAPI))
+	http.HandleFunc("/api/import/all", requireLogin(importAllAPI))
+	http.HandleFunc("/api/import/pydiary", requireLogin(pydiaryImportAPI))
+
 	http.HandleFunc("/api/diary/list", ListHandler(diaryRes))
 	http.HandleFunc("/api/diary/update", UpdateHandler(diaryRes))
 	http.HandleFunc("/api/diary/export", ExportHandler(diaryRes))
 	http.HandleFunc("/api/diary/import", ImportHandler(diaryRes))
+	http.HandleFunc("/api/diary/import/preview", ImportPreviewHandler(diaryRes))
+	http.HandleFunc("/api/diary/export/markdown", requireLogin(diaryMarkdownExportAPI))
+	http.HandleFunc("/api/diary/import/markdown", requireLogin(diaryMarkdownImportAPI))
+	http.HandleFunc("/api/diary/import/journal", requireLogin(diaryJournalImportAPI(false)))
+	http.HandleFunc("/api/diary/import/journal/preview", requireLogin(diaryJournalImportAPI(true)))
+
+	http.HandleFunc("/api/attachment/upload", requireLogin(attachmentUploadAPI))
+	http.HandleFunc("/api/attachment/list", requireLogin(attachmentListAPI))
+	http.HandleFunc("/api/attachment/download", requireLogin(attachmentDownloadAPI))
+	http.HandleFunc("/api/attachment/delete", requireLogin(attachmentDeleteAPI))
 
 	http.HandleFunc("/api/bill/list", ListHandler(billRes))
 	http.HandleFunc("/api/bill/add", AddHandler(billRes))
@@ -67,6 +103,66 @@ func registerRoutes() {
 	http.HandleFunc("/api/bill/delete", DeleteHandler(billRes))
 	http.HandleFunc("/api/bill/export", ExportHandler(billRes))
 	http.HandleFunc("/api/bill/import", ImportHandler(billRes))
+	http.HandleFunc("/api/bill/import/preview", ImportPreviewHandler(billRes))
+	http.HandleFunc("/api/bill/report", requireLogin(billReportAPI))
+	http.HandleFunc("/api/bill/import/statement", requireLogin(statementImportAPI(false)))
+	http.HandleFunc("/api/bill/import/statement/preview", requireLogin(statementImportAPI(true)))
+
+	http.HandleFunc("/api/bill/profile/list", ListHandler(billProfileRes))
+	http.HandleFunc("/api/bill/profile/add", AddHandler(billProfileRes))
+	http.HandleFunc("/api/bill/profile/update", UpdateHandler(billProfileRes))
+	http.HandleFunc("/api/bill/profile/delete", DeleteHandler(billProfileRes))
+
+	http.HandleFunc("/api/bill/rule/list", ListHandler(billRuleRes))
+	http.HandleFunc("/api/bill/rule/add", AddHandler(billRuleRes))
+	http.HandleFunc("/api/bill/rule/update", UpdateHandler(billRuleRes))
+	http.HandleFunc("/api/bill/rule/delete", DeleteHandler(billRuleRes))
+	http.HandleFunc("/api/bill/rule/apply", requireLogin(billRuleApplyAPI))
+
+	http.HandleFunc("/api/bill/recurring/list", ListHandler(billRecurringRes))
+	http.HandleFunc("/api/bill/recurring/add", AddHandler(billRecurringRes))
+	http.HandleFunc("/api/bill/recurring/update", UpdateByIDHandler(billRecurringRes))
+	http.HandleFunc("/api/bill/recurring/delete", DeleteHandler(billRecurringRes))
+	http.HandleFunc("/api/bill/recurring/run", requireLogin(billRecurringRunAPI))
+	http.HandleFunc("/api/bill/recurring/status", requireLogin(billRecurringStatusAPI))
+
+	http.HandleFunc("/api/bill/budget", requireLogin(billBudgetStatusAPI))
+	http.HandleFunc("/api/bill/budget/list", ListHandler(billBudgetRes))
+	http.HandleFunc("/api/bill/budget/add", AddHandler(billBudgetRes))
+	http.HandleFunc("/api/bill/budget/update", UpdateHandler(billBudgetRes))
+	http.HandleFunc("/api/bill/budget/delete", DeleteHandler(billBudgetRes))
+
+	http.HandleFunc("/api/bill/account/list", ListHandler(billAccountRes))
+	http.HandleFunc("/api/bill/account/add", AddHandler(billAccountRes))
+	http.HandleFunc("/api/bill/account/update", UpdateHandler(billAccountRes))
+	http.HandleFunc("/api/bill/account/delete", DeleteHandler(billAccountRes))
+	http.HandleFunc("/api/bill/account/balance", requireLogin(billAccountBalanceAPI))
+	http.HandleFunc("/api/bill/account/ledger", requireLogin(billAccountLedgerAPI))
+	http.HandleFunc("/api/bill/account/reconcile", requireLogin(billAccountReconcileAPI))
+
+	http.HandleFunc("/api/bill/transfer/list", ListHandler(billTransferRes))
+	http.HandleFunc("/api/bill/transfer/add", AddHandler(billTransferRes))
+	http.HandleFunc("/api/bill/transfer/update", UpdateHandler(billTransferRes))
+	http.HandleFunc("/api/bill/transfer/delete", DeleteHandler(billTransferRes))
+
+	http.HandleFunc("/api/bill/rate/list", ListHandler(billRateRes))
+	http.HandleFunc("/api/bill/rate/add", AddHandler(billRateRes))
+	http.HandleFunc("/api/bill/rate/update", UpdateHandler(billRateRes))
+	http.HandleFunc("/api/bill/rate/delete", DeleteHandler(billRateRes))
+	http.HandleFunc("/api/bill/rate/import", ImportHandler(billRateRes))
+	http.HandleFunc("/api/bill/rate/import/preview", ImportPreviewHandler(billRateRes))
+
+	http.HandleFunc("/api/bill/person/list", ListHandler(billPersonRes))
+	http.HandleFunc("/api/bill/person/add", AddHandler(billPersonRes))
+	http.HandleFunc("/api/bill/person/update", UpdateHandler(billPersonRes))
+	http.HandleFunc("/api/bill/person/delete", DeleteHandler(billPersonRes))
+
+	http.HandleFunc("/api/bill/split/list", ListHandler(billSplitRes))
+	http.HandleFunc("/api/bill/split/add", AddHandler(billSplitRes))
+	http.HandleFunc("/api/bill/split/update", UpdateHandler(billSplitRes))
+	http.HandleFunc("/api/bill/split/delete", DeleteHandler(billSplitRes))
+	http.HandleFunc("/api/bill/split/settle", requireLogin(billSplitSettleAPI))
+	http.HandleFunc("/api/bill/split/balance", requireLogin(billSplitBalanceAPI))
 
 	http.HandleFunc("/api/interest/list", ListHandler(interestRes))
 	http.HandleFunc("/api/interest/add", AddHandler(interestRes))
@@ -74,6 +170,7 @@ func registerRoutes() {
 	http.HandleFunc("/api/interest/delete", DeleteHandler(interestRes))
 	http.HandleFunc("/api/interest/export", ExportHandler(interestRes))
 	http.HandleFunc("/api/interest/import", ImportHandler(interestRes))
+	http.HandleFunc("/api/interest/import/preview", ImportPreviewHandler(interestRes))
 
 	http.HandleFunc("/api/note/list", ListHandler(noteRes))
 	http.HandleFunc("/api/note/add", AddHandler(noteRes))
@@ -81,6 +178,17 @@ func registerRoutes() {
 	http.HandleFunc("/api/note/delete", DeleteHandler(noteRes))
 	http.HandleFunc("/api/note/export", ExportHandler(noteRes))
 	http.HandleFunc("/api/note/import", ImportHandler(noteRes))
+	http.HandleFunc("/api/note/import/preview", ImportPreviewHandler(noteRes))
+	http.HandleFunc("/api/note/subtask/list", ListHandler(noteSubtaskRes))
+	http.HandleFunc("/api/note/subtask/add", AddHandler(noteSubtaskRes))
+	http.HandleFunc("/api/note/subtask/update", UpdateByIDHandler(noteSubtaskRes))
+	http.HandleFunc("/api/note/subtask/delete", DeleteHandler(noteSubtaskRes))
+	http.HandleFunc("/api/note/column/list", ListHandler(noteColumnRes))
+	http.HandleFunc("/api/note/column/add", AddHandler(noteColumnRes))
+	http.HandleFunc("/api/note/column/update", UpdateByIDHandler(noteColumnRes))
+	http.HandleFunc("/api/note/column/delete", DeleteHandler(noteColumnRes))
+	http.HandleFunc("/api/note/board", requireLogin(noteBoardAPI))
+	http.HandleFunc("/api/note/move", requireLogin(noteMoveAPI))
 
 	http.HandleFunc("/api/sport/list", ListHandler(sportRes))
 	http.HandleFunc("/api/sport/add", AddHandler(sportRes))
@@ -88,6 +196,38 @@ func registerRoutes() {
 	http.HandleFunc("/api/sport/delete", DeleteHandler(sportRes))
 	http.HandleFunc("/api/sport/export", ExportHandler(sportRes))
 	http.HandleFunc("/api/sport/import", ImportHandler(sportRes))
+	http.HandleFunc("/api/sport/import/preview", ImportPreviewHandler(sportRes))
+	http.HandleFunc("/api/sport/import/track", requireLogin(sportTrackImportAPI(false)))
+	http.HandleFunc("/api/sport/import/track/preview", requireLogin(sportTrackImportAPI(true)))
+	http.HandleFunc("/api/sport/stats", requireLogin(sportStatsAPI))
+	http.HandleFunc("/api/sport/goal/list", ListHandler(sportGoalRes))
+	http.HandleFunc("/api/sport/goal/add", AddHandler(sportGoalRes))
+	http.HandleFunc("/api/sport/goal/update", UpdateHandler(sportGoalRes))
+	http.HandleFunc("/api/sport/goal/delete", DeleteHandler(sportGoalRes))
+	http.HandleFunc("/api/sport/plan/list", ListHandler(sportPlanRes))
+	http.HandleFunc("/api/sport/plan/add", AddHandler(sportPlanRes))
+	http.HandleFunc("/api/sport/plan/update", UpdateHandler(sportPlanRes))
+	http.HandleFunc("/api/sport/plan/delete", DeleteHandler(sportPlanRes))
+	http.HandleFunc("/api/sport/plan/templates", requireLogin(sportPlanTemplatesAPI))
+	http.HandleFunc("/api/sport/plan/match", requireLogin(sportPlanMatchAPI))
+	http.HandleFunc("/api/sport/plan/compliance", requireLogin(sportPlanComplianceAPI))
+	http.HandleFunc("/api/sport/plan/workout/list", ListHandler(sportWorkoutRes))
+	http.HandleFunc("/api/sport/plan/workout/add", AddHandler(sportWorkoutRes))
+	http.HandleFunc("/api/sport/plan/workout/update", UpdateHandler(sportWorkoutRes))
+	http.HandleFunc("/api/sport/plan/workout/delete", DeleteHandler(sportWorkoutRes))
+	http.HandleFunc("/api/sport/plan/workout/complete", requireLogin(sportWorkoutCompleteAPI))
+
+	http.HandleFunc("/api/habit/list", ListHandler(habitRes))
+	http.HandleFunc("/api/habit/add", AddHandler(habitRes))
+	http.HandleFunc("/api/habit/update", UpdateByIDHandler(habitRes))
+	http.HandleFunc("/api/habit/delete", DeleteHandler(habitRes))
+	http.HandleFunc("/api/habit/stats", requireLogin(habitStatsAPI))
+	http.HandleFunc("/api/habit/heatmap", requireLogin(habitHeatmapAPI))
+	http.HandleFunc("/api/habit/checkin", requireLogin(habitCheckinAPI))
+	http.HandleFunc("/api/habit/checkin/list", ListHandler(habitCheckinRes))
+	http.HandleFunc("/api/habit/checkin/add", AddHandler(habitCheckinRes))
+	http.HandleFunc("/api/habit/checkin/update", UpdateByIDHandler(habitCheckinRes))
+	http.HandleFunc("/api/habit/checkin/delete", DeleteHandler(habitCheckinRes))
 
 	http.HandleFunc("/static/js/conf.js", confJsHandler)
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
@@ -117,8 +257,11 @@ func render(w http.ResponseWriter, r *http.Request, tpl *template.Template, data
 }
 
 func respSheetHead(w http.ResponseWriter, filename string) {
-	w.Header().Set("Content-Type",
-		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	respFileHead(w, filename, db.FormatXLSX.ContentType())
+}
+
+func respFileHead(w http.ResponseWriter, filename, contentType string) {
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Disposition",
 		fmt.Sprintf(`attachment; filename="%s"`, filename))
 }
@@ -179,10 +322,18 @@ type CanExport interface {
 	Export(w io.Writer) error
 }
 
+type CanExportAs interface {
+	ExportAs(w io.Writer, format db.Format) error
+}
+
 type CanImport interface {
 	Import(r io.Reader) error
 }
 
+type CanImportWith interface {
+	ImportWith(r io.Reader, opts db.ImportOptions) (*db.ImportReport, error)
+}
+
 func PageHandler[T any](res Resource[T]) http.HandlerFunc {
 	return requireLogin(func(w http.ResponseWriter, r *http.Request) {
 		render(w, r, res.Tpl, nil)
@@ -336,9 +487,14 @@ func ExportHandler[T any](res Resource[T]) http.HandlerFunc {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		filename := fmt.Sprintf("%s_%s.xlsx", res.Name, utils.GetNowYYMMDD())
-		respSheetHead(w, filename)
+		format, err := db.ParseFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filename := fmt.Sprintf("%s_%s.%s", res.Name, utils.GetNowYYMMDD(), format)
 		if res.Export != nil {
+			respSheetHead(w, filename)
 			if err := res.Export(w); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -346,11 +502,19 @@ func ExportHandler[T any](res Resource[T]) http.HandlerFunc {
 			jsonOK(w)
 			return
 		}
+		if repo, ok := res.Repo.(CanExportAs); ok {
+			respFileHead(w, filename, format.ContentType())
+			if err := repo.ExportAs(w, format); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
 		repo, ok := res.Repo.(CanExport)
 		if !ok {
 			http.Error(w, "not supported", http.StatusNotImplemented)
 			return
 		}
+		respSheetHead(w, filename)
 		if err := repo.Export(w); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -358,13 +522,32 @@ func ExportHandler[T any](res Resource[T]) http.HandlerFunc {
 	})
 }
 
+func importOptions(r *http.Request, header *multipart.FileHeader, dryRun bool) (db.ImportOptions, error) {
+	strategy, err := db.ParseImportStrategy(r.FormValue("strategy"))
+	if err != nil {
+		return db.ImportOptions{}, err
+	}
+	format := db.DetectFormat(header.Header.Get("Content-Type"), header.Filename)
+	if f := r.FormValue("format"); f != "" {
+		if format, err = db.ParseFormat(f); err != nil {
+			return db.ImportOptions{}, err
+		}
+	}
+	return db.ImportOptions{
+		Format:      format,
+		Strategy:    strategy,
+		DryRun:      dryRun || r.FormValue("dry_run") == "1",
+		SkipInvalid: r.FormValue("skip_invalid") == "1",
+	}, nil
+}
+
 func ImportHandler[T any](res Resource[T]) http.HandlerFunc {
 	return requireLogin(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		file, _, err := r.FormFile("file")
+		file, header, err := r.FormFile("file")
 		if err != nil {
 			http.Error(w, "missing file", http.StatusBadRequest)
 			return
@@ -378,6 +561,24 @@ func ImportHandler[T any](res Resource[T]) http.HandlerFunc {
 			jsonOK(w)
 			return
 		}
+		if repo, ok := res.Repo.(CanImportWith); ok {
+			opts, err := importOptions(r, header, false)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			report, err := repo.ImportWith(file, opts)
+			if err != nil {
+				status := http.StatusInternalServerError
+				if report != nil && report.Invalid > 0 {
+					status = http.StatusBadRequest
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+			jsonRes(w, report)
+			return
+		}
 		repo, ok := res.Repo.(CanImport)
 		if !ok {
 			http.Error(w, "not supported", http.StatusNotImplemented)
@@ -391,6 +592,37 @@ func ImportHandler[T any](res Resource[T]) http.HandlerFunc {
 	})
 }
 
+func ImportPreviewHandler[T any](res Resource[T]) http.HandlerFunc {
+	return requireLogin(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "missing file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		repo, ok := res.Repo.(CanImportWith)
+		if !ok {
+			http.Error(w, "not supported", http.StatusNotImplemented)
+			return
+		}
+		opts, err := importOptions(r, header, true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report, err := repo.ImportWith(file, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jsonRes(w, report)
+	})
+}
+
 func RegisterDiaryResource(DB *db.DB) Resource[diary.Diary] {
 	repo := diary.NewRepository(DB)
 	return Resource[diary.Diary]{
@@ -417,10 +649,19 @@ func RegisterBillResource(DB *db.DB) Resource[bill.Bill] {
 		Tpl:  initTemplate("bill.html", "web/templates/bill.html", true),
 		Repo: repo,
 
+		// 附带按账单日期汇率换算的基准货币金额
 		List: func(r *http.Request) (any, error) {
 			start, _ := strconv.Atoi(r.URL.Query().Get("start"))
 			end, _ := strconv.Atoi(r.URL.Query().Get("end"))
-			return repo.GetBetweenDates(start, end, "DESC")
+			list, err := repo.GetBetweenDates(start, end, "DESC")
+			if err != nil {
+				return nil, err
+			}
+			conv, err := billConverter()
+			if err != nil {
+				return nil, err
+			}
+			return conv.ConvertBills(list), nil
 		},
 	}
 }
@@ -439,12 +680,32 @@ func RegisterInterestResource(DB *db.DB) Resource[interest.Interest] {
 	}
 }
 
+// RegisterNoteResource 任务列表可按 view（overdue/today/upcoming）和 status 筛选
 func RegisterNoteResource(DB *db.DB) Resource[note.Note] {
 	repo := note.NewRepository(DB)
 	return Resource[note.Note]{
 		Name: note.TABLE,
 		Tpl:  initTemplate("note.html", "web/templates/note.html", true),
 		Repo: repo,
+
+		List: func(r *http.Request) (any, error) {
+			q := r.URL.Query()
+			return repo.Filter(q.Get("view"), q.Get("status"), utils.GetCurrentDateInt())
+		},
+	}
+}
+
+// RegisterNoteSubtaskResource 子任务，list 需要 note 参数
+func RegisterNoteSubtaskResource(DB *db.DB) Resource[note.Subtask] {
+	repo := note.NewSubtaskRepository(DB)
+	return Resource[note.Subtask]{
+		Name: note.SubtaskTable,
+		Repo: repo,
+
+		List: func(r *http.Request) (any, error) {
+			id, _ := strconv.Atoi(r.URL.Query().Get("note"))
+			return repo.ByNote(id)
+		},
 	}
 }
 func RegisterSportResource(DB *db.DB) Resource[sport.Sport] {
@@ -477,6 +738,10 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	if ok {
 		setSession(w, password)
+		db.Key = password
+		if err := db.Get().EnsureKeyFingerprint(); err != nil {
+			fmt.Println("[login] key fingerprint:", err)
+		}
 
 		if redirect := getRedirectAfterLogin(r); redirect != "" {
 			clearRedirectAfterLogin(w)
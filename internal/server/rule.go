@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+)
+
+func RegisterBillRuleResource(DB *db.DB) Resource[bill.Rule] {
+	repo := bill.NewRuleRepository(DB)
+	return Resource[bill.Rule]{
+		Name: bill.RuleTable,
+		Repo: repo,
+	}
+}
+
+// billRuleApplyAPI 对日期范围内的账单重新应用分类规则
+func billRuleApplyAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Start     int  `json:"start"`
+		End       int  `json:"end"`
+		Overwrite bool `json:"overwrite"`
+		DryRun    bool `json:"dry_run"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.End == 0 {
+		req.End = 99991231
+	}
+	res, err := bill.NewRepository(db.Get()).ApplyRules(req.Start, req.End, req.Overwrite, req.DryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, res)
+}
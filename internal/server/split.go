@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/money"
+	"diarygo/internal/utils"
+)
+
+func RegisterBillPersonResource(DB *db.DB) Resource[bill.Person] {
+	repo := bill.NewPersonRepository(DB)
+	return Resource[bill.Person]{
+		Name: bill.PersonTable,
+		Repo: repo,
+	}
+}
+
+// RegisterBillSplitResource 分摊和份额作为一个整体读写
+func RegisterBillSplitResource(DB *db.DB) Resource[bill.SplitDetail] {
+	repo := bill.NewSplitRepository(DB)
+	return Resource[bill.SplitDetail]{
+		Name: bill.SplitTable,
+		Repo: repo,
+
+		List: func(r *http.Request) (any, error) {
+			start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+			end, _ := strconv.Atoi(r.URL.Query().Get("end"))
+			if end == 0 {
+				end = 99991231
+			}
+			return repo.Details(start, end)
+		},
+		Add:        repo.Add,
+		Update:     repo.Update,
+		DeleteByID: repo.DeleteByID,
+	}
+}
+
+// billSplitSettleAPI 记录一笔还款：source 还给 target
+func billSplitSettleAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Date     int          `json:"date"`
+		Source   int          `json:"source"`
+		Target   int          `json:"target"`
+		Amount   money.Amount `json:"amount"`
+		Currency string       `json:"currency"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Date == 0 {
+		req.Date = utils.GetCurrentDateInt()
+	}
+	split, err := bill.NewSplitRepository(db.Get()).Settle(req.Date, req.Source, req.Target, req.Amount, req.Currency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, split)
+}
+
+// billSplitBalanceAPI 返回每人的分摊净额和两两之间的欠款，金额为基准货币
+func billSplitBalanceAPI(w http.ResponseWriter, r *http.Request) {
+	conv, err := billConverter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report, err := bill.NewSplitRepository(db.Get()).Balances(conv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, report)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/statement"
+)
+
+func RegisterBillProfileResource(DB *db.DB) Resource[bill.Profile] {
+	repo := bill.NewProfileRepository(DB)
+	return Resource[bill.Profile]{
+		Name: bill.ProfileTable,
+		Repo: repo,
+	}
+}
+
+// statementImportAPI 导入银行对账单，preview 为 true 时只返回预览报告
+// CSV 需要 profile 参数指定列映射，QIF 可用 profile 指定日期格式，account 指定记入的账户
+func statementImportAPI(preview bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "missing file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		format := statement.DetectFormat(header.Filename, data)
+		if f := r.FormValue("format"); f != "" {
+			if format, err = statement.ParseFormat(f); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		var profile *bill.Profile
+		if id, _ := strconv.Atoi(r.FormValue("profile")); id > 0 {
+			if profile, err = bill.NewProfileRepository(db.Get()).GetByID(id); err != nil {
+				http.Error(w, "profile not found", http.StatusBadRequest)
+				return
+			}
+		}
+
+		list, errs, err := statement.Parse(format, data, profile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		account, _ := strconv.Atoi(r.FormValue("account"))
+		report, err := statement.Import(db.Get(), list, errs, account, db.ImportOptions{
+			DryRun:      preview || r.FormValue("dry_run") == "1",
+			SkipInvalid: r.FormValue("skip_invalid") == "1",
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jsonRes(w, report)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/sport"
+	"diarygo/internal/utils"
+)
+
+func RegisterSportGoalResource(DB *db.DB) Resource[sport.Goal] {
+	repo := sport.NewGoalRepository(DB)
+	return Resource[sport.Goal]{
+		Name: sport.GoalTable,
+		Repo: repo,
+	}
+}
+
+// sportStatsAPI 返回 [start, end]（默认今年 1 月 1 日到今天）的运动统计、连续天数、个人记录和本周目标
+func sportStatsAPI(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	today := utils.GetCurrentDateInt()
+	start, _ := strconv.Atoi(q.Get("start"))
+	end, _ := strconv.Atoi(q.Get("end"))
+	if end == 0 {
+		end = today
+	}
+	if start == 0 {
+		start = end/10000*10000 + 101
+	}
+	if !utils.IsValidDateInt(start) || !utils.IsValidDateInt(end) || start > end {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+	goals, err := sport.NewGoalRepository(db.Get()).List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats, err := sport.NewRepository(db.Get()).Stats(start, end, today, goals)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonRes(w, stats)
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+
+	"diarygo/internal/blob"
+	"diarygo/internal/db"
+	"diarygo/internal/track"
+)
+
+// sportTrackImportAPI 导入运动手表导出的 GPX、TCX 或 FIT 文件，preview 为 true 时只返回预览报告
+// activity 可指定运动类型，否则按文件中的类型
+func sportTrackImportAPI(preview bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name, data, ok := readUpload(w, r)
+		if !ok {
+			return
+		}
+		format, err := track.DetectFormat(name, data)
+		if f := r.FormValue("format"); f != "" {
+			format, err = track.ParseFormat(f)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		list, err := track.Parse(format, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dryRun := preview || r.FormValue("dry_run") == "1"
+		store := blob.Get()
+		if store == nil && !dryRun {
+			http.Error(w, "attachment storage is not configured", http.StatusInternalServerError)
+			return
+		}
+		report, err := track.Import(db.Get(), store, name, data, list, r.FormValue("activity"), dryRun)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jsonRes(w, report)
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"diarygo/internal/config"
+	"diarygo/internal/db"
+	"diarygo/internal/utils"
+	"diarygo/internal/vault"
+)
+
+func diaryMarkdownExportAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	layout := r.URL.Query().Get("layout")
+	if layout == "" {
+		layout = config.GetRepository().Get("markdown", "layout")
+	}
+	if err := vault.CheckLayout(layout); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respFileHead(w, fmt.Sprintf("diary_md_%s.zip", utils.GetNowYYMMDD()), "application/zip")
+	zw := zip.NewWriter(w)
+	_, err := vault.Export(db.Get(), layout, func(name string, data []byte) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	zw.Close()
+}
+
+func diaryMarkdownImportAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(header.Filename), ".md") {
+		// 单个 Markdown 文件
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := vault.ImportFile(db.Get(), header.Filename, data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jsonRes(w, map[string]any{"ok": true, "count": 1, "skipped": 0})
+		return
+	}
+
+	zr, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n, skipped, err := vault.Import(db.Get(), zr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonRes(w, map[string]any{"ok": true, "count": n, "skipped": skipped})
+}
@@ -0,0 +1,473 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/money"
+	"diarygo/internal/utils"
+)
+
+// Format 对账单格式
+type Format string
+
+const (
+	FormatOFX Format = "ofx" // 包括 QFX
+	FormatQIF Format = "qif"
+	FormatCSV Format = "csv"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case FormatOFX, "qfx":
+		return FormatOFX, nil
+	case FormatQIF:
+		return FormatQIF, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	}
+	return "", errors.New("unknown statement format: " + s)
+}
+
+// DetectFormat 根据文件名和内容判断格式
+func DetectFormat(filename string, data []byte) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ofx", ".qfx":
+		return FormatOFX
+	case ".qif":
+		return FormatQIF
+	case ".csv":
+		return FormatCSV
+	}
+	head := bytes.ToUpper(bytes.TrimSpace(data[:min(len(data), 512)]))
+	switch {
+	case bytes.HasPrefix(head, []byte("OFXHEADER")), bytes.Contains(head, []byte("<OFX>")):
+		return FormatOFX
+	case bytes.HasPrefix(head, []byte("!TYPE:")), bytes.HasPrefix(head, []byte("!ACCOUNT")):
+		return FormatQIF
+	}
+	return FormatCSV
+}
+
+// Parse 解析对账单为账单列表，CSV 需要提供列映射
+// 返回的每条账单对应一个交易，errs 中为无法解析的交易
+func Parse(format Format, data []byte, profile *bill.Profile) ([]*bill.Bill, []error, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	switch format {
+	case FormatOFX:
+		return parseOFX(data)
+	case FormatQIF:
+		dateFormat := ""
+		if profile != nil {
+			dateFormat = profile.Format
+		}
+		return parseQIF(data, dateFormat)
+	case FormatCSV:
+		if profile == nil {
+			return nil, nil, errors.New("csv statement requires a profile")
+		}
+		return parseCSV(data, profile)
+	}
+	return nil, nil, errors.New("unknown statement format: " + string(format))
+}
+
+// Import 解析后按日期+金额+项目去重写入，已存在的账单保留原有分类
+// account 不为 0 时所有账单记入该账户，否则已存在的账单保留原有账户
+func Import(d *db.DB, list []*bill.Bill, errs []error, account int, opts db.ImportOptions) (*db.ImportReport, error) {
+	repo := bill.NewRepository(d)
+	existing, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+	// 明确的规则优先于历史账单
+	if err := bill.NewRuleRepository(d).Categorize(list); err != nil {
+		return nil, err
+	}
+	cat := NewHistoryCategorizer(existing)
+	for _, b := range list {
+		if b.Type == "" {
+			cat.Categorize(b)
+		}
+	}
+
+	opts.Strategy = db.StrategyNaturalKey
+	// 对账单中的分类不覆盖已有账单的分类
+	// 文件中带币种时（如 OFX 的 CURDEF）才更新已有账单的币种
+	hasCurrency := false
+	for _, b := range list {
+		b.Account = account
+		hasCurrency = hasCurrency || b.Currency != ""
+	}
+	fields := []string{"date", "inout", "amount", "item"}
+	if account != 0 {
+		fields = append(fields, "account")
+	}
+	if hasCurrency {
+		fields = append(fields, "currency")
+	}
+	present := db.PresentFields[bill.Bill](fields...)
+	return repo.ImportItems(list, errs, present, 1, opts)
+}
+
+// HistoryCategorizer 按已有账单学习的规则分类：相同项目沿用最近一次的分类
+type HistoryCategorizer struct {
+	types map[string]string
+}
+
+func NewHistoryCategorizer(bills []*bill.Bill) *HistoryCategorizer {
+	c := &HistoryCategorizer{types: map[string]string{}}
+	latest := map[string]int{}
+	for _, b := range bills {
+		if b.Type == "" {
+			continue
+		}
+		k := normalizeItem(b.Item)
+		if k == "" {
+			continue
+		}
+		if b.Date >= latest[k] {
+			latest[k] = b.Date
+			c.types[k] = b.Type
+		}
+	}
+	return c
+}
+
+// Categorize 找到匹配的规则时设置分类并返回 true
+func (c *HistoryCategorizer) Categorize(b *bill.Bill) bool {
+	if t, ok := c.types[normalizeItem(b.Item)]; ok {
+		b.Type = t
+		return true
+	}
+	return false
+}
+
+// normalizeItem 忽略大小写、数字和标点，银行描述中常带有流水号或日期
+func normalizeItem(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+var ofxTxn = regexp.MustCompile(`(?is)<STMTTRN>(.*?)(?:</STMTTRN>|<STMTTRN>|</BANKTRANLIST>)`)
+var ofxField = regexp.MustCompile(`(?i)<([A-Z0-9.]+)>([^<\r\n]*)`)
+var ofxCurrency = regexp.MustCompile(`(?i)<CURDEF>\s*([A-Z]{3})`)
+
+// parseOFX 同时支持 SGML（OFX 1.x，无结束标签）和 XML（OFX 2.x）
+func parseOFX(data []byte) ([]*bill.Bill, []error, error) {
+	text := string(data)
+	matches := ofxTxn.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return nil, nil, errors.New("no transactions found in OFX")
+	}
+	currency := ""
+	if m := ofxCurrency.FindStringSubmatch(text); m != nil {
+		currency = strings.ToUpper(m[1])
+	}
+	var list []*bill.Bill
+	var errs []error
+	for _, m := range matches {
+		fields := map[string]string{}
+		for _, f := range ofxField.FindAllStringSubmatch(text[m[2]:m[3]], -1) {
+			fields[strings.ToUpper(f[1])] = strings.TrimSpace(unescapeOFX(f[2]))
+		}
+		b := &bill.Bill{Currency: currency}
+		var err error
+		if len(fields["DTPOSTED"]) < 8 {
+			err = fmt.Errorf("invalid DTPOSTED %q", fields["DTPOSTED"])
+		} else if b.Date, err = parseDate(fields["DTPOSTED"][:8], "YYYYMMDD"); err == nil {
+			err = setAmount(b, fields["TRNAMT"], bill.SignExpenseNegative)
+		}
+		b.Item = firstNonEmpty(fields["NAME"], fields["PAYEE"], fields["MEMO"])
+		if memo := fields["MEMO"]; memo != "" && memo != b.Item {
+			b.Item += " " + memo
+		}
+		list = append(list, b)
+		errs = append(errs, err)
+	}
+	return list, errs, nil
+}
+
+func unescapeOFX(s string) string {
+	return strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'").Replace(s)
+}
+
+// parseQIF 读取 D 日期、T/U 金额、P 收款方、M 备注、L 分类，^ 为一条结束
+func parseQIF(data []byte, dateFormat string) ([]*bill.Bill, []error, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	var list []*bill.Bill
+	var errs []error
+	fields := map[byte]string{}
+	flush := func() {
+		if len(fields) == 0 {
+			return
+		}
+		b := &bill.Bill{}
+		date, err := parseQIFDate(fields['D'], dateFormat)
+		b.Date = date
+		if err == nil {
+			err = setAmount(b, firstNonEmpty(fields['T'], fields['U']), bill.SignExpenseNegative)
+		}
+		b.Item = firstNonEmpty(fields['P'], fields['M'])
+		if memo := fields['M']; memo != "" && memo != b.Item {
+			b.Item += " " + memo
+		}
+		// 分类可能带有子类，如 Food:Groceries
+		b.Type, _, _ = strings.Cut(fields['L'], ":")
+		if strings.HasPrefix(b.Type, "[") {
+			// [账户名] 表示转账，不作为分类
+			b.Type = ""
+		}
+		list = append(list, b)
+		errs = append(errs, err)
+		clear(fields)
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" || line[0] == '!' {
+			continue
+		}
+		if line[0] == '^' {
+			flush()
+			continue
+		}
+		if _, ok := fields[line[0]]; !ok {
+			fields[line[0]] = strings.TrimSpace(line[1:])
+		}
+	}
+	flush()
+	if len(list) == 0 {
+		return nil, nil, errors.New("no transactions found in QIF")
+	}
+	return list, errs, nil
+}
+
+// parseQIFDate 默认按美式 M/D/Y 解析，'Y 或两位年份按 20xx 处理
+func parseQIFDate(s, format string) (int, error) {
+	if format != "" {
+		return parseDate(s, format)
+	}
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "'", "/"), " ", "")
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == '/' || r == '-' || r == '.' })
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid date %q", s)
+	}
+	n := make([]int, 3)
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, fmt.Errorf("invalid date %q", s)
+		}
+		n[i] = v
+	}
+	m, d, y := n[0], n[1], n[2]
+	if len(parts[0]) == 4 {
+		y, m, d = n[0], n[1], n[2]
+	} else if y < 100 {
+		y += 2000
+	}
+	date := utils.YMD2Int(y, m, d)
+	if !utils.IsValidDateInt(date) {
+		return 0, fmt.Errorf("invalid date %q", s)
+	}
+	return date, nil
+}
+
+func parseCSV(data []byte, p *bill.Profile) ([]*bill.Bill, []error, error) {
+	p.SetDefaults()
+	lines := bytes.SplitAfterN(data, []byte("\n"), p.Skip+1)
+	if len(lines) <= p.Skip {
+		return nil, nil, errors.New("empty statement")
+	}
+	cr := csv.NewReader(bytes.NewReader(lines[p.Skip]))
+	cr.Comma = []rune(p.Delimiter)[0]
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil, errors.New("empty statement")
+	}
+	headers := rows[0]
+	col := func(name string) ([]int, error) {
+		if name == "" {
+			return nil, nil
+		}
+		var idx []int
+		for _, n := range strings.Split(name, ",") {
+			i, err := columnIndex(headers, strings.TrimSpace(n))
+			if err != nil {
+				return nil, err
+			}
+			idx = append(idx, i)
+		}
+		return idx, nil
+	}
+	dateCol, err := col(p.Date)
+	if err != nil {
+		return nil, nil, err
+	}
+	amountCol, err := col(p.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	debitCol, err := col(p.Debit)
+	if err != nil {
+		return nil, nil, err
+	}
+	creditCol, err := col(p.Credit)
+	if err != nil {
+		return nil, nil, err
+	}
+	itemCol, err := col(p.Item)
+	if err != nil {
+		return nil, nil, err
+	}
+	typeCol, err := col(p.Type)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var list []*bill.Bill
+	var errs []error
+	for _, row := range rows[1:] {
+		if isBlank(row) {
+			continue
+		}
+		b := &bill.Bill{
+			Item: cell(row, itemCol, " "),
+			Type: cell(row, typeCol, " "),
+		}
+		date, err := parseDate(cell(row, dateCol, " "), p.Format)
+		b.Date = date
+		if err == nil {
+			switch {
+			case amountCol != nil:
+				err = setAmount(b, cell(row, amountCol, ""), p.Sign)
+			case cell(row, debitCol, "") != "":
+				err = setAmount(b, "-"+strings.TrimPrefix(cell(row, debitCol, ""), "-"), bill.SignExpenseNegative)
+			default:
+				err = setAmount(b, strings.TrimPrefix(cell(row, creditCol, ""), "-"), bill.SignExpenseNegative)
+			}
+		}
+		list = append(list, b)
+		errs = append(errs, err)
+	}
+	return list, errs, nil
+}
+
+// columnIndex 按表头名称（忽略大小写）或从 1 开始的列号查找列
+func columnIndex(headers []string, name string) (int, error) {
+	for i, h := range headers {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 1 && n <= len(headers) {
+		return n - 1, nil
+	}
+	return 0, fmt.Errorf("column %q not found", name)
+}
+
+func cell(row []string, cols []int, sep string) string {
+	var parts []string
+	for _, c := range cols {
+		if c < len(row) {
+			if v := strings.TrimSpace(row[c]); v != "" {
+				parts = append(parts, v)
+			}
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+func isBlank(row []string) bool {
+	for _, v := range row {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDate 按 YYYY、YY、MM、M、DD、D 组成的格式解析日期
+func parseDate(s, format string) (int, error) {
+	layout := strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "DD", "02", "M", "1", "D", "2").Replace(format)
+	s = strings.TrimSpace(s)
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		// 日期后面可能带有时间
+		if i := strings.IndexAny(s, " T"); i > 0 {
+			t, err = time.Parse(layout, s[:i])
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %q for format %s", s, format)
+	}
+	return utils.YMD2Int(t.Year(), int(t.Month()), t.Day()), nil
+}
+
+var amountNoise = regexp.MustCompile(`[^0-9.,()+-]`)
+
+// setAmount 解析金额并设置收支，金额统一存为正数
+func setAmount(b *bill.Bill, s, sign string) error {
+	raw := s
+	s = amountNoise.ReplaceAllString(s, "")
+	neg := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		neg = true
+		s = s[1 : len(s)-1]
+	}
+	// 1.234,56 这类欧洲写法
+	if strings.LastIndex(s, ",") > strings.LastIndex(s, ".") && len(s)-strings.LastIndex(s, ",") <= 3 {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	v, err := money.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid amount %q", raw)
+	}
+	if neg {
+		v = -v
+	}
+	expense := v < 0
+	if sign == bill.SignExpensePositive {
+		expense = v > 0
+	}
+	b.Inout = 1
+	if expense {
+		b.Inout = -1
+	}
+	if v < 0 {
+		v = -v
+	}
+	b.Amount = v
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,299 @@
+package track
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FIT 全局消息号和字段号，只解析导入需要的部分
+const (
+	fitMsgSession = 18
+	fitMsgRecord  = 20
+
+	fitTimestamp = 253
+
+	fitRecordLat      = 0
+	fitRecordLon      = 1
+	fitRecordAltitude = 2
+	fitRecordHR       = 3
+	fitRecordDistance = 5
+	fitRecordEnhAlt   = 78
+
+	fitSessionStart    = 2
+	fitSessionSport    = 5
+	fitSessionTimer    = 8
+	fitSessionDistance = 9
+	fitSessionCalories = 11
+	fitSessionAvgHR    = 16
+	fitSessionMaxHR    = 17
+	fitSessionAscent   = 22
+)
+
+// fitEpoch FIT 时间戳的起点 1989-12-31 00:00:00 UTC
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// fitSports FIT sport 枚举
+var fitSports = map[uint64]string{
+	1: "running", 2: "cycling", 5: "swimming", 11: "walking", 17: "hiking",
+	10: "training", 20: "strength", 43: "yoga",
+}
+
+var errFITTruncated = errors.New("fit file is truncated")
+
+type fitField struct {
+	num, size int
+	base      byte // 基本类型编号
+}
+
+type fitDef struct {
+	global    int
+	bigEndian bool
+	fields    []fitField
+	devSize   int // 开发者字段的总长度，直接跳过
+}
+
+// fitMessage 一条数据消息中解析出的整数字段，无效值已去掉
+type fitMessage struct {
+	global int
+	fields map[int]uint64
+	signed map[int]int64
+}
+
+// parseFIT 解析 FIT 活动文件，每个 session 为一次运动，记录点按时间归入 session
+func parseFIT(data []byte) ([]*Activity, error) {
+	msgs, err := decodeFIT(data)
+	if err != nil {
+		return nil, err
+	}
+	var points []Point
+	var list []*Activity
+	for _, m := range msgs {
+		switch m.global {
+		case fitMsgRecord:
+			p := Point{Time: fitTime(m.fields[fitTimestamp])}
+			lat, okLat := m.signed[fitRecordLat]
+			lon, okLon := m.signed[fitRecordLon]
+			if okLat && okLon {
+				p.Lat, p.Lon = semicircles(lat), semicircles(lon)
+			}
+			if v, ok := m.fields[fitRecordEnhAlt]; ok {
+				p.Ele, p.HasEle = float64(v)/5-500, true
+			} else if v, ok := m.fields[fitRecordAltitude]; ok {
+				p.Ele, p.HasEle = float64(v)/5-500, true
+			}
+			p.HeartRate = int(m.fields[fitRecordHR])
+			p.Distance = float64(m.fields[fitRecordDistance]) / 100
+			points = append(points, p)
+		case fitMsgSession:
+			a := &Activity{
+				Type:      fitSports[m.fields[fitSessionSport]],
+				Duration:  float64(m.fields[fitSessionTimer]) / 1000,
+				Distance:  float64(m.fields[fitSessionDistance]) / 100,
+				Calories:  int(m.fields[fitSessionCalories]),
+				HeartRate: int(m.fields[fitSessionAvgHR]),
+				MaxHeart:  int(m.fields[fitSessionMaxHR]),
+				Ascent:    float64(m.fields[fitSessionAscent]),
+			}
+			if v, ok := m.fields[fitSessionStart]; ok {
+				a.Start = fitTime(v)
+			}
+			list = append(list, a)
+		}
+	}
+	// 没有 session 的文件把全部记录点作为一次运动
+	if len(list) == 0 && len(points) > 0 {
+		list = append(list, &Activity{})
+	}
+	for i, a := range list {
+		var end time.Time
+		if i+1 < len(list) {
+			end = list[i+1].Start
+		}
+		for _, p := range points {
+			if len(list) == 1 || (!p.Time.Before(a.Start) && (end.IsZero() || p.Time.Before(end))) {
+				a.Points = append(a.Points, p)
+			}
+		}
+	}
+	return list, nil
+}
+
+// decodeFIT 按定义消息解码全部数据消息
+func decodeFIT(data []byte) ([]*fitMessage, error) {
+	if len(data) < 12 || string(data[8:12]) != ".FIT" {
+		return nil, errors.New("not a fit file")
+	}
+	headerSize := int(data[0])
+	if headerSize < 12 || headerSize > len(data) {
+		return nil, errors.New("invalid fit header")
+	}
+	end := headerSize + int(binary.LittleEndian.Uint32(data[4:8]))
+	if end+2 > len(data) {
+		return nil, errFITTruncated
+	}
+	// CRC 为 0 表示设备没有计算
+	if crc := binary.LittleEndian.Uint16(data[end:]); crc != 0 && crc != fitCRC(data[:end]) {
+		return nil, errors.New("fit file checksum mismatch")
+	}
+
+	defs := map[int]*fitDef{}
+	var msgs []*fitMessage
+	var lastTime uint64
+	pos := headerSize
+	for pos < end {
+		header := data[pos]
+		pos++
+		local := int(header & 0x0f)
+		var offset int64 = -1
+		switch {
+		case header&0x80 != 0:
+			// 压缩时间戳头：低 5 位为相对上一个时间戳的偏移
+			local = int(header>>5) & 0x03
+			offset = int64(header & 0x1f)
+		case header&0x40 != 0:
+			def, n, err := readFITDef(data[pos:end], header&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			defs[local] = def
+			pos += n
+			continue
+		}
+
+		def := defs[local]
+		if def == nil {
+			return nil, fmt.Errorf("fit data message without definition at byte %d", pos-1)
+		}
+		m := &fitMessage{global: def.global, fields: map[int]uint64{}, signed: map[int]int64{}}
+		for _, f := range def.fields {
+			if pos+f.size > end {
+				return nil, errFITTruncated
+			}
+			if v, ok := fitValue(data[pos:pos+f.size], f.base, def.bigEndian); ok {
+				m.fields[f.num] = v
+				m.signed[f.num] = signExtend(v, f.size)
+			}
+			pos += f.size
+		}
+		pos += def.devSize
+		if pos > end {
+			return nil, errFITTruncated
+		}
+		if t, ok := m.fields[fitTimestamp]; ok {
+			lastTime = t
+		} else if offset >= 0 {
+			t := lastTime&^0x1f | uint64(offset)
+			if t < lastTime {
+				t += 0x20
+			}
+			lastTime = t
+			m.fields[fitTimestamp] = t
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+// readFITDef 读取定义消息，返回定义和消息长度
+func readFITDef(b []byte, dev bool) (*fitDef, int, error) {
+	if len(b) < 5 {
+		return nil, 0, errFITTruncated
+	}
+	def := &fitDef{bigEndian: b[1] == 1}
+	if def.bigEndian {
+		def.global = int(binary.BigEndian.Uint16(b[2:4]))
+	} else {
+		def.global = int(binary.LittleEndian.Uint16(b[2:4]))
+	}
+	n := int(b[4])
+	pos := 5
+	if len(b) < pos+n*3 {
+		return nil, 0, errFITTruncated
+	}
+	for i := 0; i < n; i++ {
+		def.fields = append(def.fields, fitField{num: int(b[pos]), size: int(b[pos+1]), base: b[pos+2] & 0x1f})
+		pos += 3
+	}
+	if dev {
+		if len(b) < pos+1 {
+			return nil, 0, errFITTruncated
+		}
+		nd := int(b[pos])
+		pos++
+		if len(b) < pos+nd*3 {
+			return nil, 0, errFITTruncated
+		}
+		for i := 0; i < nd; i++ {
+			def.devSize += int(b[pos+1])
+			pos += 3
+		}
+	}
+	return def, pos, nil
+}
+
+// fitValue 读取 1、2、4、8 字节的整数，无效值返回 false
+// 其它长度的字段（字符串、数组）导入时用不到
+func fitValue(b []byte, base byte, bigEndian bool) (uint64, bool) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	var v, invalid uint64
+	switch len(b) {
+	case 1:
+		v, invalid = uint64(b[0]), 0xff
+	case 2:
+		v, invalid = uint64(order.Uint16(b)), 0xffff
+	case 4:
+		v, invalid = uint64(order.Uint32(b)), 0xffffffff
+	case 8:
+		v, invalid = order.Uint64(b), 0xffffffffffffffff
+	default:
+		return 0, false
+	}
+	switch base {
+	case 1, 3, 5, 14: // 有符号整数的无效值为最大正数
+		invalid >>= 1
+	case 10, 11, 12, 16: // 以 z 结尾的类型无效值为 0
+		invalid = 0
+	}
+	return v, v != invalid
+}
+
+func signExtend(v uint64, size int) int64 {
+	shift := uint(64 - size*8)
+	return int64(v<<shift) >> shift
+}
+
+func fitTime(v uint64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return fitEpoch.Add(time.Duration(v) * time.Second)
+}
+
+// semicircles FIT 的经纬度单位换算为度
+func semicircles(v int64) float64 {
+	return float64(v) * 180 / (1 << 31)
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// fitCRC FIT 规范中的 CRC-16
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xf]
+		crc = (crc >> 4) & 0x0fff
+		crc = crc ^ tmp ^ fitCRCTable[b&0xf]
+		tmp = fitCRCTable[crc&0xf]
+		crc = (crc >> 4) & 0x0fff
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xf]
+	}
+	return crc
+}
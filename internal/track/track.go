@@ -0,0 +1,351 @@
+package track
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"diarygo/internal/blob"
+	"diarygo/internal/db"
+	"diarygo/internal/entity/attachment"
+	"diarygo/internal/entity/sport"
+	"diarygo/internal/utils"
+)
+
+// Format 运动记录文件格式
+type Format string
+
+const (
+	FormatGPX Format = "gpx"
+	FormatTCX Format = "tcx"
+	FormatFIT Format = "fit"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case FormatGPX:
+		return FormatGPX, nil
+	case FormatTCX:
+		return FormatTCX, nil
+	case FormatFIT:
+		return FormatFIT, nil
+	}
+	return "", errors.New("unknown activity file format: " + s)
+}
+
+// DetectFormat 根据文件名和内容判断格式
+func DetectFormat(filename string, data []byte) (Format, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gpx":
+		return FormatGPX, nil
+	case ".tcx":
+		return FormatTCX, nil
+	case ".fit":
+		return FormatFIT, nil
+	}
+	if len(data) >= 12 && string(data[8:12]) == ".FIT" {
+		return FormatFIT, nil
+	}
+	head := data[:min(len(data), 1024)]
+	switch {
+	case bytes.Contains(head, []byte("<gpx")):
+		return FormatGPX, nil
+	case bytes.Contains(head, []byte("<TrainingCenterDatabase")):
+		return FormatTCX, nil
+	}
+	return "", errors.New("unrecognized activity file")
+}
+
+// Point 轨迹点，没有的数据为 0
+type Point struct {
+	Time      time.Time
+	Lat       float64
+	Lon       float64
+	Ele       float64
+	HasEle    bool
+	HeartRate int
+	Distance  float64 // 设备记录的累计距离，米
+}
+
+// Activity 文件中的一次运动，汇总数据优先使用设备记录的值，没有时由轨迹计算
+type Activity struct {
+	Type      string // 文件中的运动类型
+	Name      string
+	Start     time.Time
+	Duration  float64 // 秒
+	Distance  float64 // 米
+	Ascent    float64 // 米
+	Calories  int
+	HeartRate int
+	MaxHeart  int
+	Points    []Point
+}
+
+// Parse 解析文件中的全部运动
+func Parse(format Format, data []byte) ([]*Activity, error) {
+	var list []*Activity
+	var err error
+	switch format {
+	case FormatGPX:
+		list, err = parseGPX(data)
+	case FormatTCX:
+		list, err = parseTCX(data)
+	case FormatFIT:
+		list, err = parseFIT(data)
+	default:
+		return nil, errors.New("unknown activity file format: " + string(format))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("no activity in file")
+	}
+	for _, a := range list {
+		a.summarize()
+	}
+	return list, nil
+}
+
+// summarize 补全设备没有记录的汇总数据
+func (a *Activity) summarize() {
+	pts := a.Points
+	if len(pts) == 0 {
+		return
+	}
+	first, last := pts[0], pts[len(pts)-1]
+	if a.Start.IsZero() {
+		a.Start = first.Time
+	}
+	if a.Duration == 0 && !first.Time.IsZero() && !last.Time.IsZero() {
+		a.Duration = last.Time.Sub(first.Time).Seconds()
+	}
+	if a.Distance == 0 {
+		a.Distance = pathDistance(pts)
+	}
+	if a.Ascent == 0 {
+		a.Ascent = elevationGain(pts, 3)
+	}
+	if a.HeartRate == 0 || a.MaxHeart == 0 {
+		sum, n, max := 0, 0, 0
+		for _, p := range pts {
+			if p.HeartRate > 0 {
+				sum += p.HeartRate
+				n++
+				if p.HeartRate > max {
+					max = p.HeartRate
+				}
+			}
+		}
+		if a.HeartRate == 0 && n > 0 {
+			a.HeartRate = int(float64(sum)/float64(n) + 0.5)
+		}
+		if a.MaxHeart == 0 {
+			a.MaxHeart = max
+		}
+	}
+}
+
+// pathDistance 优先使用设备记录的累计距离，否则按经纬度计算
+func pathDistance(pts []Point) float64 {
+	if d := pts[len(pts)-1].Distance; d > 0 {
+		return d
+	}
+	total := 0.0
+	var prev *Point
+	for i := range pts {
+		p := &pts[i]
+		if p.Lat == 0 && p.Lon == 0 {
+			continue
+		}
+		if prev != nil {
+			total += haversine(prev.Lat, prev.Lon, p.Lat, p.Lon)
+		}
+		prev = p
+	}
+	return total
+}
+
+const earthRadius = 6371008.8
+
+// haversine 两点间的大圆距离，米
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(math.Min(1, h)))
+}
+
+// elevationGain 累计爬升，一段上坡至少 threshold 米才计入，过滤 GPS 高度的抖动
+func elevationGain(pts []Point, threshold float64) float64 {
+	gain := 0.0
+	low, high, ok := 0.0, 0.0, false
+	for _, p := range pts {
+		if !p.HasEle {
+			continue
+		}
+		switch {
+		case !ok:
+			low, high, ok = p.Ele, p.Ele, true
+		case p.Ele > high:
+			high = p.Ele
+		case high-p.Ele >= threshold:
+			// 确认开始下坡，结算这一段上坡
+			if high-low >= threshold {
+				gain += high - low
+			}
+			low, high = p.Ele, p.Ele
+		case p.Ele < low:
+			low = p.Ele
+		}
+	}
+	if high-low >= threshold {
+		gain += high - low
+	}
+	return gain
+}
+
+// mapActivity 把文件中的运动类型对应到 sport 的类型
+func mapActivity(s string) string {
+	s = strings.ToLower(s)
+	switch {
+	case strings.Contains(s, "run"):
+		return sport.ActivityRun
+	case strings.Contains(s, "bik"), strings.Contains(s, "cycl"), strings.Contains(s, "ride"):
+		return sport.ActivityCycle
+	case strings.Contains(s, "hik"):
+		return sport.ActivityHike
+	case strings.Contains(s, "walk"):
+		return sport.ActivityWalk
+	case strings.Contains(s, "swim"):
+		return sport.ActivitySwim
+	case strings.Contains(s, "yoga"):
+		return sport.ActivityYoga
+	case strings.Contains(s, "strength"), strings.Contains(s, "weight"):
+		return sport.ActivityStrength
+	}
+	return sport.ActivityOther
+}
+
+// Sport 生成运动记录，activity 非空时覆盖文件中的运动类型
+func (a *Activity) Sport(activity string) *sport.Sport {
+	if activity == "" {
+		activity = mapActivity(a.Type)
+	}
+	s := &sport.Sport{
+		Notes:     a.Name,
+		Activity:  activity,
+		Duration:  int(a.Duration + 0.5),
+		Distance:  int(a.Distance + 0.5),
+		Calories:  a.Calories,
+		HeartRate: a.HeartRate,
+		MaxHeart:  a.MaxHeart,
+		Ascent:    int(a.Ascent + 0.5),
+	}
+	if !a.Start.IsZero() {
+		local := a.Start.Local()
+		s.Date = utils.YMD2Int(local.Year(), int(local.Month()), local.Day())
+		s.Start = int(a.Start.Unix())
+	}
+	s.SetDefaults()
+	return s
+}
+
+// DuplicateWindow 开始时间相差不超过该秒数的运动视为同一次
+const DuplicateWindow = 60
+
+// Import 把文件中的运动导入为运动记录，原文件作为附件挂在每条新记录上
+// 开始时间与已有记录相同、或同一文件已导入过的运动跳过，activity 非空时覆盖运动类型
+func Import(d *db.DB, store *blob.Store, filename string, data []byte, list []*Activity, activity string, dryRun bool) (*db.ImportReport, error) {
+	if activity != "" && !sport.ValidActivity(activity) {
+		return nil, fmt.Errorf("invalid activity %q", activity)
+	}
+	repo := sport.NewRepository(d)
+	attachments := attachment.NewRepository(d, store)
+	imported, err := attachments.GetList("WHERE module = ? AND hash = ?", sport.TABLE, blob.Hash(data))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &db.ImportReport{Strategy: db.StrategySkip, DryRun: dryRun, Rows: []db.ImportRow{}}
+	var toAdd []*sport.Sport
+	var pos []int // toAdd 中每条记录在 report.Rows 中的位置
+	for i, a := range list {
+		s := a.Sport(activity)
+		row := db.ImportRow{Row: i + 1, Data: s}
+		if err := s.Validate(); err != nil {
+			row.Status, row.Reason = db.RowInvalid, err.Error()
+			report.Add(row)
+			continue
+		}
+		var dup *sport.Sport
+		if s.Start != 0 {
+			if dup, err = repo.FindStart(s.Start, DuplicateWindow); err != nil {
+				return nil, err
+			}
+			if dup == nil && pendingStart(toAdd, s.Start) {
+				row.Status, row.Reason = db.RowUnchanged, "duplicate in file"
+				report.Add(row)
+				continue
+			}
+		} else if len(imported) > 0 {
+			// 没有时间的轨迹只能按文件识别
+			dup, err = repo.GetByID(imported[0].Record)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if dup != nil {
+			row.Status, row.ID, row.Reason = db.RowUnchanged, dup.ID, "already imported"
+			report.Add(row)
+			continue
+		}
+		row.Status = db.RowNew
+		toAdd = append(toAdd, s)
+		pos = append(pos, len(report.Rows))
+		report.Add(row)
+	}
+	if dryRun || len(toAdd) == 0 {
+		return report, nil
+	}
+
+	if err := db.Snapshot("import_" + sport.TABLE); err != nil {
+		return nil, err
+	}
+	// 记录和附件在同一个事务中写入，没有附件的记录会在下次导入时重复
+	err = attachments.AddWith(sport.TABLE, filename, data, func(tx *sql.Tx) ([]int, error) {
+		ids := make([]int, len(toAdd))
+		for i, s := range toAdd {
+			id, err := db.InsertTx(tx, sport.TABLE, s)
+			if err != nil {
+				return nil, err
+			}
+			s.ID, ids[i] = id, id
+		}
+		return ids, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range pos {
+		report.Rows[p].ID = toAdd[i].ID
+	}
+	return report, nil
+}
+
+// pendingStart 本次要导入的记录中是否已有开始时间相近的运动
+func pendingStart(list []*sport.Sport, start int) bool {
+	for _, s := range list {
+		if s.Start != 0 && s.Start >= start-DuplicateWindow && s.Start <= start+DuplicateWindow {
+			return true
+		}
+	}
+	return false
+}
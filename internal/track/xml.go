@@ -0,0 +1,129 @@
+package track
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+)
+
+// GPX 1.1，心率在 Garmin 的 TrackPointExtension 中
+type gpxFile struct {
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []struct {
+				Lat  float64  `xml:"lat,attr"`
+				Lon  float64  `xml:"lon,attr"`
+				Ele  *float64 `xml:"ele"`
+				Time string   `xml:"time"`
+				HR   int      `xml:"extensions>TrackPointExtension>hr"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// parseGPX 每个 trk 为一次运动
+func parseGPX(data []byte) ([]*Activity, error) {
+	var f gpxFile
+	if err := decodeXML(data, &f); err != nil {
+		return nil, err
+	}
+	var list []*Activity
+	for _, t := range f.Tracks {
+		a := &Activity{Type: t.Type, Name: strings.TrimSpace(t.Name)}
+		for _, seg := range t.Segments {
+			for _, p := range seg.Points {
+				pt := Point{Lat: p.Lat, Lon: p.Lon, HeartRate: p.HR, Time: parseTime(p.Time)}
+				if p.Ele != nil {
+					pt.Ele, pt.HasEle = *p.Ele, true
+				}
+				a.Points = append(a.Points, pt)
+			}
+		}
+		if len(a.Points) > 0 {
+			list = append(list, a)
+		}
+	}
+	return list, nil
+}
+
+// TCX，运动由若干圈组成，汇总数据按圈累加
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		ID    string `xml:"Id"`
+		Notes string `xml:"Notes"`
+		Laps  []struct {
+			StartTime string  `xml:"StartTime,attr"`
+			Time      float64 `xml:"TotalTimeSeconds"`
+			Distance  float64 `xml:"DistanceMeters"`
+			Calories  int     `xml:"Calories"`
+			AvgHR     int     `xml:"AverageHeartRateBpm>Value"`
+			MaxHR     int     `xml:"MaximumHeartRateBpm>Value"`
+			Points    []struct {
+				Time     string   `xml:"Time"`
+				Lat      float64  `xml:"Position>LatitudeDegrees"`
+				Lon      float64  `xml:"Position>LongitudeDegrees"`
+				Ele      *float64 `xml:"AltitudeMeters"`
+				Distance float64  `xml:"DistanceMeters"`
+				HR       int      `xml:"HeartRateBpm>Value"`
+			} `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+func parseTCX(data []byte) ([]*Activity, error) {
+	var f tcxFile
+	if err := decodeXML(data, &f); err != nil {
+		return nil, err
+	}
+	var list []*Activity
+	for _, act := range f.Activities {
+		a := &Activity{Type: act.Sport, Name: strings.TrimSpace(act.Notes), Start: parseTime(act.ID)}
+		hrTime := 0.0
+		for _, lap := range act.Laps {
+			if a.Start.IsZero() {
+				a.Start = parseTime(lap.StartTime)
+			}
+			a.Duration += lap.Time
+			a.Distance += lap.Distance
+			a.Calories += lap.Calories
+			if lap.AvgHR > 0 {
+				// 平均心率按每圈时长加权
+				a.HeartRate = int((float64(a.HeartRate)*hrTime+float64(lap.AvgHR)*lap.Time)/(hrTime+lap.Time) + 0.5)
+				hrTime += lap.Time
+			}
+			a.MaxHeart = max(a.MaxHeart, lap.MaxHR)
+			for _, p := range lap.Points {
+				pt := Point{Lat: p.Lat, Lon: p.Lon, HeartRate: p.HR, Distance: p.Distance, Time: parseTime(p.Time)}
+				if p.Ele != nil {
+					pt.Ele, pt.HasEle = *p.Ele, true
+				}
+				a.Points = append(a.Points, pt)
+			}
+		}
+		if len(act.Laps) > 0 || len(a.Points) > 0 {
+			list = append(list, a)
+		}
+	}
+	return list, nil
+}
+
+func decodeXML(data []byte, v any) error {
+	dec := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	// 部分设备导出的文件声明了非 UTF-8 编码，内容实际只有 ASCII
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	return dec.Decode(v)
+}
+
+// parseTime 解析 RFC 3339 时间，失败时为零值
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
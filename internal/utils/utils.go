@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -23,6 +24,77 @@ func Date2Int(t time.Time) int {
 	return YMD2Int(year, month, day)
 }
 
+// Int2Date YYYYMMDD 转为当天零点
+func Int2Date(d int) time.Time {
+	return time.Date(d/10000, time.Month(d/100%100), d%100, 0, 0, 0, 0, time.Local)
+}
+
+// IsValidDateInt 判断 YYYYMMDD 形式的整数是否为有效日期
+func IsValidDateInt(d int) bool {
+	y, m, day := d/10000, d/100%100, d%100
+	if y < 1 || m < 1 || m > 12 || day < 1 {
+		return false
+	}
+	t := time.Date(y, time.Month(m), day, 0, 0, 0, 0, time.Local)
+	return t.Day() == day
+}
+
+// Monday t 所在周的周一零点
+func Monday(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, time.Local)
+}
+
+// ISOWeek 返回 ISO 周（YYYYWW）和该周的周一
+func ISOWeek(t time.Time) (int, time.Time) {
+	y, w := t.ISOWeek()
+	return y*100 + w, Monday(t)
+}
+
+// PeriodUnit 统计周期的划分方式
+type PeriodUnit struct {
+	Of   func(t time.Time) (int, time.Time) // t 所在周期的编号和第一天
+	Next func(first time.Time) time.Time    // 下一个周期的第一天
+}
+
+// 按年（YYYY）、月（YYYYMM）和 ISO 周（YYYYWW）划分
+var (
+	PeriodYear = PeriodUnit{
+		Of: func(t time.Time) (int, time.Time) {
+			return t.Year(), time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.Local)
+		},
+		Next: func(t time.Time) time.Time { return t.AddDate(1, 0, 0) },
+	}
+	PeriodMonth = PeriodUnit{
+		Of: func(t time.Time) (int, time.Time) {
+			return t.Year()*100 + int(t.Month()), time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+		},
+		Next: func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+	}
+	PeriodWeek = PeriodUnit{
+		Of:   ISOWeek,
+		Next: func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+	}
+)
+
+// Period 一个统计周期，Start 为第一天（YYYYMMDD）
+type Period struct {
+	Key   int
+	Start int
+}
+
+// Periods 覆盖 [from, to] 的所有周期，按时间顺序
+func Periods(from, to time.Time, unit PeriodUnit) []Period {
+	var list []Period
+	_, t := unit.Of(from)
+	for !t.After(to) {
+		key, first := unit.Of(t)
+		list = append(list, Period{Key: key, Start: Date2Int(first)})
+		t = unit.Next(first)
+	}
+	return list
+}
+
 func GetCurrentDateInt() int {
 	return Date2Int(time.Now())
 }
@@ -93,6 +165,23 @@ func ConvertByStruct[T any](params map[string]any) (map[string]any, error) {
 	return out, nil
 }
 
+// ApplyParams 把按字段名或 json 标签给出的参数写入 obj，不存在的字段和 id 忽略
+func ApplyParams[T any](obj *T, params map[string]any) error {
+	converted, err := ConvertByStruct[T](params)
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(obj).Elem()
+	for key, val := range converted {
+		f, _ := findStructField(v.Type(), key)
+		if val == nil || strings.EqualFold(f.Name, "id") {
+			continue
+		}
+		v.FieldByIndex(f.Index).Set(reflect.ValueOf(val))
+	}
+	return nil
+}
+
 func findStructField(t reflect.Type, name string) (reflect.StructField, bool) {
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
@@ -122,7 +211,24 @@ func convertValue(v any, t reflect.Type) (any, error) {
 		return v, nil
 	}
 
+	// 自定义类型（如金额）按其 JSON 解码规则转换
+	ptr := reflect.New(t)
+	if u, ok := ptr.Interface().(json.Unmarshaler); ok {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := u.UnmarshalJSON(data); err != nil {
+			return nil, err
+		}
+		return ptr.Elem().Interface(), nil
+	}
+
 	s := fmt.Sprint(v)
+	// JSON 中的数字解码为 float64，较大的整数会被格式化成 2.0260101e+07
+	if f, ok := v.(float64); ok {
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
 
 	switch t.Kind() {
 	case reflect.String:
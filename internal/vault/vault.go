@@ -0,0 +1,312 @@
+package vault
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"diarygo/internal/db"
+	"diarygo/internal/entity/bill"
+	"diarygo/internal/entity/diary"
+	"diarygo/internal/entity/sport"
+	"diarygo/internal/utils"
+)
+
+// DefaultLayout 默认目录结构，YYYY/MM/DD 会替换为日期
+const DefaultLayout = "YYYY/MM/YYYY-MM-DD.md"
+
+// WriteFunc 写出一个文件，name 为 vault 内的相对路径
+type WriteFunc func(name string, data []byte) error
+
+// FilePath 按布局生成某天的文件路径，布局只能是 vault 内的相对路径
+func FilePath(layout string, date int) (string, error) {
+	if layout == "" {
+		layout = DefaultLayout
+	}
+	r := strings.NewReplacer(
+		"YYYY", fmt.Sprintf("%04d", date/10000),
+		"MM", fmt.Sprintf("%02d", date/100%100),
+		"DD", fmt.Sprintf("%02d", date%100),
+	)
+	name := strings.ReplaceAll(r.Replace(layout), "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", fmt.Errorf("invalid layout %q: must be a relative path", layout)
+	}
+	var parts []string
+	for _, seg := range strings.Split(name, "/") {
+		seg = strings.TrimSpace(seg)
+		switch seg {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("invalid layout %q: must not contain ..", layout)
+		}
+		parts = append(parts, seg)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("invalid layout %q", layout)
+	}
+	name = strings.Join(parts, "/")
+	if !strings.HasSuffix(name, ".md") {
+		name += ".md"
+	}
+	return name, nil
+}
+
+// CheckLayout 校验布局，开始写出文件前调用
+func CheckLayout(layout string) error {
+	_, err := FilePath(layout, utils.GetCurrentDateInt())
+	return err
+}
+
+// Export 每天的日记写成一个 Markdown 文件，front matter 中附带当天的账单和运动
+func Export(d *db.DB, layout string, write WriteFunc) (int, error) {
+	if err := CheckLayout(layout); err != nil {
+		return 0, err
+	}
+	diaries, err := diary.NewRepository(d).GetList("ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+	bills, err := bill.NewRepository(d).GetList("ORDER BY date, id")
+	if err != nil {
+		return 0, err
+	}
+	sports, err := sport.NewRepository(d).GetList("ORDER BY date, id")
+	if err != nil {
+		return 0, err
+	}
+
+	billsByDate := map[int][]*bill.Bill{}
+	for _, b := range bills {
+		billsByDate[b.Date] = append(billsByDate[b.Date], b)
+	}
+	sportsByDate := map[int][]*sport.Sport{}
+	for _, s := range sports {
+		sportsByDate[s.Date] = append(sportsByDate[s.Date], s)
+	}
+
+	for _, dy := range diaries {
+		name, err := FilePath(layout, dy.ID)
+		if err != nil {
+			return 0, err
+		}
+		data := Render(dy, billsByDate[dy.ID], sportsByDate[dy.ID])
+		if err := write(name, data); err != nil {
+			return 0, err
+		}
+	}
+	return len(diaries), nil
+}
+
+// Render 生成单天的 Markdown
+func Render(dy *diary.Diary, bills []*bill.Bill, sports []*sport.Sport) []byte {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "date: %s\n", isoDate(dy.ID))
+	fmt.Fprintf(&b, "weather: %s\n", quote(dy.Weather))
+	fmt.Fprintf(&b, "location: %s\n", quote(dy.Location))
+	if len(bills) > 0 {
+		b.WriteString("bills:\n")
+		for _, bl := range bills {
+			fmt.Fprintf(&b, "  - id: %d\n", bl.ID)
+			fmt.Fprintf(&b, "    inout: %d\n", bl.Inout)
+			fmt.Fprintf(&b, "    type: %s\n", quote(bl.Type))
+			fmt.Fprintf(&b, "    amount: %s\n", bl.Amount)
+			fmt.Fprintf(&b, "    item: %s\n", quote(bl.Item))
+		}
+	}
+	if len(sports) > 0 {
+		b.WriteString("sport:\n")
+		for _, s := range sports {
+			fmt.Fprintf(&b, "  - id: %d\n", s.ID)
+			fmt.Fprintf(&b, "    activity: %s\n", s.Activity)
+			for _, f := range []struct {
+				name  string
+				value int
+			}{
+				{"duration", s.Duration}, {"distance", s.Distance}, {"calories", s.Calories},
+				{"ascent", s.Ascent}, {"heart_rate", s.HeartRate}, {"max_heart", s.MaxHeart},
+				{"sets", s.Sets}, {"reps", s.Reps},
+			} {
+				if f.value != 0 {
+					fmt.Fprintf(&b, "    %s: %d\n", f.name, f.value)
+				}
+			}
+			if s.Exercise != "" {
+				fmt.Fprintf(&b, "    exercise: %s\n", quote(s.Exercise))
+			}
+			if s.Weight != 0 {
+				fmt.Fprintf(&b, "    weight: %g\n", s.Weight)
+			}
+			if s.Notes != "" {
+				fmt.Fprintf(&b, "    notes: %s\n", quote(s.Notes))
+			}
+		}
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(dy.Content)
+	if !strings.HasSuffix(dy.Content, "\n") {
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+var fileDate = regexp.MustCompile(`(\d{4})-(\d{2})-(\d{2})`)
+
+// ErrNoDate 文件中找不到日期，通常是 vault 中的其它笔记
+var ErrNoDate = errors.New("missing date")
+
+// Parse 读取单个 Markdown 文件，日期取 front matter 的 date，没有时取文件名
+// 账单和运动只作为链接展示，导入时忽略
+func Parse(name string, data []byte) (*diary.Diary, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimPrefix(text, "\ufeff")
+
+	meta := map[string]string{}
+	if strings.HasPrefix(text, "---\n") {
+		end := strings.Index(text[4:], "\n---")
+		if end < 0 {
+			return nil, errors.New("unterminated front matter")
+		}
+		meta = parseFrontMatter(text[4 : 4+end])
+		text = text[4+end+len("\n---"):]
+		text = strings.TrimPrefix(text, "\n")
+	}
+
+	dateStr := meta["date"]
+	if dateStr == "" {
+		dateStr = fileDate.FindString(path.Base(name))
+	}
+	date, err := parseISODate(dateStr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return &diary.Diary{
+		ID:       date,
+		Content:  strings.TrimRight(strings.TrimPrefix(text, "\n"), "\n"),
+		Weather:  meta["weather"],
+		Location: meta["location"],
+	}, nil
+}
+
+// Import 读取 vault 中所有 .md 文件并写入日记，返回导入数和跳过的无日期文件数
+func Import(d *db.DB, fsys fs.FS) (int, int, error) {
+	var list []*diary.Diary
+	skipped := 0
+	err := fs.WalkDir(fsys, ".", func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			// 跳过 .obsidian 等隐藏目录
+			if p != "." && strings.HasPrefix(e.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(strings.ToLower(p), ".md") {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		dy, err := Parse(p, data)
+		if errors.Is(err, ErrNoDate) {
+			skipped++
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		list = append(list, dy)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(list), skipped, save(d, list)
+}
+
+// ImportFile 导入单个 Markdown 文件
+func ImportFile(d *db.DB, name string, data []byte) error {
+	dy, err := Parse(name, data)
+	if err != nil {
+		return err
+	}
+	return save(d, []*diary.Diary{dy})
+}
+
+func save(d *db.DB, list []*diary.Diary) error {
+	if len(list) == 0 {
+		return nil
+	}
+	if err := db.Snapshot("import_markdown"); err != nil {
+		return err
+	}
+	return diary.NewRepository(d).UpsertMany(list)
+}
+
+// parseFrontMatter 只读取顶层的 key: value，列表和嵌套内容忽略
+func parseFrontMatter(s string) map[string]string {
+	meta := map[string]string{}
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '-' || line[0] == '#' {
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		meta[strings.TrimSpace(k)] = unquote(strings.TrimSpace(v))
+	}
+	return meta
+}
+
+// quote 输出 YAML 双引号字符串（JSON 字符串同样是合法的 YAML）
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func unquote(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		var out string
+		if err := json.Unmarshal([]byte(s), &out); err == nil {
+			return out
+		}
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+func isoDate(d int) string {
+	return fmt.Sprintf("%04d-%02d-%02d", d/10000, d/100%100, d%100)
+}
+
+func parseISODate(s string) (int, error) {
+	m := fileDate.FindStringSubmatch(s)
+	if m == nil {
+		return 0, ErrNoDate
+	}
+	y, _ := strconv.Atoi(m[1])
+	mo, _ := strconv.Atoi(m[2])
+	dd, _ := strconv.Atoi(m[3])
+	date := utils.YMD2Int(y, mo, dd)
+	if !utils.IsValidDateInt(date) {
+		return 0, fmt.Errorf("invalid date %s", s)
+	}
+	return date, nil
+}
@@ -4,6 +4,7 @@ let currentFilter = "";
 let selectedId = null;
 let state = loadAppState("bill");
 let sortState = { key: null, order: null };
+let accounts = [];
 
 
 function applyState() {
@@ -39,6 +40,40 @@ function loadBills() {
     list = data;
     updateView();
   });
+  loadBudgetWarnings();
+}
+
+function loadAccounts() {
+  API.get('/api/bill/account/list', data => {
+    accounts = data || [];
+    updateView();
+  });
+}
+
+function accountOptions(selected) {
+  let html = `<option value="0" ${selected === 0 ? "selected" : ""}>-</option>`;
+  accounts.forEach(a => {
+    if (a.closed && a.id !== selected) return;
+    html += `<option value="${a.id}" ${a.id === selected ? "selected" : ""}>${a.name}</option>`;
+  });
+  return html;
+}
+
+function loadBudgetWarnings() {
+  const month = $('#month-picker').val();
+  if (!month) return;
+  API.get(`/api/bill/budget?month=${month.replace('-', '')}`, data => {
+    const box = $('#budget-warnings');
+    box.empty();
+    (data.warnings || []).forEach(w => {
+      const cls = w.status === "over" ? "text-danger" : "text-warning";
+      const label = w.status === "over" ? I18N["Over budget"] : I18N["Budget"];
+      box.append($('<span>').addClass(cls).text(
+        `${label} ${w.type}: ${w.spent.toFixed(2)} / ${w.available.toFixed(2)} (${Math.round(w.percent)}%)`
+      ));
+    });
+    box.prop('hidden', box.children().length === 0);
+  });
 }
 
 function applyFilter() {
@@ -68,7 +103,7 @@ function applyFilter() {
       bill.inout < 0 ? I18N["Out"] : "";
 
     const searchable = (String(bill.date) + bill.type + bill.item +
-      String(bill.amount) + inoutText).toLowerCase();
+      String(bill.amount) + bill.currency + inoutText).toLowerCase();
 
     return searchable.includes(f);
     //return (
@@ -94,7 +129,13 @@ function renderTable() {
           </td>
           <td contenteditable="true" data-field="type" data-type="string" class="td-center">${bill.type}</td>
           <td contenteditable="true" data-field="amount" data-type="float" class="td-center">${bill.amount}</td>
+          <td contenteditable="true" data-field="currency" data-type="string" class="td-center">${bill.currency}</td>
           <td contenteditable="true" data-field="item" data-type="string" class="td-left">${bill.item}</td>
+          <td>
+            <select class="form-select form-select-sm account-select" data-field="account" data-type="int">
+              ${accountOptions(bill.account)}
+            </select>
+          </td>
         </tr>
       `);
     if (bill.id == selectedId) { tr.addClass("table-active"); }
@@ -108,20 +149,21 @@ function updateTotal() {
   let totalIn = 0;
   let totalOut = 0;
 
+  // 合计使用服务端换算的基准货币金额，按分累加避免浮点误差
   filtered.forEach(bill => {
-    const amount = Number(bill.amount);
+    const cents = Math.round(Number(bill.currency ? bill.base : bill.amount) * 100);
     if (bill.inout > 0) {
-      total += amount;
-      totalIn += amount;
+      total += cents;
+      totalIn += cents;
     } else {
-      total -= amount;
-      totalOut += amount;
+      total -= cents;
+      totalOut += cents;
     }
   });
 
-  $("#total").text(total.toFixed(2));
-  $("#total-in").text(totalIn.toFixed(2));
-  $("#total-out").text(totalOut.toFixed(2));
+  $("#total").text((total / 100).toFixed(2));
+  $("#total-in").text((totalIn / 100).toFixed(2));
+  $("#total-out").text((totalOut / 100).toFixed(2));
 }
 
 function updateView() {
@@ -173,9 +215,21 @@ $("#bill-table tbody").on("click", "tr", function () {
 const updater = createPatchSaver({
   getEntity: id => list.find(o => o.id === id),
   save: (id, patch, done) => {
+    const bill = list.find(o => o.id === id);
+    const oldAmount = bill ? Number(bill.amount) : 0;
     API.post('/api/bill/update', { ...patch, id }, () => {
       done();
+      // 外币账单的币种或日期变化后需要服务端重新换算
+      if (bill && bill.currency && ('currency' in patch || 'date' in patch)) {
+        loadBills();
+        return;
+      }
+      if (bill && 'amount' in patch) {
+        const scaled = oldAmount ? bill.base * Number(bill.amount) / oldAmount : Number(bill.amount);
+        bill.base = Math.round(scaled * 100) / 100;
+      }
       updateTotal();
+      loadBudgetWarnings();
     });
   }
 });
@@ -192,7 +246,7 @@ bindIMEAutoSave({
 });
 
 $("#bill-table tbody")
-  .on("change", ".inout-select", function () {
+  .on("change", ".inout-select, .account-select", function () {
     handleBillUpdate(this);
   });
 
@@ -228,6 +282,7 @@ $('#btn-export').click(() => {
 applyNavConfig();
 initTable("bill-table", sortState, "all");
 applyState();
+loadAccounts();
 loadBills();
 addUnloadListener("bill", state)
 addHeartbeat();
@@ -97,5 +97,82 @@ $('#passwordForm').on('submit', async function (e) {
     });
 });
 
+function formatSize(size) {
+    if (size >= 1024 * 1024) return (size / 1024 / 1024).toFixed(1) + ' MB';
+    if (size >= 1024) return (size / 1024).toFixed(1) + ' KB';
+    return size + ' B';
+}
+
+function loadBackupStatus() {
+    $.ajax({
+        url: '/api/backup/status',
+        method: 'GET',
+        success: status => {
+            $('#backup-last_success').text(status.last_success || '-');
+            $('#backup-next_run').text(status.next_run || '-');
+            $('#backup-last_error').text(status.last_error || '');
+            const tbody = $('#backup-files');
+            tbody.empty();
+            (status.files || []).forEach(f => {
+                const tr = $('<tr>');
+                tr.append($('<td>').text(f.name));
+                tr.append($('<td>').text(formatSize(f.size)));
+                tr.append($('<td>').text(f.mod_time));
+                const btn = $('<button type="button" class="btn btn-outline-danger btn-sm">')
+                    .text(I18N['Restore'])
+                    .on('click', () => restoreBackup(f.name));
+                tr.append($('<td>').append(btn));
+                tbody.append(tr);
+            });
+        },
+        error: xhr => {
+            if (xhr.status === 501) {
+                $('#btn-backup-run').prop('disabled', true);
+                $('#backup-last_error').text(xhr.responseText);
+                return;
+            }
+            API._handleError(xhr);
+        }
+    });
+}
+
+async function restoreBackup(name) {
+    const ok = await showConfirm(I18N['Restore data from this backup?'] + '\n' + name, 'danger');
+    if (!ok) return;
+    API.post('/api/backup/restore', { name }, () => {
+        showSuccess(I18N['Backup restored']);
+        loadBackupStatus();
+    });
+}
+
+$('#btn-backup-run').on('click', function () {
+    const btn = $(this);
+    btn.prop('disabled', true);
+    API.post('/api/backup/run', null, res => {
+        showSuccess(I18N['Backup created'] + ': ' + res.file);
+        loadBackupStatus();
+        btn.prop('disabled', false);
+    });
+    setTimeout(() => btn.prop('disabled', false), 3000);
+});
+
+$('#btn-import-all').on('click', () => $('#importAllFile').click());
+
+$('#importAllFile').on('change', async function () {
+    const file = this.files[0];
+    this.value = '';
+    if (!file) return;
+    const ok = await showConfirm(I18N['Import data from this archive?'], 'warning');
+    if (!ok) return;
+    const formData = new FormData();
+    formData.append('file', file);
+    API.upload('/api/import/all', formData, () => {
+        showSuccess(I18N['Import finished']);
+        loadBackupStatus();
+    });
+});
+
+loadBackupStatus();
+
 applyNavConfig();
 addHeartbeat();
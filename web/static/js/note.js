@@ -7,12 +7,16 @@ let stateFilter = 0;
 let sortState = { key: null, order: null };
 
 function applyState() {
-    flag = state.flag || 0
-    $("#flag-select").val(flag)
+    stateFilter = state.flag || 0
+    $("#flag-select").val(stateFilter)
 }
 
+// 截止日期视图由服务端筛选
+const VIEWS = { 3: "view=overdue", 4: "view=today", 5: "view=upcoming", 6: "status=archived" };
+
 function loadNotes() {
-    API.get('/api/note/list', data => {
+    const query = VIEWS[stateFilter] ? `?${VIEWS[stateFilter]}` : "";
+    API.get(`/api/note/list${query}`, data => {
         list = data;
         updateView();
     });
@@ -21,13 +25,21 @@ function loadNotes() {
 function applyFilter() {
     filtered = list.filter(note => {
         let matchFilter = !currentFilter || String(note).toLowerCase().includes(currentFilter.toLowerCase());
-        let matchState = stateFilter === 0 ||
-            (stateFilter === 1 && note.process < 100) ||
-            (stateFilter === 2 && note.process >= 100);
+        let matchState = stateFilter === 0 || stateFilter > 2 ||
+            (stateFilter === 1 && (note.status === "todo" || note.status === "doing")) ||
+            (stateFilter === 2 && note.status === "done");
         return matchFilter && matchState;
     });
 }
 
+const STATUSES = ["todo", "doing", "done", "archived"];
+
+function statusOptions(selected) {
+    return STATUSES.map(s =>
+        `<option value="${s}" ${s === selected ? "selected" : ""}>${I18N[s] || s}</option>`
+    ).join("");
+}
+
 function renderTable() {
     const tbody = $("#note-table tbody");
     tbody.empty();
@@ -40,6 +52,12 @@ function renderTable() {
         <td contenteditable="true" data-field="process" data-type="int" class="td-center">${note.process}</td>
         <td contenteditable="true" data-field="desire" data-type="int" class="td-center">${note.desire}</td>
         <td contenteditable="true" data-field="priority" data-type="int" class="td-center">${note.priority}</td>
+        <td contenteditable="true" data-field="due" data-type="int" class="td-center">${note.due || ""}</td>
+        <td>
+          <select class="form-select form-select-sm status-select" data-field="status" data-type="string">
+            ${statusOptions(note.status)}
+          </select>
+        </td>
         <td contenteditable="true" data-field="content" data-type="string" class="td-left">${str2contenteditable(note.content)}</td>
       </tr>
     `);
@@ -57,7 +75,8 @@ function updateView() {
 
 $("#flag-select").on("change", function () {
     stateFilter = parseInt($(this).val());
-    updateView();
+    state.flag = stateFilter;
+    loadNotes();
 });
 
 $("#filter").on("input", function () {
@@ -81,6 +100,9 @@ const updater = createPatchSaver({
 
 function handleNoteUpdate(el) {
   const { id, patch } = readTablePatch(el);
+  const field = $(el).data("field");
+  // 清空截止日期保存为 0
+  if (field === "due" && patch.due === null && $(el).text().trim() === "") patch.due = 0;
   updater.update(id, patch);
 }
 
@@ -90,6 +112,12 @@ bindIMEAutoSave({
     onUpdate: handleNoteUpdate,
 });
 
+// 状态变化会更新进度，保存后重新加载
+$("#note-table tbody").on("change", ".status-select", function () {
+    const { id, patch } = readTablePatch(this);
+    API.post('/api/note/update', { ...patch, id }, () => loadNotes());
+});
+
 $("#btn-add").click(() => {
     API.post('/api/note/add', {}, () => {
         loadNotes()
@@ -127,7 +155,7 @@ $("#btn-export").click(() => {
 });
 
 applyNavConfig();
-initTable("note-table", sortState, new Set(["begin", "last", "progress", "desire", "priority"]));
+initTable("note-table", sortState, new Set(["begin", "last", "process", "desire", "priority", "due"]));
 applyState();
 loadNotes();
 addUnloadListener("note", state)
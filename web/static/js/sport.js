@@ -26,6 +26,26 @@ function applyFilter() {
     });
 }
 
+const ACTIVITIES = ["run", "walk", "hike", "cycle", "swim", "strength", "yoga", "other"];
+
+function activityOptions(selected) {
+    return ACTIVITIES.map(a =>
+        `<option value="${a}" ${a === selected ? "selected" : ""}>${I18N[a] || a}</option>`
+    ).join("");
+}
+
+// 时长以秒保存，表格中按分钟编辑
+function minutes(sec) {
+    return sec ? +(sec / 60).toFixed(1) : "";
+}
+
+// 配速，每公里分:秒
+function pace(sport) {
+    if (!sport.distance || !sport.duration) return "";
+    const sec = Math.round(sport.duration * 1000 / sport.distance);
+    return `${Math.floor(sec / 60)}:${String(sec % 60).padStart(2, "0")}`;
+}
+
 function renderTable() {
     const tbody = $("#sport-table tbody");
     tbody.empty();
@@ -34,7 +54,23 @@ function renderTable() {
       <tr data-id="${sport.id}">
         <td style="display:none">${sport.id}</td>
         <td contenteditable="true" data-field="date" data-type="int" class="td-center">${sport.date}</td>
-        <td contenteditable="true" data-field="content" data-type="string" class="td-left">${str2contenteditable(sport.content)}</td>
+        <td>
+          <select class="form-select form-select-sm activity-select" data-field="activity" data-type="string">
+            ${activityOptions(sport.activity)}
+          </select>
+        </td>
+        <td contenteditable="true" data-field="duration" data-type="float" class="td-center">${minutes(sport.duration)}</td>
+        <td contenteditable="true" data-field="distance" data-type="int" class="td-center">${sport.distance || ""}</td>
+        <td class="td-center">${pace(sport)}</td>
+        <td contenteditable="true" data-field="ascent" data-type="int" class="td-center">${sport.ascent || ""}</td>
+        <td contenteditable="true" data-field="calories" data-type="int" class="td-center">${sport.calories || ""}</td>
+        <td contenteditable="true" data-field="heart_rate" data-type="int" class="td-center">${sport.heart_rate || ""}</td>
+        <td contenteditable="true" data-field="max_heart" data-type="int" class="td-center">${sport.max_heart || ""}</td>
+        <td contenteditable="true" data-field="exercise" data-type="string" class="td-center">${sport.exercise}</td>
+        <td contenteditable="true" data-field="sets" data-type="int" class="td-center">${sport.sets || ""}</td>
+        <td contenteditable="true" data-field="reps" data-type="int" class="td-center">${sport.reps || ""}</td>
+        <td contenteditable="true" data-field="weight" data-type="float" class="td-center">${sport.weight || ""}</td>
+        <td contenteditable="true" data-field="notes" data-type="string" class="td-left">${str2contenteditable(sport.notes)}</td>
       </tr>
     `);
         if (sport.id == selectedId) tr.addClass('table-active');
@@ -75,6 +111,12 @@ const updater = createPatchSaver({
 
 function handleSportUpdate(el) {
   const { id, patch } = readTablePatch(el);
+  const field = $(el).data("field");
+  // 清空的数值列保存为 0
+  if (patch[field] === null && $(el).data("type") !== "string" && $(el).text().trim() === "") {
+    patch[field] = 0;
+  }
+  if (field === "duration" && patch.duration !== null) patch.duration = Math.round(patch.duration * 60);
   updater.update(id, patch);
 }
 
@@ -84,6 +126,10 @@ bindIMEAutoSave({
     onUpdate: handleSportUpdate,
 });
 
+$("#sport-table tbody").on("change", ".activity-select", function () {
+    handleSportUpdate(this);
+});
+
 $("#btn-add").click(() => {
     API.post('/api/sport/add', {}, () => {
         loadNotes()
@@ -116,6 +162,32 @@ $("#importFile").change(function () {
     });
 });
 
+$("#btn-import-track").click(() => $('#trackFile').click());
+$("#trackFile").change(async function () {
+    const files = Array.from(this.files);
+    this.value = "";
+    let added = 0, skipped = 0;
+    for (const file of files) {
+        const form = new FormData();
+        form.append("file", file);
+        // 某个文件失败时继续导入其余文件
+        const report = await new Promise(resolve => $.ajax({
+            url: '/api/sport/import/track',
+            method: 'POST',
+            data: form,
+            contentType: false,
+            processData: false,
+            success: resolve,
+            error: xhr => { API._handleError(xhr); resolve(null); }
+        }));
+        if (!report) continue;
+        added += report.new;
+        skipped += report.unchanged;
+    }
+    loadNotes();
+    showSuccess(`${I18N["Imported"]}: ${added}, ${I18N["Skipped"]}: ${skipped}`);
+});
+
 $("#btn-export").click(() => {
     window.location.href = `/api/sport/export`;
 });